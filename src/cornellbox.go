@@ -13,11 +13,7 @@ func CornellBox() *m.Scene {
 	camera := m.NewPerspectiveCamera(width, height, fov)
 	scene := m.NewScene(camera)
 
-	// use pointlight for whitted style ray tracer
-	pointLight := m.NewPointLight(m.Vector{250, 500, 100}, m.NewColor(255, 255, 255), 50000000)
-	scene.AddLights(pointLight)
-
-	// use area light for path tracer
+	// the light is found by Precompute as an emitter among the objects
 	var intensity float32 = 100.0
 	lightMat := m.NewRadiantMaterial(m.ConstantTexture{Color: m.NewColor(255, 255, 255).Times(intensity)})
 
@@ -33,7 +29,6 @@ func CornellBox() *m.Scene {
 		lightMat)
 	t1, t2 := light.Tesselate()
 	triangles = append(triangles, t1, t2)
-	scene.Emitters = []m.Triangle{t1, t2}
 
 	white := m.NewDiffuseMaterial(m.ConstantTexture{Color: m.NewColor(186, 186, 186)})
 	green := m.NewDiffuseMaterial(m.ConstantTexture{Color: m.NewColor(31, 115, 38)})
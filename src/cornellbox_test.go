@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	m "github.com/deosjr/GRayT/src/model"
+	"github.com/deosjr/GRayT/src/render"
+)
+
+// pixels looking straight at the light are clamped, otherwise the
+// antialiasing noise along its edges dominates the comparison
+func meanLuminance(f render.Film, w, h int) float32 {
+	var sum float32
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			l := f.Get(x, y).Luminance()
+			if l > 1 {
+				l = 1
+			}
+			sum += l
+		}
+	}
+	return sum / float32(w*h)
+}
+
+// All these tracers are unbiased estimators of the same image, so on
+// average they should agree with NEE; they only differ in variance
+func TestCornellBoxTracersMatchNEE(t *testing.T) {
+	// the scene is sized by the package globals, which other tests may rely on
+	defer func(w, h uint) { width, height = w, h }(width, height)
+	width, height = 32, 32
+	scene := CornellBox()
+	params := render.Params{
+		Scene:        scene,
+		NumWorkers:   4,
+		NumSamples:   64,
+		AntiAliasing: true,
+		TracerType:   m.PathNextEventEstimate,
+		MaxDepth:     10,
+	}
+	film, err := render.Render(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nee := meanLuminance(film, int(width), int(height))
+	for _, tt := range []m.TracerType{m.PathMultipleImportanceSampling, m.BidirectionalPath} {
+		params.TracerType = tt
+		film, err := render.Render(params)
+		if err != nil {
+			t.Fatalf("tracer %d: %v", tt, err)
+		}
+		got := meanLuminance(film, int(width), int(height))
+		if diff := math.Abs(float64(nee-got)) / float64(nee); diff > 0.02 {
+			t.Errorf("tracer %d: NEE mean %v and mean %v differ by %.1f%%", tt, nee, got, diff*100)
+		}
+	}
+}
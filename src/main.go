@@ -50,7 +50,11 @@ func main() {
 	}
 
 	// aw := render.NewAVI("out.avi", width, height)
-	film := render.Render(params)
+	film, err := render.Render(params)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	film.SaveAsPNG("out.png")
 
 	if *memprofile != "" {
@@ -30,8 +30,9 @@ func (na *NaiveAcceleration) ClosestIntersection(ray Ray, maxDistance float32) (
 	var found bool
 	var surfaceInteraction *SurfaceInteraction
 	distance := maxDistance
+	ray.countPrimitives(len(na.objects))
 	for _, o := range na.objects {
-		if si, ok := o.Intersect(ray); ok && si.distance < distance && si.distance > ERROR_MARGIN {
+		if si, ok := intersectOpaque(o, ray, distance); ok {
 			distance = si.distance
 			surfaceInteraction = si
 			found = true
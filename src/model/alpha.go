@@ -0,0 +1,102 @@
+package model
+
+import "math"
+
+// maskedMaterial is implemented by all materials through the embedded
+// material, which holds the opacity mask
+type maskedMaterial interface {
+	mask() (opacity Texture, threshold float32)
+}
+
+func (m material) mask() (Texture, float32) {
+	return m.Opacity, m.AlphaThreshold
+}
+
+func maskOf(m Material) (Texture, float32) {
+	if mm, ok := m.(maskedMaterial); ok {
+		return mm.mask()
+	}
+	return nil, 0
+}
+
+// opaque tests a hit against the opacity mask of its material. Skipped
+// hits are stochastic by a hash of the hit point in object space, so
+// that a hit is let through the same way however often it is tested:
+// by the acceleration structures of both a mesh and the scene, or by
+// camera and shadow rays alike: pbrt-v4 6.8.2
+func opaque(si *SurfaceInteraction) bool {
+	if si.alphaTested {
+		return true
+	}
+	opacity, threshold := maskOf(si.object.GetMaterial())
+	if opacity == nil {
+		return true
+	}
+	a := opacity.GetColor(si).Luminance()
+	if threshold > 0 {
+		if a < threshold {
+			return false
+		}
+	} else if a < 1 && hashFloat(si.UntransformedPoint) >= a {
+		return false
+	}
+	si.alphaTested = true
+	return true
+}
+
+// intersectOpaque returns the closest hit of o along ray within
+// maxDistance that its opacity mask does not cut out. A cut out hit is
+// retried from just past it, so that through a masked sphere, say, the
+// far side shows; distances stay measured along the original ray
+func intersectOpaque(o Object, ray Ray, maxDistance float32) (*SurfaceInteraction, bool) {
+	r := ray
+	var offset float32
+	for {
+		si, ok := o.Intersect(r)
+		if !ok {
+			return nil, false
+		}
+		if si.distance <= ERROR_MARGIN {
+			return nil, false
+		}
+		si.distance += offset
+		if si.distance >= maxDistance {
+			return nil, false
+		}
+		if opaque(si) {
+			return si, true
+		}
+		// far along the ray, floats can be too coarse to get past the hit
+		next := si.distance + ERROR_MARGIN
+		if next <= offset {
+			return nil, false
+		}
+		offset = next
+		r.Origin = PointFromRay(ray, offset)
+	}
+}
+
+// opaqueAt tests the hit of a triangle stored without materials in
+// TriangleBVH and Triangle4BVH at distance d along r
+func (t Triangle) opaqueAt(r Ray, d float32) bool {
+	if opacity, _ := maskOf(t.Material); opacity == nil {
+		return true
+	}
+	return opaque(NewSurfaceInteraction(t, d, t.SurfaceNormal(Vector{}), r))
+}
+
+// hashFloat maps a point to a pseudo random number in [0,1)
+func hashFloat(p Vector) float32 {
+	h := uint64(14695981039346656037)
+	for _, f := range []float32{p.X, p.Y, p.Z} {
+		h ^= uint64(math.Float32bits(f))
+		h *= 1099511628211
+	}
+	// finalizer of murmurhash3, as fnv mixes the last bits poorly
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return float32(h>>40) / (1 << 24)
+}
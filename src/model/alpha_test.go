@@ -0,0 +1,150 @@
+package model
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// a quad at z = -1 cut out left of x = 0, in front of a quad at z = -2
+func maskedQuads() []Triangle {
+	mask := NewDiffuseMaterial(NewConstantTexture(Color{1, 1, 1}))
+	mask.Opacity = funcTexture(func(si *SurfaceInteraction) Color {
+		if si.Point.X < 0 {
+			return Color{0.2, 0.2, 0.2}
+		}
+		return Color{1, 1, 1}
+	})
+	mask.AlphaThreshold = 0.5
+	var triangles []Triangle
+	for _, q := range []struct {
+		z float32
+		m Material
+	}{{-1, mask}, {-2, nil}} {
+		p00, p10, p11, p01 := Vector{-2, -2, q.z}, Vector{2, -2, q.z}, Vector{2, 2, q.z}, Vector{-2, 2, q.z}
+		triangles = append(triangles, NewTriangle(p00, p10, p11, q.m), NewTriangle(p00, p11, p01, q.m))
+	}
+	return triangles
+}
+
+func TestAlphaMask(t *testing.T) {
+	triangles := maskedQuads()
+	objects := make([]Object, len(triangles))
+	for i, tr := range triangles {
+		objects[i] = tr
+	}
+	for name, as := range map[string]AccelerationStructure{
+		"naive":     NewNaiveAcceleration(objects),
+		"bvh":       NewBVH(objects, SplitSurfaceAreaHeuristic),
+		"triangles": NewTriangleBVH(triangles, SplitSurfaceAreaHeuristic),
+		"simd":      NewTriangle4BVH(triangles),
+	} {
+		for i, tt := range []struct {
+			x    float32
+			want float32
+		}{
+			{x: 0.5, want: 1},
+			{x: -0.5, want: 2},
+		} {
+			ray := NewRay(Vector{tt.x, 0, 0}, Vector{0, 0, -1})
+			si, ok := as.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+			if !ok {
+				t.Fatalf("%s %d): expected hit", name, i)
+			}
+			if !compareFloat32(si.distance, tt.want) {
+				t.Errorf("%s %d): got distance %f want %f", name, i, si.distance, tt.want)
+			}
+			inShadow := pointInShadow(ray.Origin, Vector{0, 0, -1.5}, 1.5, as)
+			if inShadow != (tt.want == 1) {
+				t.Errorf("%s %d): got in shadow %t", name, i, inShadow)
+			}
+		}
+	}
+}
+
+func TestAlphaMaskSphere(t *testing.T) {
+	// the half of the sphere facing the ray is cut out
+	mask := NewDiffuseMaterial(NewConstantTexture(Color{1, 1, 1}))
+	mask.Opacity = funcTexture(func(si *SurfaceInteraction) Color {
+		if si.UntransformedPoint.Z > 0 {
+			return Color{}
+		}
+		return Color{1, 1, 1}
+	})
+	mask.AlphaThreshold = 0.5
+	sphere := NewSphere(Vector{0, 0, 0}, 1, mask)
+	for i, tt := range []struct {
+		o       Object
+		origin  Vector
+		maxDist float32
+		want    float32
+		wantHit bool
+	}{
+		{o: sphere, origin: Vector{0, 0, 5}, maxDist: MAX_RAY_DISTANCE, want: 6, wantHit: true},
+		{o: sphere, origin: Vector{0, 0, 5}, maxDist: 5, wantHit: false},
+		{o: NewSharedObject(sphere, Translate(Vector{0, 0, -2})), origin: Vector{0, 0, 5}, maxDist: MAX_RAY_DISTANCE, want: 8, wantHit: true},
+	} {
+		for name, as := range map[string]AccelerationStructure{
+			"naive": NewNaiveAcceleration([]Object{tt.o}),
+			"bvh":   NewBVH([]Object{tt.o}, SplitSurfaceAreaHeuristic),
+		} {
+			si, ok := as.ClosestIntersection(NewRay(tt.origin, Vector{0, 0, -1}), tt.maxDist)
+			if ok != tt.wantHit {
+				t.Fatalf("%s %d): got hit %t want %t", name, i, ok, tt.wantHit)
+			}
+			if ok && !compareFloat32(si.distance, tt.want) {
+				t.Errorf("%s %d): got distance %f want %f", name, i, si.distance, tt.want)
+			}
+		}
+	}
+}
+
+func TestAlphaStochastic(t *testing.T) {
+	half := NewDiffuseMaterial(NewConstantTexture(Color{1, 1, 1}))
+	half.Opacity = NewConstantTexture(Color{0.5, 0.5, 0.5})
+	// nested in a mesh, the mask is tested by both acceleration structures
+	mesh := NewTriangleMesh([]Vector{{-2, -2, -1}, {2, -2, -1}, {2, 2, -1}, {-2, 2, -1}}, []Face{{0, 1, 2}, {0, 2, 3}}, half)
+	as := NewBVH([]Object{mesh}, SplitSurfaceAreaHeuristic)
+	n, hits := 100, 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			ray := NewRay(Vector{float32(x)/float32(n) - 0.5, float32(y)/float32(n) - 0.5, 0}, Vector{0, 0, -1})
+			_, ok := as.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+			if ok {
+				hits++
+			}
+			if _, again := as.ClosestIntersection(ray, MAX_RAY_DISTANCE); again != ok {
+				t.Fatalf("hit at %v differs between tests", ray.Origin)
+			}
+		}
+	}
+	if got := float32(hits) / float32(n*n); got < 0.45 || got > 0.55 {
+		t.Errorf("got %f of rays hitting want about 0.5", got)
+	}
+}
+
+func TestImageAlphaTexture(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.NRGBA{255, 0, 0, 51})
+	uv := func(u float32) func(*SurfaceInteraction) Vector {
+		return func(*SurfaceInteraction) Vector { return Vector{u, 0.5, 0} }
+	}
+	for i, tt := range []struct {
+		u         float32
+		wantColor Color
+		wantAlpha float32
+	}{
+		{u: 0.25, wantColor: Color{1, 0, 0}, wantAlpha: 1},
+		{u: 0.75, wantColor: Color{1, 0, 0}, wantAlpha: 0.2},
+	} {
+		c := NewImageTexture(img, uv(tt.u)).GetColor(nil)
+		if !compareFloat32(c.r, tt.wantColor.r) || c.g != 0 || c.b != 0 {
+			t.Errorf("%d): got color %v want %v", i, c, tt.wantColor)
+		}
+		a := NewImageAlphaTexture(img, uv(tt.u)).GetColor(nil)
+		if !compareFloat32(a.r, tt.wantAlpha) {
+			t.Errorf("%d): got alpha %v want %f", i, a, tt.wantAlpha)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package model
+
+// Bidirectional path tracing: pbrt ch16.3
+// Traces a subpath from the camera and one from a random emitter, then
+// connects every prefix of one to every prefix of the other. Each of these
+// strategies could have generated the same path, so contributions are
+// combined using multiple importance sampling (balance heuristic).
+// Only diffuse surfaces and a pinhole camera are supported.
+
+type vertexType int
+
+const (
+	cameraVertex vertexType = iota
+	lightVertex
+	surfaceVertex
+)
+
+type pathVertex struct {
+	vtype  vertexType
+	point  Vector
+	normal Vector
+	// reflectance of surface vertices, radiance of emitters
+	color Color
+	// surface vertices that are part of an emitter can only end a path
+	emitter bool
+	// emitters that emit from both sides of their surface
+	twoSided bool
+	// the light of light vertices, and of emitters that light sampling
+	// could also have picked
+	light Light
+	// light vertices of distant lights are a point on a disk outside the
+	// scene; only the direction of their light matters
+	infinite bool
+	// throughput of the subpath up to and including this vertex
+	beta Color
+	// area density of sampling this vertex from its predecessor in the
+	// subpath (fwd) or from its successor when reversing the subpath (rev)
+	pdfFwd, pdfRev float32
+}
+
+func (v pathVertex) isLight() bool {
+	return v.vtype == lightVertex || v.emitter
+}
+
+// brdf between directions towards a and b, surfaces are one-sided
+func (v pathVertex) f(a, b Vector) Color {
+	wa := VectorFromTo(v.point, a).Normalize()
+	wb := VectorFromTo(v.point, b).Normalize()
+	if v.normal.Dot(wa) <= 0 || v.normal.Dot(wb) <= 0 {
+		return Color{}
+	}
+	return v.color.Times(INVPI)
+}
+
+// radiance emitted from v towards point p; for light vertices of point
+// lights this is their intensity, which may depend on direction
+func (v pathVertex) le(p Vector) Color {
+	if l, ok := v.light.(pointEmitter); ok && v.vtype == lightVertex {
+		return l.radiantIntensity(VectorFromTo(v.point, p).Normalize())
+	}
+	if v.normal != (Vector{}) && !v.twoSided && v.normal.Dot(VectorFromTo(v.point, p)) <= 0 {
+		return Color{}
+	}
+	return v.color
+}
+
+// convertDensity turns a solid angle density at v into an area density at next
+func (v pathVertex) convertDensity(pdf float32, next pathVertex) float32 {
+	w := VectorFromTo(v.point, next.point)
+	dist2 := w.Dot(w)
+	if dist2 == 0 {
+		return 0
+	}
+	return pdf * next.cos(w.Normalize()) / dist2
+}
+
+// absolute cosine between the surface at v and direction w; 1 for
+// vertices without a surface
+func (v pathVertex) cos(w Vector) float32 {
+	if v.vtype == cameraVertex || v.normal == (Vector{}) {
+		return 1
+	}
+	cos := v.normal.Dot(w)
+	if cos < 0 {
+		cos = -cos
+	}
+	return cos
+}
+
+// area density at next of sampling it as the next vertex from v
+// both surfaces and emitters sample a cosine weighted hemisphere
+func (v pathVertex) pdf(camera *PerspectiveCamera, next pathVertex) float32 {
+	w := VectorFromTo(v.point, next.point).Normalize()
+	switch v.vtype {
+	case cameraVertex:
+		_, pdf := camera.importance(w)
+		return v.convertDensity(pdf, next)
+	case lightVertex:
+		pdfPos, pdfDir := v.light.PdfLe(w, v.normal)
+		if v.infinite {
+			// parallel rays: the density on the disk carries over to next
+			return pdfPos * next.cos(w)
+		}
+		return v.convertDensity(pdfDir, next)
+	}
+	return v.convertDensity(cosineHemispherePDF(v.normal, w), next)
+}
+
+// area density of choosing a point on l as the start of a light subpath
+func pdfLightOrigin(scene *Scene, l Light, w, n Vector) float32 {
+	pdfPos, _ := l.PdfLe(w, n)
+	return pdfPos * scene.emissionSampler.pmf(Vector{}, Vector{}, l)
+}
+
+type bidirectionalPathTracer struct {
+	tracer
+	splats []Splat
+}
+
+func NewBidirectionalPathTracer(maxDepth int) Tracer {
+	return &bidirectionalPathTracer{tracer: newTracer(maxDepth)}
+}
+
+func (bdpt *bidirectionalPathTracer) Splats() []Splat {
+	splats := bdpt.splats
+	bdpt.splats = nil
+	return splats
+}
+
+func (bdpt *bidirectionalPathTracer) GetRayColor(ray Ray, scene *Scene, depth int) Color {
+	camera, ok := scene.Camera.(*PerspectiveCamera)
+	if !ok {
+		panic("bidirectional path tracing needs a perspective camera!")
+	}
+	maxDepth := bdpt.maxDepth - depth
+	cameraPath := bdpt.cameraSubpath(ray, scene, camera, maxDepth+2)
+	lightPath := bdpt.lightSubpath(scene, maxDepth+1)
+
+	color := NewColor(0, 0, 0)
+	for t := 1; t <= len(cameraPath); t++ {
+		for s := 0; s <= len(lightPath); s++ {
+			d := s + t - 2
+			if (s == 1 && t == 1) || d < 0 || d > maxDepth {
+				continue
+			}
+			color = color.Add(bdpt.connect(scene, camera, lightPath, cameraPath, s, t))
+		}
+	}
+	return color
+}
+
+func (bdpt *bidirectionalPathTracer) cameraSubpath(ray Ray, scene *Scene, camera *PerspectiveCamera, maxVertices int) []pathVertex {
+	path := make([]pathVertex, 1, maxVertices)
+	path[0] = pathVertex{
+		vtype: cameraVertex,
+		point: ray.Origin,
+		beta:  NewColor(255, 255, 255),
+	}
+	_, pdf := camera.importance(ray.Direction)
+	return bdpt.randomWalk(ray, scene, path, path[0].beta, pdf, maxVertices)
+}
+
+func (bdpt *bidirectionalPathTracer) lightSubpath(scene *Scene, maxVertices int) []pathVertex {
+	light, pdfChoice := scene.emissionLight(bdpt.random)
+	ray, n, le, pdfPos, pdfDir := light.SampleLe(bdpt.random)
+	infinite := light.IsInfinite()
+	path := make([]pathVertex, 1, maxVertices)
+	path[0] = pathVertex{
+		vtype:    lightVertex,
+		point:    ray.Origin,
+		normal:   n,
+		color:    le,
+		light:    light,
+		infinite: infinite,
+		beta:     le.Times(1 / (pdfPos * pdfChoice)),
+		pdfFwd:   pdfPos * pdfChoice,
+	}
+	if area, ok := light.(*AreaLight); ok {
+		path[0].twoSided = area.twoSided
+	}
+	if maxVertices == 1 || pdfPos == 0 || pdfDir == 0 {
+		return path
+	}
+	beta := le.Times(path[0].cos(ray.Direction) / (pdfPos * pdfChoice * pdfDir))
+	path = bdpt.randomWalk(ray, scene, path, beta, pdfDir, maxVertices)
+	if infinite && len(path) > 1 {
+		path[1].pdfFwd = path[0].pdf(nil, path[1])
+	}
+	return path
+}
+
+// randomWalk extends path, starting with a ray leaving its last vertex
+// with throughput beta, whose direction was sampled with solid angle density pdf
+func (bdpt *bidirectionalPathTracer) randomWalk(ray Ray, scene *Scene, path []pathVertex, beta Color, pdf float32, maxVertices int) []pathVertex {
+	for len(path) < maxVertices {
+		si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+		if !ok {
+			break
+		}
+		si.as = scene.AccelerationStructure
+		si.tracer = bdpt
+		si.applyShadingNormal()
+		prev := len(path) - 1
+		v := pathVertex{
+			vtype:    surfaceVertex,
+			point:    si.Point,
+			normal:   si.normal,
+			color:    si.object.GetColor(si),
+			emitter:  si.object.IsLight(),
+			twoSided: twoSidedEmitter(si.object.GetMaterial()),
+			beta:     beta,
+		}
+		if v.emitter {
+			if light, ok := scene.areaLight(si); ok {
+				v.light = light
+			}
+		}
+		v.pdfFwd = path[prev].convertDensity(pdf, v)
+		path = append(path, v)
+		if v.emitter || len(path) == maxVertices {
+			break
+		}
+		wo := ray.Direction.Times(-1)
+		if v.normal.Dot(wo) <= 0 {
+			break
+		}
+		direction := cosineSampleHemisphere(bdpt.random, v.normal)
+		pdf = cosineHemispherePDF(v.normal, direction)
+		if pdf == 0 {
+			break
+		}
+		// diffuse brdf times cosine over cosine weighted pdf is the albedo
+		beta = beta.Product(v.color)
+		pdfRev := cosineHemispherePDF(v.normal, wo)
+		path[prev].pdfRev = v.convertDensity(pdfRev, path[prev])
+		ray = NewRay(v.point, direction)
+	}
+	return path
+}
+
+func (bdpt *bidirectionalPathTracer) connect(scene *Scene, camera *PerspectiveCamera, lightPath, cameraPath []pathVertex, s, t int) Color {
+	var l Color
+	switch {
+	case s == 0:
+		// camera subpath hit an emitter on its own
+		pt := cameraPath[t-1]
+		if !pt.emitter {
+			return Color{}
+		}
+		l = pt.beta.Product(pt.le(cameraPath[t-2].point))
+	case t == 1:
+		// light tracing: connect the light subpath to the camera
+		qs := lightPath[s-1]
+		if qs.isLight() {
+			return Color{}
+		}
+		x, y, ok := camera.RasterPosition(qs.point)
+		if !ok {
+			return Color{}
+		}
+		cameraPoint := cameraPath[0].point
+		w := VectorFromTo(cameraPoint, qs.point)
+		dist := w.Length()
+		_, pdf := camera.importance(w.Normalize())
+		if pdf == 0 {
+			return Color{}
+		}
+		cos := qs.normal.Dot(w.Normalize().Times(-1))
+		if cos <= 0 {
+			return Color{}
+		}
+		// sampling the camera point has solid angle density dist^2 / cosCamera
+		// and We * cosCamera equals the directional pdf of a pinhole camera
+		l = qs.beta.Product(qs.f(lightPath[s-2].point, cameraPoint)).Times(cos * pdf / (dist * dist))
+		if l.MaxComponent() == 0 || pointInShadow(qs.point, w.Times(-1), dist-ERROR_MARGIN, scene.AccelerationStructure) {
+			return Color{}
+		}
+		l = l.Times(bdpt.misWeight(scene, camera, lightPath, cameraPath, s, t))
+		bdpt.splats = append(bdpt.splats, Splat{X: int(x), Y: int(y), Color: l})
+		return Color{}
+	case s == 1 && lightPath[0].infinite:
+		// rays of the light subpath are parallel, so they cannot be
+		// connected to; instead sample the light's direction from pt
+		pt := cameraPath[t-1]
+		if pt.emitter {
+			return Color{}
+		}
+		qs := lightPath[0]
+		li, segment, _ := qs.light.SampleLi(bdpt.random, pt.point)
+		w := segment.Normalize()
+		cos := pt.normal.Dot(w)
+		if cos <= 0 {
+			return Color{}
+		}
+		qs.point = pt.point.Add(segment)
+		fpt := pt.f(cameraPath[t-2].point, qs.point)
+		pdfChoice := scene.emissionSampler.pmf(Vector{}, Vector{}, qs.light)
+		l = pt.beta.Product(fpt).Product(li).Times(cos / pdfChoice)
+		if l.MaxComponent() == 0 || pointInShadow(pt.point, segment, MAX_RAY_DISTANCE, scene.AccelerationStructure) {
+			return Color{}
+		}
+		lightPath = []pathVertex{qs}
+	default:
+		qs, pt := lightPath[s-1], cameraPath[t-1]
+		if pt.emitter || (s > 1 && qs.isLight()) {
+			return Color{}
+		}
+		var fqs Color
+		beta := qs.beta
+		if s == 1 {
+			// radiance towards pt rather than in the sampled direction
+			beta = qs.le(pt.point).Times(1 / qs.pdfFwd)
+			fqs = NewColor(255, 255, 255)
+		} else {
+			fqs = qs.f(lightPath[s-2].point, pt.point)
+		}
+		fpt := pt.f(cameraPath[t-2].point, qs.point)
+		l = beta.Product(fqs).Product(fpt).Product(pt.beta)
+		if l.MaxComponent() == 0 {
+			return Color{}
+		}
+		w := VectorFromTo(pt.point, qs.point)
+		dist := w.Length()
+		wn := w.Normalize()
+		g := pt.normal.Dot(wn) * qs.cos(wn) / (dist * dist)
+		if g <= 0 || pointInShadow(pt.point, w, dist-ERROR_MARGIN, scene.AccelerationStructure) {
+			return Color{}
+		}
+		l = l.Times(g)
+	}
+	if l.MaxComponent() == 0 {
+		return Color{}
+	}
+	return l.Times(bdpt.misWeight(scene, camera, lightPath, cameraPath, s, t))
+}
+
+// misWeight computes the balance heuristic weight of strategy (s,t)
+// by walking over the vertices of the full path, computing the relative
+// densities of all other strategies that could have generated it: pbrt 1012
+func (bdpt *bidirectionalPathTracer) misWeight(scene *Scene, camera *PerspectiveCamera, lightPath, cameraPath []pathVertex, s, t int) float32 {
+	if s+t == 2 {
+		return 1
+	}
+	// copy the vertices whose reverse densities change after connecting
+	light := make([]pathVertex, s)
+	copy(light, lightPath[:s])
+	cam := make([]pathVertex, t)
+	copy(cam, cameraPath[:t])
+
+	pt := &cam[t-1]
+	switch {
+	case s > 0:
+		qs := &light[s-1]
+		pt.pdfRev = qs.pdf(camera, *pt)
+		qs.pdfRev = pt.pdf(camera, *qs)
+		if s > 1 {
+			light[s-2].pdfRev = qs.pdf(camera, light[s-2])
+		}
+		if t > 1 {
+			cam[t-2].pdfRev = pt.pdf(camera, cam[t-2])
+		}
+	default:
+		// pt is an emitter that light sampling could have chosen too
+		pt.pdfRev = 0
+		if pt.light != nil {
+			w := VectorFromTo(pt.point, cam[t-2].point).Normalize()
+			pt.pdfRev = pdfLightOrigin(scene, pt.light, w, pt.normal)
+		}
+		cam[t-2].pdfRev = pt.pdf(camera, cam[t-2])
+	}
+
+	remap0 := func(f float32) float32 {
+		if f == 0 {
+			return 1
+		}
+		return f
+	}
+	var sumRi float32
+	ri := float32(1)
+	for i := t - 1; i > 0; i-- {
+		ri *= remap0(cam[i].pdfRev) / remap0(cam[i].pdfFwd)
+		sumRi += ri
+	}
+	ri = 1
+	for i := s - 1; i >= 0; i-- {
+		ri *= remap0(light[i].pdfRev) / remap0(light[i].pdfFwd)
+		// camera subpaths cannot hit delta lights
+		if i == 0 && light[0].light.IsDelta() {
+			continue
+		}
+		sumRi += ri
+	}
+	return 1 / (1 + sumRi)
+}
+
+// A Splat is a contribution to an arbitrary pixel on the film, found by
+// tracing paths starting from a light instead of from the camera
+type Splat struct {
+	X, Y  int
+	Color Color
+}
+
+// A SplattingTracer contributes to other pixels than the one it was
+// asked the color of; Splats returns and clears those contributions
+type SplattingTracer interface {
+	Tracer
+	Splats() []Splat
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+// SDFs and implicit surfaces hold funcs, so only pointers to them can be
+// the map keys that tracers look up the area light of a hit by
+func TestTracersOverFuncObjects(t *testing.T) {
+	diffuse := NewDiffuseMaterial(NewConstantTexture(NewColor(200, 200, 200)))
+	radiant := NewRadiantMaterial(NewConstantTexture(NewColor(255, 255, 255)))
+	scene := NewScene(NewPerspectiveCamera(8, 8, 0.5*math.Pi))
+	scene.Camera.LookAt(Vector{0, 1, 5}, Vector{0, 1, 0}, Vector{0, 1, 0})
+	scene.Add(
+		NewTriangle(Vector{-10, 0, -10}, Vector{-10, 0, 10}, Vector{10, 0, 10}, diffuse),
+		NewTriangle(Vector{-10, 0, -10}, Vector{10, 0, 10}, Vector{10, 0, -10}, diffuse),
+		NewSDFObject(SphereSDF(1).Translate(Vector{-1.5, 1, 0}), NewAABB(Vector{-2.5, 0, -1}, Vector{-0.5, 2, 1}), diffuse),
+		NewSDFObject(SphereSDF(0.5).Translate(Vector{0, 3, 0}), NewAABB(Vector{-0.5, 2.5, -0.5}, Vector{0.5, 3.5, 0.5}), radiant),
+		NewMetaballs([]Metaball{{Center: Vector{1.5, 1, 0}, Radius: 1, Strength: 1}}, 0.5, diffuse),
+	)
+	scene.AddLights(NewPointLight(Vector{0, 5, 5}, NewColor(255, 255, 255), 100))
+	scene.Precompute()
+	for _, tracer := range []Tracer{NewBidirectionalPathTracer(5), NewPathTracerMIS(5)} {
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				c := tracer.GetRayColor(scene.Camera.PixelRay(float32(x)+0.5, float32(y)+0.5), scene, 0)
+				if math.IsNaN(float64(c.Luminance())) {
+					t.Fatalf("%T: got NaN at %d, %d", tracer, x, y)
+				}
+			}
+		}
+	}
+}
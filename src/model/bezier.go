@@ -0,0 +1,134 @@
+package model
+
+import "math"
+
+// patches are never split into more segments than this along u or v
+const BEZIER_MAX_SEGMENTS = 64
+
+// A BezierPatch is a bicubic Bezier patch given by a 4x4 grid of control
+// points, row by row with u going along the rows and v down the columns
+type BezierPatch [16]Vector
+
+// BezierPatchesFromIndices builds patches from shared control points, the
+// way classic data such as the Utah teapot is stored
+func BezierPatchesFromIndices(vertices []Vector, indices [][16]int64) []BezierPatch {
+	patches := make([]BezierPatch, len(indices))
+	for i, index := range indices {
+		for k, v := range index {
+			patches[i][k] = vertices[v]
+		}
+	}
+	return patches
+}
+
+// bezier evaluates a cubic Bezier curve and its derivative at t by
+// de Casteljau's algorithm
+func bezier(cp [4]Vector, t float32) (Vector, Vector) {
+	a := [3]Vector{lerpVector(cp[0], cp[1], t), lerpVector(cp[1], cp[2], t), lerpVector(cp[2], cp[3], t)}
+	b := [2]Vector{lerpVector(a[0], a[1], t), lerpVector(a[1], a[2], t)}
+	return lerpVector(b[0], b[1], t), VectorFromTo(b[0], b[1]).Times(3)
+}
+
+func lerpVector(u, v Vector, t float32) Vector {
+	return u.Times(1 - t).Add(v.Times(t))
+}
+
+func (b BezierPatch) row(i int) [4]Vector {
+	return [4]Vector{b[4*i], b[4*i+1], b[4*i+2], b[4*i+3]}
+}
+
+func (b BezierPatch) column(j int) [4]Vector {
+	return [4]Vector{b[j], b[4+j], b[8+j], b[12+j]}
+}
+
+// Evaluate returns the point at u, v and its partial derivatives
+func (b BezierPatch) Evaluate(u, v float32) (p, dpdu, dpdv Vector) {
+	// collapse the rows to a curve along v, and the columns to one along u
+	var alongV, alongU [4]Vector
+	for i := 0; i < 4; i++ {
+		alongV[i], _ = bezier(b.row(i), u)
+		alongU[i], _ = bezier(b.column(i), v)
+	}
+	p, dpdv = bezier(alongV, v)
+	_, dpdu = bezier(alongU, u)
+	return p, dpdu, dpdv
+}
+
+// Normal returns the surface normal at u, v, following dpdu x dpdv.
+// Patches can collapse an edge to a single point, as at the top of the
+// teapot's lid, where the normal is taken just inside the patch instead
+func (b BezierPatch) Normal(u, v float32) Vector {
+	for i := 0; i < 8; i++ {
+		_, dpdu, dpdv := b.Evaluate(u, v)
+		n := dpdu.Cross(dpdv)
+		if n.Length() > 1e-6 {
+			return n.Normalize()
+		}
+		u, v = mixf(u, 0.5, 0.01), mixf(v, 0.5, 0.01)
+	}
+	return Vector{}
+}
+
+// segments returns the number of straight segments needed along u and v
+// to stay within tolerance of the patch. Cubic curves deviate at most
+// 6/(8n^2) times their largest second difference from n chords
+func (b BezierPatch) segments(tolerance float32) (int, int) {
+	var du, dv float32
+	for i := 0; i < 4; i++ {
+		du = maxf(du, secondDifference(b.row(i)))
+		dv = maxf(dv, secondDifference(b.column(i)))
+	}
+	n := func(d float32) int {
+		s := int(math.Ceil(math.Sqrt(float64(3 * d / (4 * tolerance)))))
+		return clampInt(s, 1, BEZIER_MAX_SEGMENTS)
+	}
+	return n(du), n(dv)
+}
+
+func secondDifference(cp [4]Vector) float32 {
+	d0 := cp[0].Sub(cp[1].Times(2)).Add(cp[2])
+	d1 := cp[1].Sub(cp[2].Times(2)).Add(cp[3])
+	return maxf(d0.Length(), d1.Length())
+}
+
+// NewBezierPatches tessellates patches into a single TriangleMesh, with
+// the normals of the surface and the u, v of each patch as uvs. Every
+// patch is split into a grid that stays within tolerance of the surface;
+// all patches share the finest grid needed so that they meet without cracks
+func NewBezierPatches(patches []BezierPatch, tolerance float32, mat Material) Object {
+	n := 1
+	for _, b := range patches {
+		nu, nv := b.segments(tolerance)
+		n = maxInt(n, maxInt(nu, nv))
+	}
+	var vertices, normals, uvs []Vector
+	var faces []Face
+	for _, b := range patches {
+		offset := int64(len(vertices))
+		for j := 0; j <= n; j++ {
+			for i := 0; i <= n; i++ {
+				u, v := float32(i)/float32(n), float32(j)/float32(n)
+				p, _, _ := b.Evaluate(u, v)
+				vertices = append(vertices, p)
+				normals = append(normals, b.Normal(u, v))
+				uvs = append(uvs, Vector{u, v, 0})
+			}
+		}
+		for j := 0; j < n; j++ {
+			for i := 0; i < n; i++ {
+				v00 := offset + int64(j*(n+1)+i)
+				v10, v01, v11 := v00+1, v00+int64(n+1), v00+int64(n+2)
+				// collapsed edges leave degenerate triangles, which never hit
+				faces = append(faces, NewFace(v00, v10, v11), NewFace(v00, v11, v01))
+			}
+		}
+	}
+	mesh := NewTriangleMesh(vertices, faces, mat).(*TriangleMesh)
+	mesh.Normals = map[int64]Vector{}
+	mesh.UV = map[int64]Vector{}
+	for i := range vertices {
+		mesh.Normals[int64(i)] = normals[i]
+		mesh.UV[int64(i)] = uvs[i]
+	}
+	return mesh
+}
@@ -0,0 +1,88 @@
+package model
+
+import "testing"
+
+// a patch bulging up in y over the unit square in x and z
+func bulgePatch(height float32) BezierPatch {
+	var b BezierPatch
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			var y float32
+			if (i == 1 || i == 2) && (j == 1 || j == 2) {
+				y = height
+			}
+			b[4*j+i] = Vector{float32(i) / 3, y, -float32(j) / 3}
+		}
+	}
+	return b
+}
+
+func TestBezierPatchEvaluate(t *testing.T) {
+	b := bulgePatch(1)
+	for i, tt := range []struct {
+		u, v       float32
+		want       Vector
+		wantNormal Vector
+	}{
+		{u: 0, v: 0, want: Vector{0, 0, 0}, wantNormal: Vector{0, 1, 0}},
+		{u: 1, v: 1, want: Vector{1, 0, -1}, wantNormal: Vector{0, 1, 0}},
+		// both cubics peak at 3/4 of their middle control points
+		{u: 0.5, v: 0.5, want: Vector{0.5, 0.5625, -0.5}, wantNormal: Vector{0, 1, 0}},
+		{u: 0.5, v: 0, want: Vector{0.5, 0, 0}, wantNormal: Vector{0, 1, 2.25}.Normalize()},
+	} {
+		p, _, _ := b.Evaluate(tt.u, tt.v)
+		if !compareVectors(p, tt.want) {
+			t.Errorf("%d) got %v want %v", i, p, tt.want)
+		}
+		if n := b.Normal(tt.u, tt.v); !compareVectors(n, tt.wantNormal) {
+			t.Errorf("%d) got normal %v want %v", i, n, tt.wantNormal)
+		}
+	}
+}
+
+func TestBezierPatchCollapsedEdge(t *testing.T) {
+	// a patch whose whole v=0 edge is at the top of a dome, y = 1 - r^2
+	var b BezierPatch
+	heights := []float32{1, 1, 2.0 / 3, 0}
+	for j := 0; j < 4; j++ {
+		for i := 0; i < 4; i++ {
+			r := float32(j) / 3
+			b[4*j+i] = Vector{r * (1 - float32(i)/3), heights[j], r * float32(i) / 3}
+		}
+	}
+	n := b.Normal(0.5, 0)
+	if n.Y < 0.99 {
+		t.Errorf("got normal %v at the top", n)
+	}
+}
+
+func TestNewBezierPatches(t *testing.T) {
+	flat := NewBezierPatches([]BezierPatch{bulgePatch(0)}, 0.01, nil).(*TriangleMesh)
+	if got := len(flat.as.GetObjects()); got != 2 {
+		t.Errorf("flat patch got %d triangles want 2", got)
+	}
+	coarse := NewBezierPatches([]BezierPatch{bulgePatch(1)}, 0.1, nil).(*TriangleMesh)
+	fine := NewBezierPatches([]BezierPatch{bulgePatch(1), bulgePatch(0)}, 0.001, nil).(*TriangleMesh)
+	nc, nf := len(coarse.as.GetObjects()), len(fine.as.GetObjects())
+	if nc >= nf/2 {
+		t.Errorf("got %d triangles at low and %d at high precision", nc, nf)
+	}
+	// both patches share a grid of n by n quads, even the flat one
+	n := 1
+	for 2*(n+1)*(n+1) < len(fine.vertices) {
+		n++
+	}
+	if 2*(n+1)*(n+1) != len(fine.vertices) || nf != 4*n*n {
+		t.Errorf("got %d vertices in %d triangles", len(fine.vertices), nf)
+	}
+	si, ok := fine.Intersect(NewRay(Vector{0.5, 2, -0.5}, Vector{0, -1, 0}))
+	if !ok || !compareFloat32(si.distance, 2-0.5625) {
+		t.Fatalf("got %v %v", si, ok)
+	}
+	for i, v := range fine.vertices {
+		uv := fine.UV[i]
+		if uv.X < 0 || uv.X > 1 || uv.Y < 0 || uv.Y > 1 || fine.Normals[i].Y <= 0 {
+			t.Errorf("got uv %v normal %v at %v", uv, fine.Normals[i], v)
+		}
+	}
+}
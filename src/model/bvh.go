@@ -214,6 +214,25 @@ type bucketInfo struct {
 
 const nBuckets int = 12
 
+// bucketsBound returns the bounds of the objects in buckets and their number.
+// Empty buckets have no bounds, which would otherwise grow it to the origin
+func bucketsBound(buckets []bucketInfo) (AABB, int) {
+	var bounds AABB
+	var count int
+	for _, b := range buckets {
+		if b.count == 0 {
+			continue
+		}
+		if count == 0 {
+			bounds = b.bounds
+		} else {
+			bounds = bounds.AddAABB(b.bounds)
+		}
+		count += b.count
+	}
+	return bounds, count
+}
+
 func Split4SurfaceAreaHeuristic(objectInfos []objectInfo, start, end int, dim Dimension, bounds, centroidBounds AABB) (int, bool) {
 	return splitSurfaceAreaHeuristic(objectInfos, start, end, dim, bounds, centroidBounds, true)
 }
@@ -254,19 +273,10 @@ func splitSurfaceAreaHeuristic(objectInfos []objectInfo, start, end int, dim Dim
 	// estimated intersection cost = 1 and traversal cost = 1/8 or 0.125
 	cost := make([]float32, nBuckets-1)
 	for i := 0; i < nBuckets-1; i++ {
-		b0 := buckets[0].bounds
-		count0 := buckets[0].count
-		for j := 1; j <= i; j++ {
-			b0 = b0.AddAABB(buckets[j].bounds)
-			count0 += buckets[j].count
-		}
-		b1 := buckets[i+1].bounds
-		count1 := buckets[i+1].count
-		for j := i + 2; j < nBuckets; j++ {
-			b1 = b1.AddAABB(buckets[j].bounds)
-			count1 += buckets[j].count
-		}
-		if count0%4 != 0 && count1%4 != 0 {
+		b0, count0 := bucketsBound(buckets[:i+1])
+		b1, count1 := bucketsBound(buckets[i+1:])
+		// the mbvh packs leaves of 4, so only splits into multiples of 4 work
+		if force4 && count0%4 != 0 && count1%4 != 0 {
 			cost[i] = math.MaxFloat32
 		} else {
 			cost[i] = 0.125 + (float32(count0)*b0.SurfaceArea()+float32(count1)*b1.SurfaceArea())/bounds.SurfaceArea()
@@ -347,12 +357,14 @@ func (bvh *BVH) ClosestIntersection(ray Ray, maxDistance float32) (*SurfaceInter
 	nodesToVisit := make([]int, 64)
 	for {
 		node := bvh.nodes[currentNodeIndex]
-		if tMin, hit := node.bounds.Intersect(ray); hit && tMin < maxDistance {
+		ray.countNode()
+		if tMin, hit := node.bounds.Intersect(ray); hit && tMin < distance {
 			if node.numObjects > 0 {
 				// this is a leaf node
+				ray.countPrimitives(node.numObjects)
 				for i := 0; i < node.numObjects; i++ {
 					o := bvh.objects[node.offset+i]
-					if si, ok := o.Intersect(ray); ok && si.distance < distance && si.distance > ERROR_MARGIN {
+					if si, ok := intersectOpaque(o, ray, distance); ok {
 						distance = si.distance
 						found = true
 						surfaceInteraction = si
@@ -435,12 +447,14 @@ func (bvh *TriangleBVH) ClosestIntersection(ray Ray, maxDistance float32) (*Surf
 	nodesToVisit := make([]int, 64)
 	for {
 		node := bvh.nodes[currentNodeIndex]
+		ray.countNode()
 		if tMin, hit := node.bounds.Intersect(ray); hit && tMin < distance {
 			if node.numObjects > 0 {
 				// this is a leaf node
+				ray.countPrimitives(node.numObjects)
 				for i := 0; i < node.numObjects; i++ {
 					t := bvh.triangles[node.offset+i]
-					if d, ok := t.IntersectOptimized(ray); ok && d < distance && d > ERROR_MARGIN {
+					if d, ok := t.IntersectOptimized(ray); ok && d < distance && d > ERROR_MARGIN && t.opaqueAt(ray, d) {
 						distance = d
 						found = true
 						triangle = t
@@ -638,7 +652,9 @@ func convertTo4mbvhLeaf(node bvhLeaf, triangles []Triangle, nodes []bvh4Node, of
 	return myOffset
 }
 
-func (n bvh4Leaf) intersect(rox, roy, roz, rdx, rdy, rdz [4]float32, d float32) (int, float32, bool) {
+// intersect returns the closest hit of the ray r, also given as simd
+// vectors, with the triangles of the leaf, stored in triangles
+func (n bvh4Leaf) intersect(rox, roy, roz, rdx, rdy, rdz [4]float32, d float32, triangles []Triangle, r Ray) (int, float32, bool) {
 	ts := simd.Triangle4Intersect(n.p0x, n.p0y, n.p0z, n.p1x, n.p1y, n.p1z, n.p2x, n.p2y, n.p2z, rox, roy, roz, rdx, rdy, rdz)
 	nOffset := 0
 	found := false
@@ -648,6 +664,9 @@ func (n bvh4Leaf) intersect(rox, roy, roz, rdx, rdy, rdz [4]float32, d float32)
 		if t == 0 || t >= distance || t <= ERROR_MARGIN {
 			continue
 		}
+		if !triangles[n.firstOffset+i].opaqueAt(r, t) {
+			continue
+		}
 		nOffset = n.firstOffset + i
 		found = true
 		distance = t
@@ -663,9 +682,11 @@ func (bvh *Triangle4BVH) ClosestIntersection(ray Ray, maxDistance float32) (*Sur
 	distance := maxDistance
 	nodesToVisit := make([]int, 64)
 	for {
+		ray.countNode()
 		switch n := bvh.nodes[currentNodeIndex].(type) {
 		case bvh4Leaf:
-			nOffset, t, ok := n.intersect(rox, roy, roz, rdx, rdy, rdz, distance)
+			ray.countPrimitives(n.numTriangles)
+			nOffset, t, ok := n.intersect(rox, roy, roz, rdx, rdy, rdz, distance, bvh.triangles, ray)
 			if ok {
 				triangle = bvh.triangles[nOffset]
 				found = true
@@ -687,7 +708,9 @@ func (bvh *Triangle4BVH) ClosestIntersection(ray Ray, maxDistance float32) (*Sur
 				child := bvh.nodes[offset]
 				switch c := child.(type) {
 				case bvh4Leaf:
-					cOffset, t, ok := c.intersect(rox, roy, roz, rdx, rdy, rdz, distance)
+					ray.countNode()
+					ray.countPrimitives(c.numTriangles)
+					cOffset, t, ok := c.intersect(rox, roy, roz, rdx, rdy, rdz, distance, bvh.triangles, ray)
 					if ok {
 						triangle = bvh.triangles[cOffset]
 						found = true
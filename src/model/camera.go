@@ -6,6 +6,9 @@ import (
 
 type Camera interface {
 	PixelRay(x, y float32) Ray
+	// RasterPosition projects a world space point back onto the film
+	// returns false if the point is not visible to the camera
+	RasterPosition(p Vector) (x, y float32, ok bool)
 	Width() int
 	Height() int
 	LookAt(from, to, up Vector)
@@ -47,6 +50,18 @@ func (c *projectiveCamera) LookAt(from, to, up Vector) {
 	}
 }
 
+func (c *projectiveCamera) RasterPosition(p Vector) (float32, float32, bool) {
+	pCamera := c.cameraToWorld.Inverse().Point(p)
+	if pCamera.Z <= 0 {
+		return 0, 0, false
+	}
+	pRaster := c.screenToRaster.Point(c.cameraToScreen.Point(pCamera))
+	if pRaster.X < 0 || pRaster.X >= float32(c.w) || pRaster.Y < 0 || pRaster.Y >= float32(c.h) {
+		return 0, 0, false
+	}
+	return pRaster.X, pRaster.Y, true
+}
+
 func (c *projectiveCamera) cameraTransforms(w, h uint) {
 	c.w, c.h = w, h
 	aspectRatio := float32(w) / float32(h)
@@ -85,6 +100,12 @@ func orthographic(zNear, zFar float32) Transform {
 func (c *OrthographicCamera) PixelRay(x, y float32) Ray {
 	pCamera := c.rasterToCamera.Point(Vector{x, y, 0})
 	r := NewRay(pCamera, Vector{0, 0, 1})
+	r.Differential = &RayDifferential{
+		RxOrigin:    c.rasterToCamera.Point(Vector{x + 1, y, 0}),
+		RyOrigin:    c.rasterToCamera.Point(Vector{x, y + 1, 0}),
+		RxDirection: r.Direction,
+		RyDirection: r.Direction,
+	}
 	return c.cameraToWorld.Ray(r)
 }
 
@@ -100,6 +121,8 @@ func NewOrthographicCamera(w, h uint) *OrthographicCamera {
 
 type PerspectiveCamera struct {
 	projectiveCamera
+	// area of the film projected onto the z=1 plane in camera space
+	imagePlaneArea float32
 }
 
 func perspective(fov, n, f float32) Transform {
@@ -116,6 +139,10 @@ func perspective(fov, n, f float32) Transform {
 func (c *PerspectiveCamera) PixelRay(x, y float32) Ray {
 	pCamera := c.rasterToCamera.Point(Vector{x, y, 0})
 	r := NewRay(Vector{0, 0, 0}, pCamera)
+	r.Differential = &RayDifferential{
+		RxDirection: c.rasterToCamera.Point(Vector{x + 1, y, 0}).Normalize(),
+		RyDirection: c.rasterToCamera.Point(Vector{x, y + 1, 0}).Normalize(),
+	}
 	return c.cameraToWorld.Ray(r)
 }
 
@@ -126,5 +153,29 @@ func NewPerspectiveCamera(w, h uint, fov float32) *PerspectiveCamera {
 		},
 	}
 	c.cameraTransforms(w, h)
+	pMin := c.rasterToCamera.Point(Vector{0, 0, 0})
+	pMax := c.rasterToCamera.Point(Vector{float32(w), float32(h), 0})
+	pMin = pMin.Times(1 / pMin.Z)
+	pMax = pMax.Times(1 / pMax.Z)
+	c.imagePlaneArea = float32(math.Abs(float64((pMax.X - pMin.X) * (pMax.Y - pMin.Y))))
 	return c
 }
+
+func (c *PerspectiveCamera) position() Vector {
+	return c.cameraToWorld.Point(Vector{0, 0, 0})
+}
+
+// importance emitted by a pinhole camera along direction w and the pdf
+// (over solid angle) of PixelRay sampling that direction: pbrt 949
+func (c *PerspectiveCamera) importance(w Vector) (we, pdf float32) {
+	cos := c.cameraToWorld.Vector(Vector{0, 0, 1}).Normalize().Dot(w)
+	if cos <= 0 {
+		return 0, 0
+	}
+	if _, _, ok := c.RasterPosition(c.position().Add(w)); !ok {
+		return 0, 0
+	}
+	cos2 := cos * cos
+	pdf = 1 / (c.imagePlaneArea * cos2 * cos)
+	return pdf / cos, pdf
+}
@@ -48,3 +48,24 @@ func TestCameraPixelRay(t *testing.T) {
 		}
 	}
 }
+
+func TestCameraRayDifferentials(t *testing.T) {
+	for i, c := range []Camera{
+		NewPerspectiveCamera(100, 80, 0.5*math.Pi),
+		NewOrthographicCamera(100, 80),
+	} {
+		c.LookAt(Vector{1, 2, 3}, Vector{0, 0, 0}, Vector{0, 1, 0})
+		got := c.PixelRay(10.5, 20.5)
+		if got.Differential == nil {
+			t.Fatalf("%d) got no differentials", i)
+		}
+		rx, ry := c.PixelRay(11.5, 20.5), c.PixelRay(10.5, 21.5)
+		d := got.Differential
+		if !compareVectors(d.RxOrigin, rx.Origin) || !compareVectors(d.RxDirection, rx.Direction) {
+			t.Errorf("%d) got x differential %v %v want %v %v", i, d.RxOrigin, d.RxDirection, rx.Origin, rx.Direction)
+		}
+		if !compareVectors(d.RyOrigin, ry.Origin) || !compareVectors(d.RyDirection, ry.Direction) {
+			t.Errorf("%d) got y differential %v %v want %v %v", i, d.RyOrigin, d.RyDirection, ry.Origin, ry.Direction)
+		}
+	}
+}
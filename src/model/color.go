@@ -36,6 +36,23 @@ func (c Color) Product(d Color) Color {
 	}
 }
 
+// relative luminance using ITU-R BT.709 weights
+func (c Color) Luminance() float32 {
+	return 0.2126*c.r + 0.7152*c.g + 0.0722*c.b
+}
+
+// largest of the three channels, used for russian roulette
+func (c Color) MaxComponent() float32 {
+	max := c.r
+	if c.g > max {
+		max = c.g
+	}
+	if c.b > max {
+		max = c.b
+	}
+	return max
+}
+
 func float32touint8(f float32) uint8 {
 	if f < 0 {
 		return 0
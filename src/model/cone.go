@@ -0,0 +1,56 @@
+package model
+
+// A Cone with its base of Radius at z=0 and its apex at Height on the z
+// axis, swept up to PhiMax radians around the axis: pbrt 150
+type Cone struct {
+	shape
+	Height float32
+	Radius float32
+	PhiMax float64
+}
+
+func NewCone(toWorld Transform, height, radius float32, phiMax float64, m Material) Cone {
+	return Cone{
+		shape:  newShape(toWorld, m),
+		Height: height,
+		Radius: radius,
+		PhiMax: clampPhiMax(phiMax),
+	}
+}
+
+func (c Cone) Bound(t Transform) AABB {
+	return c.bound(t, Vector{-c.Radius, -c.Radius, 0}, Vector{c.Radius, c.Radius, c.Height})
+}
+
+func (c Cone) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	l := c.worldToObject.Ray(r)
+	ox, oy, oz := float64(l.Origin.X), float64(l.Origin.Y), float64(l.Origin.Z)
+	dx, dy, dz := float64(l.Direction.X), float64(l.Direction.Y), float64(l.Direction.Z)
+	k := float64(c.Radius / c.Height)
+	k = k * k
+	h := float64(c.Height)
+	a := dx*dx + dy*dy - k*dz*dz
+	b := 2 * (dx*ox + dy*oy - k*dz*(oz-h))
+	q := ox*ox + oy*oy - k*(oz-h)*(oz-h)
+	return c.hit(c, r, l, quadratic(a, b, q), c.inside, c.normal)
+}
+
+func (c Cone) inside(p Vector) bool {
+	return p.Z >= 0 && p.Z <= c.Height && phi(p) <= c.PhiMax
+}
+
+// the gradient of x^2 + y^2 - (r/h)^2 (z-h)^2
+func (c Cone) normal(p Vector) Vector {
+	k := c.Radius / c.Height
+	return Vector{p.X, p.Y, -k * k * (p.Z - c.Height)}
+}
+
+func (c Cone) SurfaceNormal(p Vector) Vector {
+	return c.surfaceNormal(p, c.normal)
+}
+
+// u goes around the axis, v from the base to the apex
+func (c Cone) UV(p Vector) Vector {
+	o := c.worldToObject.Point(p)
+	return Vector{float32(phi(o) / c.PhiMax), o.Z / c.Height, 0}
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConeIntersect(t *testing.T) {
+	for i, tt := range []struct {
+		c         Cone
+		r         Ray
+		want      float32
+		wantTruth bool
+	}{
+		{
+			c:         NewCone(ScaleUniform(1), 2, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 0}, Vector{-1, 0, 0}),
+			want:      4.0,
+			wantTruth: true,
+		},
+		{
+			c:         NewCone(ScaleUniform(1), 2, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 1}, Vector{-1, 0, 0}),
+			want:      4.5,
+			wantTruth: true,
+		},
+		{
+			// misses the mirrored cone above the apex
+			c:         NewCone(ScaleUniform(1), 2, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 3}, Vector{-1, 0, 0}),
+			wantTruth: false,
+		},
+		{
+			c:         NewCone(ScaleUniform(1), 2, 1, math.Pi, nil),
+			r:         NewRay(Vector{0, -5, 1}, Vector{0, 1, 0}),
+			want:      5.5,
+			wantTruth: true,
+		},
+	} {
+		got, found := tt.c.Intersect(tt.r)
+		if !found && tt.wantTruth == false {
+			continue
+		}
+		if (!found && tt.wantTruth == true) || (found && tt.wantTruth == false) {
+			t.Errorf("%d) incorrect bool value; want %v", i, tt.wantTruth)
+			continue
+		}
+		if !compareFloat32(got.distance, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got.distance, tt.want)
+		}
+	}
+}
+
+func TestConeSurfaceNormal(t *testing.T) {
+	for i, tt := range []struct {
+		c    Cone
+		v    Vector
+		want Vector
+	}{
+		{
+			c:    NewCone(ScaleUniform(1), 2, 1, 2*math.Pi, nil),
+			v:    Vector{0.5, 0, 1},
+			want: Vector{0.8944272, 0, 0.4472136},
+		},
+		{
+			c:    NewCone(Translate(Vector{0, 0, 1}), 1, 1, 2*math.Pi, nil),
+			v:    Vector{0, -0.5, 1.5},
+			want: Vector{0, -0.70710678, 0.70710678},
+		},
+	} {
+		got := tt.c.SurfaceNormal(tt.v)
+		if !compareVectors(got, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package model
+
+import "math/rand"
+
+// A Solid is a closed object that can report every range along a ray that
+// lies inside it, not just the closest hit. Solids can be combined by CSG
+type Solid interface {
+	Object
+	// Intervals returns the sorted, disjoint ranges along the whole line
+	// through ray that are inside the solid, including those behind its
+	// origin so that rays starting inside a solid know they are
+	Intervals(ray Ray) []Interval
+}
+
+// an Interval is the range along a ray between entering and leaving a solid.
+// The normals of both surface interactions point out of the solid
+type Interval struct {
+	In, Out *SurfaceInteraction
+}
+
+// firstBoundary returns the first surface in front of the ray
+func firstBoundary(intervals []Interval) (*SurfaceInteraction, bool) {
+	for _, i := range intervals {
+		if i.In.distance > ERROR_MARGIN {
+			return i.In, true
+		}
+		if i.Out.distance > ERROR_MARGIN {
+			return i.Out, true
+		}
+	}
+	return nil, false
+}
+
+type CSGOperation int
+
+const (
+	CSGUnion CSGOperation = iota
+	CSGIntersection
+	CSGDifference
+)
+
+// CSG combines two solids into a new one using boolean operations.
+// Surfaces keep the material of the solid they belong to, so the walls
+// cut out by a difference take that of the right solid
+type CSG struct {
+	Operation   CSGOperation
+	Left, Right Solid
+}
+
+func NewCSG(op CSGOperation, left, right Solid) *CSG {
+	return &CSG{
+		Operation: op,
+		Left:      left,
+		Right:     right,
+	}
+}
+
+func (c *CSG) Intersect(ray Ray) (*SurfaceInteraction, bool) {
+	return firstBoundary(c.Intervals(ray))
+}
+
+func (c *CSG) Intervals(ray Ray) []Interval {
+	left := c.Left.Intervals(ray)
+	if len(left) == 0 && c.Operation != CSGUnion {
+		return nil
+	}
+	right := c.Right.Intervals(ray)
+	switch c.Operation {
+	case CSGUnion:
+		return combineIntervals(left, right, func(l, r bool) bool { return l || r })
+	case CSGIntersection:
+		return combineIntervals(left, right, func(l, r bool) bool { return l && r })
+	}
+	// leaving the right solid enters the difference, so its normals flip
+	for _, i := range right {
+		for _, si := range []*SurfaceInteraction{i.In, i.Out} {
+			si.normal = si.normal.Times(-1)
+			si.UntransformedNormal = si.UntransformedNormal.Times(-1)
+		}
+	}
+	return combineIntervals(left, right, func(l, r bool) bool { return l && !r })
+}
+
+// combineIntervals walks the boundaries of both sets of intervals in order,
+// keeping track of being inside either, and returns the ranges for which
+// inside returns true
+func combineIntervals(left, right []Interval, inside func(l, r bool) bool) []Interval {
+	var out []Interval
+	var inLeft, inRight, in bool
+	var enter *SurfaceInteraction
+	// boundaries alternate between entering and leaving
+	i, j := 0, 0
+	for i < 2*len(left) || j < 2*len(right) {
+		var si *SurfaceInteraction
+		if j == 2*len(right) || (i < 2*len(left) && boundary(left, i).distance <= boundary(right, j).distance) {
+			si = boundary(left, i)
+			inLeft = !inLeft
+			i++
+		} else {
+			si = boundary(right, j)
+			inRight = !inRight
+			j++
+		}
+		now := inside(inLeft, inRight)
+		if now == in {
+			continue
+		}
+		in = now
+		if in {
+			enter = si
+			continue
+		}
+		// coinciding surfaces leave slivers thinner than we can resolve
+		if si.distance-enter.distance > ERROR_MARGIN {
+			out = append(out, Interval{In: enter, Out: si})
+		}
+	}
+	return out
+}
+
+func boundary(intervals []Interval, i int) *SurfaceInteraction {
+	if i%2 == 0 {
+		return intervals[i/2].In
+	}
+	return intervals[i/2].Out
+}
+
+func (c *CSG) SurfaceNormal(Vector) Vector {
+	panic("Dont call this function!")
+}
+
+func (c *CSG) GetColor(*SurfaceInteraction) Color {
+	panic("Dont call this function!")
+}
+
+func (c *CSG) GetMaterial() Material {
+	panic("Dont call this function!")
+}
+
+func (c *CSG) SampleDirection(r *rand.Rand, normal Vector) Vector {
+	panic("Dont call this function!")
+}
+
+func (c *CSG) IsLight() bool {
+	panic("Dont call this function!")
+}
+
+func (c *CSG) Bound(t Transform) AABB {
+	left := c.Left.Bound(t)
+	switch c.Operation {
+	case CSGUnion:
+		return left.AddAABB(c.Right.Bound(t))
+	case CSGIntersection:
+		right := c.Right.Bound(t)
+		min := VectorMax(left.Pmin, right.Pmin)
+		max := VectorMin(left.Pmax, right.Pmax)
+		// disjoint solids intersect in nothing; keep a valid box
+		if min.X > max.X || min.Y > max.Y || min.Z > max.Z {
+			return NewAABB(min, min)
+		}
+		return AABB{Pmin: min, Pmax: max}
+	}
+	return left
+}
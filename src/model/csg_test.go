@@ -0,0 +1,125 @@
+package model
+
+import "testing"
+
+func TestCSGIntersect(t *testing.T) {
+	left := NewSphere(Vector{-1, 0, 0}, 1.5, nil)
+	right := NewSphere(Vector{1, 0, 0}, 1.5, nil)
+	box := NewCuboid(NewAABB(Vector{-1, -1, -1}, Vector{1, 1, 1}), nil)
+	hollow := NewSharedObject(NewCSG(CSGDifference, box, NewSphere(Vector{0, 0, 0}, 1.2, nil)), Translate(Vector{0, 10, 0}))
+	for i, tt := range []struct {
+		o          Object
+		r          Ray
+		want       float32
+		wantNormal Vector
+		wantTruth  bool
+	}{
+		{
+			o:          NewCSG(CSGUnion, left, right),
+			r:          NewRay(Vector{-5, 0, 0}, Vector{1, 0, 0}),
+			want:       2.5,
+			wantNormal: Vector{-1, 0, 0},
+			wantTruth:  true,
+		},
+		{
+			// the inner wall of the union is skipped
+			o:          NewCSG(CSGUnion, left, right),
+			r:          NewRay(Vector{0, 0, 0}, Vector{1, 0, 0}),
+			want:       2.5,
+			wantNormal: Vector{1, 0, 0},
+			wantTruth:  true,
+		},
+		{
+			o:          NewCSG(CSGIntersection, left, right),
+			r:          NewRay(Vector{-5, 0, 0}, Vector{1, 0, 0}),
+			want:       4.5,
+			wantNormal: Vector{-1, 0, 0},
+			wantTruth:  true,
+		},
+		{
+			o:         NewCSG(CSGIntersection, left, right),
+			r:         NewRay(Vector{-1, 0, 5}, Vector{0, 0, -1}),
+			wantTruth: false,
+		},
+		{
+			o:         NewCSG(CSGDifference, left, right),
+			r:         NewRay(Vector{0, 0, 5}, Vector{0, 0, -1}),
+			wantTruth: false,
+		},
+		{
+			o:          NewCSG(CSGDifference, left, right),
+			r:          NewRay(Vector{-1, 0, 5}, Vector{0, 0, -1}),
+			want:       3.5,
+			wantNormal: Vector{0, 0, 1},
+			wantTruth:  true,
+		},
+		{
+			// hits the wall cut out by the right sphere, facing the ray
+			o:          NewCSG(CSGDifference, left, right),
+			r:          NewRay(Vector{5, 0, 0}, Vector{-1, 0, 0}),
+			want:       5.5,
+			wantNormal: Vector{1, 0, 0},
+			wantTruth:  true,
+		},
+		{
+			o:          NewCSG(CSGUnion, NewCSG(CSGDifference, left, right), box),
+			r:          NewRay(Vector{5, 0, 0}, Vector{-1, 0, 0}),
+			want:       4,
+			wantNormal: Vector{1, 0, 0},
+			wantTruth:  true,
+		},
+		{
+			// a box hollowed out by a sphere, placed by a shared object
+			o:         hollow,
+			r:         NewRay(Vector{0, 10, 5}, Vector{0, 0, -1}),
+			wantTruth: false,
+		},
+		{
+			o:          hollow,
+			r:          NewRay(Vector{0.9, 10.9, 5}, Vector{0, 0, -1}),
+			want:       4,
+			wantNormal: Vector{0, 0, 1},
+			wantTruth:  true,
+		},
+		{
+			o:          NewCSG(CSGIntersection, hollow.(Solid), NewSphere(Vector{0, 10, 0}, 10, nil)),
+			r:          NewRay(Vector{0.9, 10.9, -5}, Vector{0, 0, 1}),
+			want:       4,
+			wantNormal: Vector{0, 0, -1},
+			wantTruth:  true,
+		},
+	} {
+		got, found := tt.o.Intersect(tt.r)
+		if !found && tt.wantTruth == false {
+			continue
+		}
+		if (!found && tt.wantTruth == true) || (found && tt.wantTruth == false) {
+			t.Errorf("%d) incorrect bool value; want %v", i, tt.wantTruth)
+			continue
+		}
+		if !compareFloat32(got.distance, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got.distance, tt.want)
+		}
+		if !compareVectors(got.normal, tt.wantNormal) {
+			t.Errorf("%d) got normal %v want %v", i, got.normal, tt.wantNormal)
+		}
+	}
+}
+
+func TestCSGBound(t *testing.T) {
+	left := NewSphere(Vector{-1, 0, 0}, 1.5, nil)
+	right := NewSphere(Vector{1, 0, 0}, 1.5, nil)
+	for i, tt := range []struct {
+		op   CSGOperation
+		want AABB
+	}{
+		{op: CSGUnion, want: NewAABB(Vector{-2.5, -1.5, -1.5}, Vector{2.5, 1.5, 1.5})},
+		{op: CSGIntersection, want: NewAABB(Vector{-0.5, -1.5, -1.5}, Vector{0.5, 1.5, 1.5})},
+		{op: CSGDifference, want: NewAABB(Vector{-2.5, -1.5, -1.5}, Vector{0.5, 1.5, 1.5})},
+	} {
+		got := NewCSG(tt.op, left, right).Bound(ScaleUniform(1))
+		if !compareVectors(got.Pmin, tt.want.Pmin) || !compareVectors(got.Pmax, tt.want.Pmax) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
@@ -31,13 +31,35 @@ func (b AABB) AddAABB(b2 AABB) AABB {
 	}
 }
 
+// Transform returns the box bounding all corners of b transformed by t
+func (b AABB) Transform(t Transform) AABB {
+	bound := NewAABB(t.Point(b.Pmin), t.Point(b.Pmax))
+	for _, p := range []Vector{
+		{b.Pmin.X, b.Pmin.Y, b.Pmax.Z},
+		{b.Pmin.X, b.Pmax.Y, b.Pmin.Z},
+		{b.Pmin.X, b.Pmax.Y, b.Pmax.Z},
+		{b.Pmax.X, b.Pmin.Y, b.Pmin.Z},
+		{b.Pmax.X, b.Pmin.Y, b.Pmax.Z},
+		{b.Pmax.X, b.Pmax.Y, b.Pmin.Z},
+	} {
+		bound = bound.AddPoint(t.Point(p))
+	}
+	return bound
+}
+
 func (b AABB) Centroid() Vector {
 	return b.Pmin.Add(b.Pmax).Times(0.5)
 }
 
 func (b AABB) Intersect(ray Ray) (tMin float32, hit bool) {
-	var t0 float32 = 0.0
-	var t1 float32 = math.MaxFloat32
+	t0, _, hit := b.intersectRange(ray)
+	return t0, hit
+}
+
+// intersectRange returns the parametric range [t0, t1] of ray inside b
+func (b AABB) intersectRange(ray Ray) (t0, t1 float32, hit bool) {
+	t0 = 0.0
+	t1 = math.MaxFloat32
 	invRayDirs := [3]float32{1.0 / ray.Direction.X, 1.0 / ray.Direction.Y, 1.0 / ray.Direction.Z}
 	rayOrigins := [3]float32{ray.Origin.X, ray.Origin.Y, ray.Origin.Z}
 	bPmins := [3]float32{b.Pmin.X, b.Pmin.Y, b.Pmin.Z}
@@ -57,10 +79,10 @@ func (b AABB) Intersect(ray Ray) (tMin float32, hit bool) {
 			t1 = tFar
 		}
 		if t0 > t1 {
-			return 0, false
+			return 0, 0, false
 		}
 	}
-	return t0, true
+	return t0, t1, true
 }
 
 func (b AABB) SurfaceArea() float32 {
@@ -112,15 +134,83 @@ func boundsToSimd(b1, b2, b3, b4 AABB) ([4]float32, [4]float32, [4]float32, [4]f
 
 // any cuboid is just an axis-aligned box with a rotation
 type Cuboid struct {
-	cuboid   AABB
-	material Material
+	object
+	cuboid AABB
 }
 
 func NewCuboid(aabb AABB, m Material) Cuboid {
 	return Cuboid{
-		cuboid:   aabb,
-		material: m,
+		object: object{m},
+		cuboid: aabb,
+	}
+}
+
+func (c Cuboid) Bound(t Transform) AABB {
+	return c.cuboid.Transform(t)
+}
+
+func (c Cuboid) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	return firstBoundary(c.Intervals(r))
+}
+
+// Intervals returns the range between the slabs of the box: pbrt 127
+func (c Cuboid) Intervals(r Ray) []Interval {
+	t0, t1 := float32(math.Inf(-1)), float32(math.Inf(1))
+	var n0, n1 [3]float32
+	for _, d := range Dimensions {
+		o, dir := r.Origin.Get(d), r.Direction.Get(d)
+		min, max := c.cuboid.Pmin.Get(d), c.cuboid.Pmax.Get(d)
+		if dir == 0 {
+			if o < min || o > max {
+				return nil
+			}
+			continue
+		}
+		tNear, tFar := (min-o)/dir, (max-o)/dir
+		// the normal points against the ray where it enters
+		sign := float32(-1)
+		if tNear > tFar {
+			tNear, tFar = tFar, tNear
+			sign = 1
+		}
+		if tNear > t0 {
+			t0 = tNear
+			n0 = [3]float32{}
+			n0[d] = sign
+		}
+		if tFar < t1 {
+			t1 = tFar
+			n1 = [3]float32{}
+			n1[d] = -sign
+		}
+	}
+	// rays skimming an edge or corner are ignored
+	if t0 >= t1 {
+		return nil
+	}
+	return []Interval{{
+		In:  NewSurfaceInteraction(c, t0, Vector{n0[0], n0[1], n0[2]}, r),
+		Out: NewSurfaceInteraction(c, t1, Vector{n1[0], n1[1], n1[2]}, r),
+	}}
+}
+
+// the normal of the face closest to p
+func (c Cuboid) SurfaceNormal(p Vector) Vector {
+	var n [3]float32
+	closest := float32(math.Inf(1))
+	for _, d := range Dimensions {
+		if dist := float32(math.Abs(float64(p.Get(d) - c.cuboid.Pmin.Get(d)))); dist < closest {
+			closest = dist
+			n = [3]float32{}
+			n[d] = -1
+		}
+		if dist := float32(math.Abs(float64(p.Get(d) - c.cuboid.Pmax.Get(d)))); dist < closest {
+			closest = dist
+			n = [3]float32{}
+			n[d] = 1
+		}
 	}
+	return Vector{n[0], n[1], n[2]}
 }
 
 // Builds on quadrilateral definition:
@@ -143,12 +233,12 @@ func (c Cuboid) Tesselate() []Triangle {
 	p8 := Vector{pmin.X, pmin.Y, pmin.Z}
 
 	triangles := make([]Triangle, 12)
-	triangles[0], triangles[1] = QuadrilateralToTriangles(p1, p2, p3, p4, c.material)
-	triangles[2], triangles[3] = QuadrilateralToTriangles(p2, p1, p5, p6, c.material)
-	triangles[4], triangles[5] = QuadrilateralToTriangles(p3, p2, p6, p7, c.material)
-	triangles[6], triangles[7] = QuadrilateralToTriangles(p4, p3, p7, p8, c.material)
-	triangles[8], triangles[9] = QuadrilateralToTriangles(p1, p4, p8, p5, c.material)
-	triangles[10], triangles[11] = QuadrilateralToTriangles(p6, p5, p8, p7, c.material)
+	triangles[0], triangles[1] = QuadrilateralToTriangles(p1, p2, p3, p4, c.Material)
+	triangles[2], triangles[3] = QuadrilateralToTriangles(p2, p1, p5, p6, c.Material)
+	triangles[4], triangles[5] = QuadrilateralToTriangles(p3, p2, p6, p7, c.Material)
+	triangles[6], triangles[7] = QuadrilateralToTriangles(p4, p3, p7, p8, c.Material)
+	triangles[8], triangles[9] = QuadrilateralToTriangles(p1, p4, p8, p5, c.Material)
+	triangles[10], triangles[11] = QuadrilateralToTriangles(p6, p5, p8, p7, c.Material)
 	return triangles
 }
 
@@ -167,12 +257,12 @@ func (c Cuboid) TesselateInsideOut() []Triangle {
 	p8 := Vector{pmin.X, pmin.Y, pmin.Z}
 
 	triangles := make([]Triangle, 12)
-	triangles[0], triangles[1] = QuadrilateralToTriangles(p4, p3, p2, p1, c.material)
-	triangles[2], triangles[3] = QuadrilateralToTriangles(p6, p5, p1, p2, c.material)
-	triangles[4], triangles[5] = QuadrilateralToTriangles(p7, p6, p2, p3, c.material)
-	triangles[6], triangles[7] = QuadrilateralToTriangles(p8, p7, p3, p4, c.material)
-	triangles[8], triangles[9] = QuadrilateralToTriangles(p5, p8, p4, p1, c.material)
-	triangles[10], triangles[11] = QuadrilateralToTriangles(p7, p8, p5, p6, c.material)
+	triangles[0], triangles[1] = QuadrilateralToTriangles(p4, p3, p2, p1, c.Material)
+	triangles[2], triangles[3] = QuadrilateralToTriangles(p6, p5, p1, p2, c.Material)
+	triangles[4], triangles[5] = QuadrilateralToTriangles(p7, p6, p2, p3, c.Material)
+	triangles[6], triangles[7] = QuadrilateralToTriangles(p8, p7, p3, p4, c.Material)
+	triangles[8], triangles[9] = QuadrilateralToTriangles(p5, p8, p4, p1, c.Material)
+	triangles[10], triangles[11] = QuadrilateralToTriangles(p7, p8, p5, p6, c.Material)
 	return triangles
 }
 
@@ -139,3 +139,51 @@ func TestAABBRayIntersect(t *testing.T) {
 		}
 	}
 }
+
+func TestCuboidIntervals(t *testing.T) {
+	c := NewCuboid(NewAABB(Vector{-1, -1, -1}, Vector{1, 2, 1}), nil)
+	for i, tt := range []struct {
+		r               Ray
+		wantIn, wantOut float32
+		wantInNormal    Vector
+		wantOutNormal   Vector
+		wantTruth       bool
+	}{
+		{
+			r:             NewRay(Vector{-5, 0, 0}, Vector{1, 0, 0}),
+			wantIn:        4,
+			wantOut:       6,
+			wantInNormal:  Vector{-1, 0, 0},
+			wantOutNormal: Vector{1, 0, 0},
+			wantTruth:     true,
+		},
+		{
+			// intervals include the part behind the ray
+			r:             NewRay(Vector{0, 0, 0}, Vector{0, 1, 0}),
+			wantIn:        -1,
+			wantOut:       2,
+			wantInNormal:  Vector{0, -1, 0},
+			wantOutNormal: Vector{0, 1, 0},
+			wantTruth:     true,
+		},
+		{
+			r:         NewRay(Vector{-5, 3, 0}, Vector{1, 0, 0}),
+			wantTruth: false,
+		},
+	} {
+		got := c.Intervals(tt.r)
+		if len(got) == 0 && !tt.wantTruth {
+			continue
+		}
+		if len(got) != 1 || !tt.wantTruth {
+			t.Errorf("%d) got %d intervals", i, len(got))
+			continue
+		}
+		if !compareFloat32(got[0].In.distance, tt.wantIn) || !compareFloat32(got[0].Out.distance, tt.wantOut) {
+			t.Errorf("%d) got [%v, %v] want [%v, %v]", i, got[0].In.distance, got[0].Out.distance, tt.wantIn, tt.wantOut)
+		}
+		if !compareVectors(got[0].In.normal, tt.wantInNormal) || !compareVectors(got[0].Out.normal, tt.wantOutNormal) {
+			t.Errorf("%d) got normals %v, %v want %v, %v", i, got[0].In.normal, got[0].Out.normal, tt.wantInNormal, tt.wantOutNormal)
+		}
+	}
+}
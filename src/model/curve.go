@@ -0,0 +1,276 @@
+package model
+
+import "math"
+
+// curves are split in 2^CURVE_SPLIT_DEPTH segments, each a separate object
+// so that acceleration structures can bound them tightly
+const CURVE_SPLIT_DEPTH = 3
+
+type CurveType int
+
+const (
+	// a flat strip that always faces the ray, for thin hair and fur
+	CurveFlat CurveType = iota
+	// a flat strip facing the ray but shaded as a tube
+	CurveCylinder
+	// a strip turned by the normals at its ends, for blades of grass
+	CurveRibbon
+)
+
+// curveCommon is shared by all segments of a curve
+type curveCommon struct {
+	object
+	curveType   CurveType
+	cp          [4]Vector
+	width       [2]float32
+	normals     [2]Vector
+	normalAngle float64
+}
+
+// A Curve is the segment between uMin and uMax of a cubic Bezier strand
+// whose width goes linearly from one end to the other: pbrt 3.7
+type Curve struct {
+	*curveCommon
+	uMin, uMax float32
+	// control points of the segment
+	segment [4]Vector
+}
+
+// NewCurve returns the segments of the strand through control points cp,
+// width0 wide at its start and width1 at its end
+func NewCurve(curveType CurveType, cp [4]Vector, width0, width1 float32, m Material) []Object {
+	if curveType == CurveRibbon {
+		panic("ribbons need normals, use NewRibbon")
+	}
+	return newCurveSegments(&curveCommon{
+		object:    object{m},
+		curveType: curveType,
+		cp:        cp,
+		width:     [2]float32{width0, width1},
+	})
+}
+
+// NewRibbon returns the segments of a strand that is flat along the
+// normals n0 at its start and n1 at its end, and turns in between
+func NewRibbon(cp [4]Vector, width0, width1 float32, n0, n1 Vector, m Material) []Object {
+	n0, n1 = n0.Normalize(), n1.Normalize()
+	return newCurveSegments(&curveCommon{
+		object:      object{m},
+		curveType:   CurveRibbon,
+		cp:          cp,
+		width:       [2]float32{width0, width1},
+		normals:     [2]Vector{n0, n1},
+		normalAngle: math.Acos(float64(clampf(n0.Dot(n1), -1, 1))),
+	})
+}
+
+func newCurveSegments(common *curveCommon) []Object {
+	n := 1 << CURVE_SPLIT_DEPTH
+	segments := make([]Object, n)
+	for i := range segments {
+		u0, u1 := float32(i)/float32(n), float32(i+1)/float32(n)
+		segments[i] = Curve{
+			curveCommon: common,
+			uMin:        u0,
+			uMax:        u1,
+			segment: [4]Vector{
+				blossom(common.cp, u0, u0, u0),
+				blossom(common.cp, u0, u0, u1),
+				blossom(common.cp, u0, u1, u1),
+				blossom(common.cp, u1, u1, u1),
+			},
+		}
+	}
+	return segments
+}
+
+// blossom of the curve, which gives the control points of the part
+// between u0 and u1 as blossom(u0,u0,u0), blossom(u0,u0,u1), and so on
+func blossom(cp [4]Vector, u0, u1, u2 float32) Vector {
+	a := [3]Vector{lerpVector(cp[0], cp[1], u0), lerpVector(cp[1], cp[2], u0), lerpVector(cp[2], cp[3], u0)}
+	b := [2]Vector{lerpVector(a[0], a[1], u1), lerpVector(a[1], a[2], u1)}
+	return lerpVector(b[0], b[1], u2)
+}
+
+// subdivideBezier splits a cubic Bezier curve in two halves, sharing the
+// middle control point
+func subdivideBezier(cp [4]Vector) [7]Vector {
+	return [7]Vector{
+		cp[0],
+		cp[0].Add(cp[1]).Times(0.5),
+		cp[0].Add(cp[1].Times(2)).Add(cp[2]).Times(0.25),
+		cp[0].Add(cp[1].Times(3)).Add(cp[2].Times(3)).Add(cp[3]).Times(0.125),
+		cp[1].Add(cp[2].Times(2)).Add(cp[3]).Times(0.25),
+		cp[2].Add(cp[3]).Times(0.5),
+		cp[3],
+	}
+}
+
+func (c Curve) widthAt(u float32) float32 {
+	return mixf(c.width[0], c.width[1], u)
+}
+
+// ribbonNormal spherically interpolates between the normals at the ends
+func (c Curve) ribbonNormal(u float32) Vector {
+	if c.normalAngle < 1e-4 {
+		return lerpVector(c.normals[0], c.normals[1], u).Normalize()
+	}
+	s := math.Sin(c.normalAngle)
+	s0 := float32(math.Sin((1-float64(u))*c.normalAngle) / s)
+	s1 := float32(math.Sin(float64(u)*c.normalAngle) / s)
+	return c.normals[0].Times(s0).Add(c.normals[1].Times(s1))
+}
+
+func (c Curve) Bound(t Transform) AABB {
+	min, max := c.segment[0], c.segment[0]
+	for _, p := range c.segment[1:] {
+		min, max = VectorMin(min, p), VectorMax(max, p)
+	}
+	// the curve lies within the convex hull of its control points
+	w := maxf(c.widthAt(c.uMin), c.widthAt(c.uMax)) / 2
+	r := Vector{w, w, w}
+	return NewAABB(min.Sub(r), max.Add(r)).Transform(t)
+}
+
+// curveHit is the closest hit found so far, as a distance along the ray
+// and the curve parameter
+type curveHit struct {
+	z, u float32
+	ok   bool
+}
+
+// Intersect projects the segment onto a plane perpendicular to the ray,
+// with the ray running along z from the origin, and splits it recursively
+// until the parts are close enough to straight: pbrt 3.7.3
+func (c Curve) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	length := r.Direction.Length()
+	dz := r.Direction.Times(1 / length)
+	dx, dy := coordinateSystem(dz)
+	var cp [4]Vector
+	for i, p := range c.segment {
+		o := VectorFromTo(r.Origin, p)
+		cp[i] = Vector{o.Dot(dx), o.Dot(dy), o.Dot(dz)}
+	}
+	hit := curveHit{z: MAX_RAY_DISTANCE * length}
+	zMin := ERROR_MARGIN * length
+	// most rays that hit the bounds of the segment pass it by
+	if !c.overlaps(cp, zMin, c.uMin, c.uMax, hit.z) {
+		return nil, false
+	}
+	// split until the parts are straight to within a twentieth of the width
+	var l0 float32
+	for i := 0; i < 2; i++ {
+		d := cp[i].Sub(cp[i+1].Times(2)).Add(cp[i+2])
+		l0 = maxf(l0, maxf(absf(d.X), maxf(absf(d.Y), absf(d.Z))))
+	}
+	eps := float64(maxf(c.width[0], c.width[1])) * 0.05
+	depth := 0
+	if l0 > 0 && eps > 0 {
+		r0 := math.Log2(math.Sqrt2*6*float64(l0)/(8*eps)) / 2
+		depth = clampInt(int(math.Round(r0)), 0, 10)
+	}
+	c.recursiveIntersect(cp, dz, zMin, c.uMin, c.uMax, depth, &hit)
+	if !hit.ok {
+		return nil, false
+	}
+	d := hit.z / length
+	return NewSurfaceInteraction(c, d, c.normal(dz, hit.u, PointFromRay(r, d)), r), true
+}
+
+func (c Curve) recursiveIntersect(cp [4]Vector, dz Vector, zMin, u0, u1 float32, depth int, hit *curveHit) {
+	if depth == 0 {
+		c.intersectSegment(cp, dz, zMin, u0, u1, hit)
+		return
+	}
+	split := subdivideBezier(cp)
+	for i := 0; i < 2; i++ {
+		half := [4]Vector{split[3*i], split[3*i+1], split[3*i+2], split[3*i+3]}
+		v0, v1 := mixf(u0, u1, 0.5*float32(i)), mixf(u0, u1, 0.5*float32(i+1))
+		if c.overlaps(half, zMin, v0, v1, hit.z) {
+			c.recursiveIntersect(half, dz, zMin, v0, v1, depth-1, hit)
+		}
+	}
+}
+
+// overlaps tests whether the bounds of the part of the curve from u0 to
+// u1 in ray space overlap the ray between zMin and zMax
+func (c Curve) overlaps(cp [4]Vector, zMin, u0, u1, zMax float32) bool {
+	minX, maxX := minf(minf(cp[0].X, cp[1].X), minf(cp[2].X, cp[3].X)), maxf(maxf(cp[0].X, cp[1].X), maxf(cp[2].X, cp[3].X))
+	minY, maxY := minf(minf(cp[0].Y, cp[1].Y), minf(cp[2].Y, cp[3].Y)), maxf(maxf(cp[0].Y, cp[1].Y), maxf(cp[2].Y, cp[3].Y))
+	minZ, maxZ := minf(minf(cp[0].Z, cp[1].Z), minf(cp[2].Z, cp[3].Z)), maxf(maxf(cp[0].Z, cp[1].Z), maxf(cp[2].Z, cp[3].Z))
+	w := maxf(c.widthAt(u0), c.widthAt(u1)) / 2
+	return maxX+w >= 0 && minX-w <= 0 && maxY+w >= 0 && minY-w <= 0 && maxZ+w >= zMin && minZ-w <= zMax
+}
+
+// intersectSegment tests the ray against a part of the curve that is about
+// straight, as a strip between the lines through its ends perpendicular
+// to it
+func (c Curve) intersectSegment(cp [4]Vector, dz Vector, zMin, u0, u1 float32, hit *curveHit) {
+	if (cp[1].Y-cp[0].Y)*-cp[0].Y+cp[0].X*(cp[0].X-cp[1].X) < 0 {
+		return
+	}
+	if (cp[2].Y-cp[3].Y)*-cp[3].Y+cp[3].X*(cp[3].X-cp[2].X) < 0 {
+		return
+	}
+	sx, sy := cp[3].X-cp[0].X, cp[3].Y-cp[0].Y
+	denom := sx*sx + sy*sy
+	if denom == 0 {
+		return
+	}
+	// the closest point to the ray along the chord of the part
+	w := clampf((-cp[0].X*sx-cp[0].Y*sy)/denom, 0, 1)
+	u := mixf(u0, u1, w)
+	width := c.widthAt(u)
+	if c.curveType == CurveRibbon {
+		// ribbons seen edge on are thinner
+		width *= absf(c.ribbonNormal(u).Dot(dz))
+	}
+	p, _ := bezier(cp, w)
+	if p.X*p.X+p.Y*p.Y > width*width/4 || p.Z < zMin || p.Z > hit.z {
+		return
+	}
+	*hit = curveHit{z: p.Z, u: u, ok: true}
+}
+
+// normal at point p of the curve at u, hit by a ray along dz
+func (c Curve) normal(dz Vector, u float32, p Vector) Vector {
+	if c.curveType == CurveRibbon {
+		return c.ribbonNormal(u)
+	}
+	center, tangent := bezier(c.cp, u)
+	tangent = tangent.Normalize()
+	// facing the ray, perpendicular to the curve
+	n := dz.Sub(tangent.Times(dz.Dot(tangent))).Times(-1)
+	if n.Length() < 1e-6 {
+		return dz.Times(-1)
+	}
+	n = n.Normalize()
+	if c.curveType == CurveFlat {
+		return n
+	}
+	// a tube bends away from the ray towards its sides
+	side := VectorFromTo(center, p)
+	side = side.Sub(tangent.Times(side.Dot(tangent))).Sub(n.Times(side.Dot(n)))
+	s := clampf(2*side.Length()/c.widthAt(u), 0, 1)
+	if s == 0 {
+		return n
+	}
+	return n.Times(float32(math.Sqrt(float64(1 - s*s)))).Add(side.Normalize().Times(s)).Normalize()
+}
+
+// the direction away from the closest of a few points along the segment,
+// which is the normal of a tube
+func (c Curve) SurfaceNormal(p Vector) Vector {
+	if c.curveType == CurveRibbon {
+		return c.ribbonNormal((c.uMin + c.uMax) / 2)
+	}
+	var closest Vector
+	best := float32(math.Inf(1))
+	for i := 0; i <= 16; i++ {
+		q, _ := bezier(c.cp, mixf(c.uMin, c.uMax, float32(i)/16))
+		if d := VectorFromTo(q, p).Length(); d < best {
+			closest, best = q, d
+		}
+	}
+	return VectorFromTo(closest, p).Normalize()
+}
@@ -0,0 +1,148 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+// a straight strand along x from -1 to 1
+var straightStrand = [4]Vector{{-1, 0, 0}, {-1.0 / 3, 0, 0}, {1.0 / 3, 0, 0}, {1, 0, 0}}
+
+func intersectCurve(segments []Object, r Ray) (*SurfaceInteraction, bool) {
+	var closest *SurfaceInteraction
+	for _, s := range segments {
+		if si, ok := s.Intersect(r); ok && (closest == nil || si.distance < closest.distance) {
+			closest = si
+		}
+	}
+	return closest, closest != nil
+}
+
+func TestCurveIntersect(t *testing.T) {
+	flat := NewCurve(CurveFlat, straightStrand, 0.2, 0.2, nil)
+	tube := NewCurve(CurveCylinder, straightStrand, 0.2, 0.2, nil)
+	// tapering from 0.2 wide to a point at x = 1
+	tapered := NewCurve(CurveFlat, straightStrand, 0.2, 0, nil)
+	ribbon := NewRibbon(straightStrand, 0.2, 0.2, Vector{0, 1, 0}, Vector{0, 1, 0}, nil)
+	// an arc through (0, 0.75, 0)
+	arc := NewCurve(CurveFlat, [4]Vector{{-1, 0, 0}, {-1, 1, 0}, {1, 1, 0}, {1, 0, 0}}, 0.1, 0.1, nil)
+	for i, tt := range []struct {
+		curve      []Object
+		r          Ray
+		want       float32
+		wantNormal Vector
+		wantTruth  bool
+	}{
+		{
+			curve:      flat,
+			r:          NewRay(Vector{0.3, 0.05, -5}, Vector{0, 0, 1}),
+			want:       5,
+			wantNormal: Vector{0, 0, -1},
+			wantTruth:  true,
+		},
+		{
+			curve:     flat,
+			r:         NewRay(Vector{0.3, 0.15, -5}, Vector{0, 0, 1}),
+			wantTruth: false,
+		},
+		{
+			curve:     flat,
+			r:         NewRay(Vector{1.2, 0, -5}, Vector{0, 0, 1}),
+			wantTruth: false,
+		},
+		{
+			// shaded as a tube, hit off center
+			curve:      tube,
+			r:          NewRay(Vector{0.3, 0.05, -5}, Vector{0, 0, 1}),
+			want:       5,
+			wantNormal: Vector{0, 0.5, -float32(math.Sqrt(0.75))},
+			wantTruth:  true,
+		},
+		{
+			curve:      tapered,
+			r:          NewRay(Vector{-0.9, 0.08, 5}, Vector{0, 0, -1}),
+			want:       5,
+			wantNormal: Vector{0, 0, 1},
+			wantTruth:  true,
+		},
+		{
+			curve:     tapered,
+			r:         NewRay(Vector{0.9, 0.08, 5}, Vector{0, 0, -1}),
+			wantTruth: false,
+		},
+		{
+			curve:      ribbon,
+			r:          NewRay(Vector{0.5, 3, 0.05}, Vector{0, -1, 0}),
+			want:       3,
+			wantNormal: Vector{0, 1, 0},
+			wantTruth:  true,
+		},
+		{
+			// seen edge on
+			curve:     ribbon,
+			r:         NewRay(Vector{0.5, 0.01, -3}, Vector{0, 0, 1}),
+			wantTruth: false,
+		},
+		{
+			curve:      arc,
+			r:          NewRay(Vector{0, 0.74, -2}, Vector{0, 0, 1}),
+			want:       2,
+			wantNormal: Vector{0, 0, -1},
+			wantTruth:  true,
+		},
+		{
+			curve:     arc,
+			r:         NewRay(Vector{0, 0.6, -2}, Vector{0, 0, 1}),
+			wantTruth: false,
+		},
+		{
+			// does not hit its own surface leaving it
+			curve:     flat,
+			r:         NewRay(Vector{0, 0, 0}, Vector{0, 0, 1}),
+			wantTruth: false,
+		},
+	} {
+		si, ok := intersectCurve(tt.curve, tt.r)
+		if ok != tt.wantTruth {
+			t.Errorf("%d) got %v want %v", i, ok, tt.wantTruth)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !compareFloat32(si.distance, tt.want) {
+			t.Errorf("%d) got distance %f want %f", i, si.distance, tt.want)
+		}
+		if !compareVectors(si.normal, tt.wantNormal) {
+			t.Errorf("%d) got normal %v want %v", i, si.normal, tt.wantNormal)
+		}
+	}
+}
+
+func TestCurveBound(t *testing.T) {
+	arc := [4]Vector{{-1, 0, 0}, {-1, 1, 0}, {1, 1, 0}, {1, 0, 0}}
+	segments := NewCurve(CurveFlat, arc, 0.1, 0.1, nil)
+	if len(segments) != 1<<CURVE_SPLIT_DEPTH {
+		t.Fatalf("got %d segments", len(segments))
+	}
+	got := ObjectsBound(segments, identity)
+	want := NewAABB(Vector{-1.05, -0.05, -0.05}, Vector{1.05, 0.8, 0.05})
+	if !compareVectors(VectorMin(got.Pmin, want.Pmin), want.Pmin) || !compareVectors(VectorMax(got.Pmax, want.Pmax), want.Pmax) {
+		t.Errorf("got %v, larger than %v", got, want)
+	}
+	// the segments bound the curve tighter than its control points do
+	if got.Pmax.Y >= 1 {
+		t.Errorf("got %v", got)
+	}
+	// a bvh over many segments finds the closest, where strands are strips
+	// facing the ray through their middle
+	var objects []Object
+	for i := 0; i < 100; i++ {
+		objects = append(objects, NewCurve(CurveCylinder, [4]Vector{{0, 0, float32(i)}, {0, 1, float32(i)}, {0, 2, float32(i)}, {0, 3, float32(i)}}, 0.1, 0.1, nil)...)
+	}
+	bvh := NewBVH(objects, SplitSurfaceAreaHeuristic)
+	si, ok := bvh.ClosestIntersection(NewRay(Vector{0, 1.5, 50.5}, Vector{0, 0, -1}), MAX_RAY_DISTANCE)
+	if !ok || !compareFloat32(si.distance, 0.5) {
+		t.Errorf("got %v %v", si, ok)
+	}
+}
@@ -0,0 +1,55 @@
+package model
+
+// A Cylinder of Radius around the z axis between ZMin and ZMax, swept up
+// to PhiMax radians around the axis: pbrt 142
+type Cylinder struct {
+	shape
+	Radius     float32
+	ZMin, ZMax float32
+	PhiMax     float64
+}
+
+func NewCylinder(toWorld Transform, radius, zMin, zMax float32, phiMax float64, m Material) Cylinder {
+	if zMin > zMax {
+		zMin, zMax = zMax, zMin
+	}
+	return Cylinder{
+		shape:  newShape(toWorld, m),
+		Radius: radius,
+		ZMin:   zMin,
+		ZMax:   zMax,
+		PhiMax: clampPhiMax(phiMax),
+	}
+}
+
+func (c Cylinder) Bound(t Transform) AABB {
+	return c.bound(t, Vector{-c.Radius, -c.Radius, c.ZMin}, Vector{c.Radius, c.Radius, c.ZMax})
+}
+
+func (c Cylinder) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	l := c.worldToObject.Ray(r)
+	ox, oy := float64(l.Origin.X), float64(l.Origin.Y)
+	dx, dy := float64(l.Direction.X), float64(l.Direction.Y)
+	a := dx*dx + dy*dy
+	b := 2 * (dx*ox + dy*oy)
+	k := ox*ox + oy*oy - float64(c.Radius*c.Radius)
+	return c.hit(c, r, l, quadratic(a, b, k), c.inside, c.normal)
+}
+
+func (c Cylinder) inside(p Vector) bool {
+	return p.Z >= c.ZMin && p.Z <= c.ZMax && phi(p) <= c.PhiMax
+}
+
+func (c Cylinder) normal(p Vector) Vector {
+	return Vector{p.X, p.Y, 0}
+}
+
+func (c Cylinder) SurfaceNormal(p Vector) Vector {
+	return c.surfaceNormal(p, c.normal)
+}
+
+// u goes around the axis, v from ZMin to ZMax
+func (c Cylinder) UV(p Vector) Vector {
+	o := c.worldToObject.Point(p)
+	return Vector{float32(phi(o) / c.PhiMax), (o.Z - c.ZMin) / (c.ZMax - c.ZMin), 0}
+}
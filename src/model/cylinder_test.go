@@ -0,0 +1,98 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCylinderIntersect(t *testing.T) {
+	for i, tt := range []struct {
+		c         Cylinder
+		r         Ray
+		want      float32
+		wantTruth bool
+	}{
+		{
+			c:         NewCylinder(ScaleUniform(1), 1, -1, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 0}, Vector{-1, 0, 0}),
+			want:      4.0,
+			wantTruth: true,
+		},
+		{
+			// ray starting inside the cylinder hits its far side
+			c:         NewCylinder(ScaleUniform(1), 1, -1, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{0, 0, 0}, Vector{1, 0, 0}),
+			want:      1.0,
+			wantTruth: true,
+		},
+		{
+			// parallel to the axis
+			c:         NewCylinder(ScaleUniform(1), 1, -1, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{0, 0, -5}, Vector{0, 0, 1}),
+			wantTruth: false,
+		},
+		{
+			// passes above ZMax
+			c:         NewCylinder(ScaleUniform(1), 1, -1, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 2}, Vector{-1, 0, 0}),
+			wantTruth: false,
+		},
+		{
+			// the near side is cut away by phiMax
+			c:         NewCylinder(ScaleUniform(1), 1, -1, 1, math.Pi, nil),
+			r:         NewRay(Vector{0, -5, 0}, Vector{0, 1, 0}),
+			want:      6.0,
+			wantTruth: true,
+		},
+		{
+			c:         NewCylinder(Translate(Vector{0, 5, 0}), 1, -1, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 5, 0}, Vector{-1, 0, 0}),
+			want:      4.0,
+			wantTruth: true,
+		},
+		{
+			// distances are in world space
+			c:         NewCylinder(ScaleUniform(2), 1, -1, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 0}, Vector{-1, 0, 0}),
+			want:      3.0,
+			wantTruth: true,
+		},
+	} {
+		got, found := tt.c.Intersect(tt.r)
+		if !found && tt.wantTruth == false {
+			continue
+		}
+		if (!found && tt.wantTruth == true) || (found && tt.wantTruth == false) {
+			t.Errorf("%d) incorrect bool value; want %v", i, tt.wantTruth)
+			continue
+		}
+		if !compareFloat32(got.distance, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got.distance, tt.want)
+		}
+	}
+}
+
+func TestCylinderSurfaceNormal(t *testing.T) {
+	for i, tt := range []struct {
+		c    Cylinder
+		v    Vector
+		want Vector
+	}{
+		{
+			c:    NewCylinder(ScaleUniform(1), 1, -1, 1, 2*math.Pi, nil),
+			v:    Vector{1, 0, 0.5},
+			want: Vector{1, 0, 0},
+		},
+		{
+			// the axis along y
+			c:    NewCylinder(RotateX(math.Pi/2), 1, -1, 1, 2*math.Pi, nil),
+			v:    Vector{0, 0.5, 1},
+			want: Vector{0, 0, 1},
+		},
+	} {
+		got := tt.c.SurfaceNormal(tt.v)
+		if !compareVectors(got, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// Debug tracers visualise a single property of the first hit along each
+// camera ray. Unlike DebugNormalMaterial they work on any scene without
+// touching its materials.
+
+type ambientOcclusionTracer struct {
+	tracer
+	radius  float32
+	samples int
+}
+
+// NewAmbientOcclusionTracer shades each hit by the fraction of cosine
+// weighted rays that travel at least radius without hitting anything
+func NewAmbientOcclusionTracer(radius float32, samples int) Tracer {
+	if samples < 1 {
+		samples = 1
+	}
+	return &ambientOcclusionTracer{
+		tracer:  newTracer(1),
+		radius:  radius,
+		samples: samples,
+	}
+}
+
+func (ao *ambientOcclusionTracer) GetRayColor(ray Ray, scene *Scene, _ int) Color {
+	si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+	if !ok {
+		return BLACK
+	}
+	// occlusion is two-sided: use the side facing the camera
+	normal := si.normal
+	if normal.Dot(ray.Direction) > 0 {
+		normal = normal.Times(-1)
+	}
+	unoccluded := 0
+	for i := 0; i < ao.samples; i++ {
+		direction := cosineSampleHemisphere(ao.random, normal)
+		if !pointInShadow(si.Point, direction, ao.radius, scene.AccelerationStructure) {
+			unoccluded++
+		}
+	}
+	v := float32(unoccluded) / float32(ao.samples)
+	return Color{v, v, v}
+}
+
+type debugTracer struct {
+	tracer
+	mode TracerType
+	// depth mapped to black in DebugDepth,
+	// and traversal cost mapped to red in the bvh heatmaps
+	maxDistance float32
+	maxCost     int
+}
+
+// NewDebugTracer returns a tracer for one of the Debug TracerTypes
+func NewDebugTracer(mode TracerType, maxDistance float32, maxCost int) Tracer {
+	if maxDistance <= 0 {
+		maxDistance = MAX_RAY_DISTANCE
+	}
+	if maxCost <= 0 {
+		maxCost = 100
+	}
+	return &debugTracer{
+		tracer:      newTracer(1),
+		mode:        mode,
+		maxDistance: maxDistance,
+		maxCost:     maxCost,
+	}
+}
+
+func (dt *debugTracer) GetRayColor(ray Ray, scene *Scene, _ int) Color {
+	stats := &TraversalStats{}
+	ray.stats = stats
+	si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+	switch dt.mode {
+	case DebugBVHNodeVisits:
+		return heatmap(float32(stats.NodesVisited) / float32(dt.maxCost))
+	case DebugBVHPrimitiveTests:
+		return heatmap(float32(stats.PrimitivesTested) / float32(dt.maxCost))
+	}
+	if !ok {
+		return BLACK
+	}
+	switch dt.mode {
+	case DebugShadingNormals:
+		return normalColor(shadingNormal(si))
+	case DebugGeometricNormals:
+		return normalColor(si.normal)
+	case DebugDepth:
+		v := 1 - si.distance/dt.maxDistance
+		if v < 0 {
+			v = 0
+		}
+		return Color{v, v, v}
+	case DebugUV:
+		return debugUV(si)
+	case DebugObjectID:
+		id := objectID(si.object)
+		return NewColor(uint8(id), uint8(id>>8), uint8(id>>16))
+	}
+	return BLACK
+}
+
+// maps [-1,1] to [0,1] per component
+func normalColor(n Vector) Color {
+	n = n.Times(0.5).Add(Vector{0.5, 0.5, 0.5})
+	return Color{n.X, n.Y, n.Z}
+}
+
+type barycentricObject interface {
+	Barycentric(p Vector) (float32, float32, float32)
+}
+
+// uv coordinates as red and green if the object has them,
+// otherwise barycentric coordinates as rgb for triangles
+func debugUV(si *SurfaceInteraction) Color {
+	if tr, ok := si.object.(TriangleInMesh); ok && tr.Mesh.UV != nil {
+		uv := TriangleMeshUVFunc(si)
+		return Color{uv.X, uv.Y, 0}
+	}
+	if b, ok := si.object.(barycentricObject); ok {
+		l0, l1, l2 := b.Barycentric(si.UntransformedPoint)
+		return Color{l0, l1, l2}
+	}
+	return BLACK
+}
+
+// objectID hashes an object into a stable number; triangles in a mesh
+// share the id of their mesh
+func objectID(o Object) uint32 {
+	h := fnv.New32a()
+	if tr, ok := o.(TriangleInMesh); ok {
+		fmt.Fprintf(h, "%p", tr.Mesh)
+		return h.Sum32()
+	}
+	b := o.Bound(identity)
+	for _, f := range []float32{b.Pmin.X, b.Pmin.Y, b.Pmin.Z, b.Pmax.X, b.Pmax.Y, b.Pmax.Z} {
+		fmt.Fprintf(h, "%x", math.Float32bits(f))
+	}
+	return h.Sum32()
+}
+
+// heatmap ramps from blue through green to red for t from 0 to 1
+func heatmap(t float32) Color {
+	if t < 0 {
+		t = 0
+	}
+	if t > 1 {
+		t = 1
+	}
+	if t < 0.5 {
+		return Color{0, 2 * t, 1 - 2*t}
+	}
+	return Color{2*t - 1, 2 - 2*t, 0}
+}
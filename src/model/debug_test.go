@@ -0,0 +1,49 @@
+package model
+
+import "testing"
+
+func TestTraversalStats(t *testing.T) {
+	m := NewDiffuseMaterial(NewConstantTexture(NewColor(255, 255, 255)))
+	objects := []Object{
+		NewSphere(Vector{0, 0, 5}, 1, m),
+		NewSphere(Vector{10, 0, 5}, 1, m),
+		NewSphere(Vector{-10, 0, 5}, 1, m),
+	}
+	for i, tt := range []struct {
+		as        AccelerationStructure
+		wantNodes bool
+	}{
+		{as: NewNaiveAcceleration(objects)},
+		{as: NewBVH(objects, SplitMiddle), wantNodes: true},
+	} {
+		stats := &TraversalStats{}
+		ray := NewRay(Vector{0, 0, 0}, Vector{0, 0, 1})
+		ray.stats = stats
+		if _, ok := tt.as.ClosestIntersection(ray, MAX_RAY_DISTANCE); !ok {
+			t.Fatalf("%d) expected hit", i)
+		}
+		if stats.PrimitivesTested == 0 || stats.PrimitivesTested > len(objects) {
+			t.Errorf("%d) got %d primitives tested", i, stats.PrimitivesTested)
+		}
+		if tt.wantNodes != (stats.NodesVisited > 0) {
+			t.Errorf("%d) got %d nodes visited", i, stats.NodesVisited)
+		}
+	}
+}
+
+func TestHeatmap(t *testing.T) {
+	for i, tt := range []struct {
+		t    float32
+		want Color
+	}{
+		{t: -1, want: Color{0, 0, 1}},
+		{t: 0, want: Color{0, 0, 1}},
+		{t: 0.5, want: Color{0, 1, 0}},
+		{t: 1, want: Color{1, 0, 0}},
+		{t: 2, want: Color{1, 0, 0}},
+	} {
+		if got := heatmap(tt.t); got != tt.want {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
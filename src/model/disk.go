@@ -0,0 +1,57 @@
+package model
+
+import "math"
+
+// A Disk at Height on the z axis facing +z, between InnerRadius and
+// Radius and swept up to PhiMax radians around the axis: pbrt 146
+type Disk struct {
+	shape
+	Height      float32
+	Radius      float32
+	InnerRadius float32
+	PhiMax      float64
+}
+
+func NewDisk(toWorld Transform, height, radius, innerRadius float32, phiMax float64, m Material) Disk {
+	return Disk{
+		shape:       newShape(toWorld, m),
+		Height:      height,
+		Radius:      radius,
+		InnerRadius: innerRadius,
+		PhiMax:      clampPhiMax(phiMax),
+	}
+}
+
+func (d Disk) Bound(t Transform) AABB {
+	return d.bound(t, Vector{-d.Radius, -d.Radius, d.Height}, Vector{d.Radius, d.Radius, d.Height})
+}
+
+func (d Disk) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	l := d.worldToObject.Ray(r)
+	// rays parallel to the disk never hit it
+	if l.Direction.Z == 0 {
+		return nil, false
+	}
+	t := float64((d.Height - l.Origin.Z) / l.Direction.Z)
+	return d.hit(d, r, l, []float64{t}, d.inside, d.normal)
+}
+
+func (d Disk) inside(p Vector) bool {
+	dist2 := p.X*p.X + p.Y*p.Y
+	return dist2 <= d.Radius*d.Radius && dist2 >= d.InnerRadius*d.InnerRadius && phi(p) <= d.PhiMax
+}
+
+func (d Disk) normal(p Vector) Vector {
+	return Vector{0, 0, 1}
+}
+
+func (d Disk) SurfaceNormal(p Vector) Vector {
+	return d.surfaceNormal(p, d.normal)
+}
+
+// u goes around the axis, v from the outer to the inner radius
+func (d Disk) UV(p Vector) Vector {
+	o := d.worldToObject.Point(p)
+	dist := float32(math.Sqrt(float64(o.X*o.X + o.Y*o.Y)))
+	return Vector{float32(phi(o) / d.PhiMax), (d.Radius - dist) / (d.Radius - d.InnerRadius), 0}
+}
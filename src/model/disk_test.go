@@ -0,0 +1,88 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDiskIntersect(t *testing.T) {
+	for i, tt := range []struct {
+		d         Disk
+		r         Ray
+		want      float32
+		wantTruth bool
+	}{
+		{
+			d:         NewDisk(ScaleUniform(1), 1, 2, 0, 2*math.Pi, nil),
+			r:         NewRay(Vector{0, 0, 5}, Vector{0, 0, -1}),
+			want:      4.0,
+			wantTruth: true,
+		},
+		{
+			// through the hole
+			d:         NewDisk(ScaleUniform(1), 1, 2, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{0, 0, 5}, Vector{0, 0, -1}),
+			wantTruth: false,
+		},
+		{
+			d:         NewDisk(ScaleUniform(1), 1, 2, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{1.5, 0, 5}, Vector{0, 0, -1}),
+			want:      4.0,
+			wantTruth: true,
+		},
+		{
+			// parallel to the disk
+			d:         NewDisk(ScaleUniform(1), 1, 2, 0, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 1}, Vector{-1, 0, 0}),
+			wantTruth: false,
+		},
+		{
+			d:         NewDisk(ScaleUniform(1), 1, 2, 0, math.Pi/2, nil),
+			r:         NewRay(Vector{0, 1.5, 5}, Vector{0, 0, -1}),
+			want:      4.0,
+			wantTruth: true,
+		},
+		{
+			d:         NewDisk(ScaleUniform(1), 1, 2, 0, math.Pi/2, nil),
+			r:         NewRay(Vector{-1.5, 0, 5}, Vector{0, 0, -1}),
+			wantTruth: false,
+		},
+	} {
+		got, found := tt.d.Intersect(tt.r)
+		if !found && tt.wantTruth == false {
+			continue
+		}
+		if (!found && tt.wantTruth == true) || (found && tt.wantTruth == false) {
+			t.Errorf("%d) incorrect bool value; want %v", i, tt.wantTruth)
+			continue
+		}
+		if !compareFloat32(got.distance, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got.distance, tt.want)
+		}
+	}
+}
+
+func TestDiskSurfaceNormal(t *testing.T) {
+	for i, tt := range []struct {
+		d    Disk
+		v    Vector
+		want Vector
+	}{
+		{
+			d:    NewDisk(ScaleUniform(1), 1, 2, 0, 2*math.Pi, nil),
+			v:    Vector{0.5, 0.5, 1},
+			want: Vector{0, 0, 1},
+		},
+		{
+			// facing +y
+			d:    NewDisk(RotateX(-math.Pi/2), 0, 2, 0, 2*math.Pi, nil),
+			v:    Vector{0.5, 0, 0.5},
+			want: Vector{0, 1, 0},
+		},
+	} {
+		got := tt.d.SurfaceNormal(tt.v)
+		if !compareVectors(got, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package model
+
+// edges shorter than the size of the mesh divided by 2^DISPLACEMENT_MAX_DEPTH
+// are never split, whatever the EdgeSplitFunc
+const DISPLACEMENT_MAX_DEPTH = 16
+
+// An EdgeSplitFunc decides whether an edge from p0 to p1 of a mesh is split
+// before displacing it. It only sees the edge, so that the triangles on
+// either side of it always agree and the displaced mesh has no cracks
+type EdgeSplitFunc func(p0, p1 Vector) bool
+
+// WorldSpaceEdges splits edges until they are at most maxLength long
+func WorldSpaceEdges(maxLength float32) EdgeSplitFunc {
+	return func(p0, p1 Vector) bool {
+		return VectorFromTo(p0, p1).Length() > maxLength
+	}
+}
+
+// ScreenSpaceEdges splits edges until they span at most maxPixels on the
+// film of camera c. Edges with only one end in view are split as if large,
+// and edges out of view are left alone
+func ScreenSpaceEdges(c Camera, maxPixels float32) EdgeSplitFunc {
+	return func(p0, p1 Vector) bool {
+		x0, y0, ok0 := c.RasterPosition(p0)
+		x1, y1, ok1 := c.RasterPosition(p1)
+		if ok0 != ok1 {
+			return true
+		}
+		return ok0 && Vector{x1 - x0, y1 - y0, 0}.Length() > maxPixels
+	}
+}
+
+// Displace refines the mesh and moves its vertices along their normals by
+// scale times the height texture, which is sampled on the original mesh so
+// that it can use TriangleMeshUVFunc. Every triangle is first split in
+// four levels times, and then adaptively wherever split asks for it, if
+// set. Normals are set to those of the displaced mesh, for use with
+// InterpolatedNormalMappingMaterial, uvs are carried over and tangents
+// recomputed if the mesh had them. The acceleration structure of the mesh
+// is rebuilt
+func (m *TriangleMesh) Displace(height Texture, scale float32, levels int, split EdgeSplitFunc) {
+	d := newDisplacer(m, split)
+	for _, o := range m.as.GetObjects() {
+		t := o.(TriangleInMesh)
+		d.subdivide(d.index[t.p0], d.index[t.p1], d.index[t.p2], t, levels)
+	}
+	vertices := map[int64]Vector{}
+	for i, p := range d.vertices {
+		si := &SurfaceInteraction{
+			object:              d.triangles[i],
+			Point:               p,
+			UntransformedPoint:  p,
+			normal:              d.normals[i],
+			UntransformedNormal: d.normals[i],
+		}
+		h := height.GetColor(si).Luminance()
+		vertices[int64(i)] = p.Add(d.normals[i].Times(h * scale))
+	}
+	normals := vertexNormals(vertices, d.faces)
+	var uvs map[int64]Vector
+	if m.UV != nil {
+		uvs = map[int64]Vector{}
+		for i, uv := range d.uvs {
+			uvs[int64(i)] = uv
+		}
+	}
+	triangles := make([]Object, len(d.faces))
+	for i, f := range d.faces {
+		triangles[i] = TriangleInMesh{p0: f.V0, p1: f.V1, p2: f.V2, Mesh: m}
+	}
+	m.vertices = vertices
+	m.Normals = normals
+	m.UV = uvs
+	m.as = NewBVH(triangles, SplitSurfaceAreaHeuristic)
+	if m.Tangents != nil {
+		m.ComputeTangents()
+	}
+}
+
+// displacer collects the refined mesh before displacing it. Every vertex
+// remembers a triangle of the original mesh it lies on, to sample the
+// height texture
+type displacer struct {
+	split     EdgeSplitFunc
+	minLength float32
+	index     map[int64]int
+	vertices  []Vector
+	normals   []Vector
+	uvs       []Vector
+	triangles []TriangleInMesh
+	midpoints map[[2]int]int
+	faces     []Face
+}
+
+func newDisplacer(m *TriangleMesh, split EdgeSplitFunc) *displacer {
+	d := &displacer{
+		split:     split,
+		index:     map[int64]int{},
+		midpoints: map[[2]int]int{},
+	}
+	b := m.Bound(identity)
+	d.minLength = VectorFromTo(b.Pmin, b.Pmax).Length() / (1 << DISPLACEMENT_MAX_DEPTH)
+	normals := m.Normals
+	if normals == nil {
+		normals = vertexNormals(m.vertices, m.faces())
+	}
+	for _, o := range m.as.GetObjects() {
+		t := o.(TriangleInMesh)
+		for _, v := range []int64{t.p0, t.p1, t.p2} {
+			if _, ok := d.index[v]; ok {
+				continue
+			}
+			d.index[v] = len(d.vertices)
+			d.vertices = append(d.vertices, m.vertices[v])
+			d.normals = append(d.normals, normals[v].Normalize())
+			d.uvs = append(d.uvs, m.UV[v])
+			d.triangles = append(d.triangles, t)
+		}
+	}
+	return d
+}
+
+// midpoint returns the vertex halfway the edge from a to b, which is
+// shared with the triangle on the other side of the edge
+func (d *displacer) midpoint(a, b int, t TriangleInMesh) int {
+	key := [2]int{a, b}
+	if b < a {
+		key = [2]int{b, a}
+	}
+	if m, ok := d.midpoints[key]; ok {
+		return m
+	}
+	m := len(d.vertices)
+	d.midpoints[key] = m
+	d.vertices = append(d.vertices, d.vertices[a].Add(d.vertices[b]).Times(0.5))
+	d.normals = append(d.normals, d.normals[a].Add(d.normals[b]).Normalize())
+	d.uvs = append(d.uvs, d.uvs[a].Add(d.uvs[b]).Times(0.5))
+	d.triangles = append(d.triangles, t)
+	return m
+}
+
+func (d *displacer) splits(a, b int) bool {
+	p0, p1 := d.vertices[a], d.vertices[b]
+	return d.split != nil && VectorFromTo(p0, p1).Length() > d.minLength && d.split(p0, p1)
+}
+
+// subdivide splits triangle a, b, c of original triangle t in four levels
+// times, and after that splits the edges that need it: in four if all do,
+// and otherwise in two or three triangles towards the split edges
+func (d *displacer) subdivide(a, b, c int, t TriangleInMesh, levels int) {
+	if levels > 0 {
+		ab, bc, ca := d.midpoint(a, b, t), d.midpoint(b, c, t), d.midpoint(c, a, t)
+		d.subdivide(a, ab, ca, t, levels-1)
+		d.subdivide(ab, b, bc, t, levels-1)
+		d.subdivide(ca, bc, c, t, levels-1)
+		d.subdivide(ab, bc, ca, t, levels-1)
+		return
+	}
+	sab, sbc, sca := d.splits(a, b), d.splits(b, c), d.splits(c, a)
+	switch {
+	case !sab && !sbc && !sca:
+		d.faces = append(d.faces, NewFace(int64(a), int64(b), int64(c)))
+		return
+	case sab && sbc && sca:
+		d.subdivide(a, b, c, t, 1)
+		return
+	// turn the triangle so that ab is split, and bc if two edges are
+	case sbc && !sab:
+		a, b, c = b, c, a
+		sbc = sca
+	case sca && !sbc:
+		a, b, c = c, a, b
+		sbc = sab
+	}
+	ab := d.midpoint(a, b, t)
+	if !sbc {
+		d.subdivide(a, ab, c, t, 0)
+		d.subdivide(ab, b, c, t, 0)
+		return
+	}
+	bc := d.midpoint(b, c, t)
+	d.subdivide(ab, b, bc, t, 0)
+	d.subdivide(a, ab, bc, t, 0)
+	d.subdivide(a, bc, c, t, 0)
+}
+
+// vertexNormals returns the area weighted normals of the faces around
+// every vertex
+func vertexNormals(vertices map[int64]Vector, faces []Face) map[int64]Vector {
+	normals := map[int64]Vector{}
+	for _, f := range faces {
+		p0, p1, p2 := vertices[f.V0], vertices[f.V1], vertices[f.V2]
+		n := VectorFromTo(p0, p1).Cross(VectorFromTo(p0, p2))
+		for _, v := range []int64{f.V0, f.V1, f.V2} {
+			normals[v] = normals[v].Add(n)
+		}
+	}
+	for v, n := range normals {
+		normals[v] = n.Normalize()
+	}
+	return normals
+}
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+// a unit square on the xz plane of n by n quads, facing up
+func flatGrid(n int) *TriangleMesh {
+	var vertices, uvs []Vector
+	for y := 0; y <= n; y++ {
+		for x := 0; x <= n; x++ {
+			u, v := float32(x)/float32(n), float32(y)/float32(n)
+			vertices = append(vertices, Vector{u, 0, -v})
+			uvs = append(uvs, Vector{u, v, 0})
+		}
+	}
+	return NewGridTriangleMesh(n, n, vertices, nil, uvs, nil).(*TriangleMesh)
+}
+
+// openEdges returns the edges of a mesh with a single triangle on them
+func openEdges(m *TriangleMesh) map[[2]int64]bool {
+	count := map[[2]int64]int{}
+	for _, o := range m.as.GetObjects() {
+		t := o.(TriangleInMesh)
+		for _, e := range [][2]int64{{t.p0, t.p1}, {t.p1, t.p2}, {t.p2, t.p0}} {
+			if e[1] < e[0] {
+				e = [2]int64{e[1], e[0]}
+			}
+			count[e]++
+		}
+	}
+	open := map[[2]int64]bool{}
+	for e, n := range count {
+		if n == 1 {
+			open[e] = true
+		}
+	}
+	return open
+}
+
+func TestDisplace(t *testing.T) {
+	gray := NewConstantTexture(Color{1, 1, 1})
+	for i, tt := range []struct {
+		levels        int
+		split         EdgeSplitFunc
+		wantTriangles int
+		maxEdge       float32
+	}{
+		{levels: 0, wantTriangles: 2, maxEdge: float32(math.Sqrt2)},
+		{levels: 2, wantTriangles: 32, maxEdge: float32(math.Sqrt2) / 4},
+		{levels: 0, split: WorldSpaceEdges(0.3), maxEdge: 0.3},
+		{levels: 1, split: WorldSpaceEdges(0.1), maxEdge: 0.1},
+		{
+			// only refine the left half, leaving t-junctions if done wrong
+			levels: 0,
+			split: func(p0, p1 Vector) bool {
+				return p0.X+p1.X < 1 && VectorFromTo(p0, p1).Length() > 0.05
+			},
+			maxEdge: float32(math.Sqrt2),
+		},
+	} {
+		m := flatGrid(1)
+		m.Displace(gray, 0.5, tt.levels, tt.split)
+		triangles := m.as.GetObjects()
+		if tt.wantTriangles != 0 && len(triangles) != tt.wantTriangles {
+			t.Errorf("%d) got %d triangles want %d", i, len(triangles), tt.wantTriangles)
+		}
+		for _, o := range triangles {
+			p0, p1, p2 := o.(TriangleInMesh).Points()
+			for _, e := range [][2]Vector{{p0, p1}, {p1, p2}, {p2, p0}} {
+				if l := VectorFromTo(e[0], e[1]).Length(); l > tt.maxEdge+1e-5 {
+					t.Errorf("%d) got edge of length %f", i, l)
+				}
+			}
+		}
+		for v, p := range m.vertices {
+			if !compareFloat32(p.Y, 0.5) || !compareVectors(m.Normals[v], Vector{0, 1, 0}) {
+				t.Errorf("%d) got vertex %v with normal %v", i, p, m.Normals[v])
+			}
+		}
+		// all open edges are on the border, so the mesh has no cracks
+		for e := range openEdges(m) {
+			mid := m.vertices[e[0]].Add(m.vertices[e[1]]).Times(0.5)
+			if !compareFloat32(mid.X, 0) && !compareFloat32(mid.X, 1) && !compareFloat32(mid.Z, 0) && !compareFloat32(mid.Z, -1) {
+				t.Errorf("%d) crack at %v", i, mid)
+			}
+		}
+		si, ok := m.Intersect(NewRay(Vector{0.3, 2, -0.6}, Vector{0, -1, 0}))
+		if !ok || !compareFloat32(si.distance, 1.5) {
+			t.Errorf("%d) got %v %v", i, si, ok)
+		}
+	}
+}
+
+func TestDisplaceHeightTexture(t *testing.T) {
+	// heights follow the uvs, 0.2126u + 0.7152v
+	height := NewUVTexture(TriangleMeshUVFunc)
+	m := flatGrid(2)
+	m.Displace(height, 1, 2, nil)
+	if len(m.UV) != len(m.vertices) {
+		t.Fatalf("got %d uvs for %d vertices", len(m.UV), len(m.vertices))
+	}
+	for v, p := range m.vertices {
+		uv := m.UV[v]
+		if !compareFloat32(uv.X, p.X) || !compareFloat32(uv.Y, -p.Z) {
+			t.Errorf("got uv %v at %v", uv, p)
+		}
+		if want := 0.2126*uv.X + 0.7152*uv.Y; !compareFloat32(p.Y, want) {
+			t.Errorf("got height %f want %f", p.Y, want)
+		}
+	}
+	want := Vector{-0.2126, 1, 0.7152}.Normalize()
+	if n := m.Normals[0]; !compareVectors(n, want) {
+		t.Errorf("got normal %v want %v", n, want)
+	}
+}
+
+func TestScreenSpaceEdges(t *testing.T) {
+	c := NewPerspectiveCamera(100, 100, 0.5*math.Pi)
+	c.LookAt(Vector{0, 0, -10}, Vector{0, 0, 0}, Vector{0, 1, 0})
+	split := ScreenSpaceEdges(c, 4)
+	for i, tt := range []struct {
+		p0, p1 Vector
+		want   bool
+	}{
+		// the film is 20 units wide at the origin, so 5 pixels per unit
+		{p0: Vector{0, 0, 0}, p1: Vector{1, 0, 0}, want: true},
+		{p0: Vector{0, 0, 0}, p1: Vector{0.5, 0, 0}, want: false},
+		// further away edges look smaller
+		{p0: Vector{0, 0, 10}, p1: Vector{1, 0, 10}, want: false},
+		{p0: Vector{0, 0, 0}, p1: Vector{100, 0, 0}, want: true},
+		{p0: Vector{0, 0, -20}, p1: Vector{1, 0, -20}, want: false},
+	} {
+		if got := split(tt.p0, tt.p1); got != tt.want {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
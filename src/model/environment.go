@@ -0,0 +1,232 @@
+package model
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// An Environment surrounds the scene at infinite distance: rays that miss
+// all geometry return its radiance and the path tracers with light
+// sampling sample it like any other light
+type Environment interface {
+	// Radiance arriving from the environment along direction d
+	Radiance(d Vector) Color
+	// sample returns a direction towards the environment, its radiance
+	// and the pdf with respect to solid angle
+	sample(random *rand.Rand) (Vector, Color, float32)
+	// pdf with respect to solid angle of sample returning direction d
+	pdf(d Vector) float32
+}
+
+// EnvironmentLight surrounds the scene at infinite distance with radiance
+// read from an equirectangular image: image-based lighting.
+// Rays that miss all geometry return its radiance and the path tracers
+// with light sampling importance sample it by luminance: pbrt 845
+type EnvironmentLight struct {
+	width, height int
+	// linear radiance, row by row from the top (+y) down
+	pixels       []Color
+	lightToWorld Transform
+	distribution *distribution2D
+}
+
+// NewEnvironmentLight uses an LDR image as environment; rotation maps the
+// image's frame, in which +y is up, to world space
+func NewEnvironmentLight(img image.Image, rotation Transform, intensity float32) *EnvironmentLight {
+	return NewHDREnvironmentLight(hdrFromImage(img), rotation, intensity)
+}
+
+func NewHDREnvironmentLight(img *HDRImage, rotation Transform, intensity float32) *EnvironmentLight {
+	pixels := make([]Color, len(img.Pix))
+	for i, c := range img.Pix {
+		pixels[i] = c.Times(intensity)
+	}
+	return &EnvironmentLight{
+		width:        img.Width,
+		height:       img.Height,
+		pixels:       pixels,
+		lightToWorld: rotation,
+		distribution: equirectangularDistribution(img),
+	}
+}
+
+// equirectangularDistribution samples the directions of an equirectangular
+// image proportional to luminance, weighted by the solid angle that each
+// row covers
+func equirectangularDistribution(img *HDRImage) *distribution2D {
+	w, h := img.Width, img.Height
+	weights := make([]float32, len(img.Pix))
+	for y := 0; y < h; y++ {
+		sin := float32(math.Sin(math.Pi * (float64(y) + 0.5) / float64(h)))
+		for x := 0; x < w; x++ {
+			weights[y*w+x] = img.Pix[y*w+x].Luminance() * sin
+		}
+	}
+	return newDistribution2D(weights, w, h)
+}
+
+// direction in world space to (u, v) in [0,1]^2, v = 0 being straight up
+func (e *EnvironmentLight) uv(d Vector) (float32, float32) {
+	return equirectangularUV(e.lightToWorld.Inverse().Vector(d).Normalize())
+}
+
+// world space direction for (u, v) and the sine of its polar angle
+func (e *EnvironmentLight) direction(u, v float32) (Vector, float32) {
+	d, sin := equirectangularDirection(u, v)
+	return e.lightToWorld.Vector(d).Normalize(), sin
+}
+
+// equirectangular mapping of the unit sphere to [0,1]^2 with +y up:
+// u follows the azimuth from +x towards +z, v the polar angle from +y
+func equirectangularUV(d Vector) (float32, float32) {
+	phi := math.Atan2(float64(d.Z), float64(d.X))
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	cos := math.Max(-1, math.Min(1, float64(d.Y)))
+	return float32(phi / (2 * math.Pi)), float32(math.Acos(cos) / math.Pi)
+}
+
+// inverse of equirectangularUV, also returning the sine of the polar angle
+func equirectangularDirection(u, v float32) (Vector, float32) {
+	phi := 2 * math.Pi * float64(u)
+	theta := math.Pi * float64(v)
+	sin := math.Sin(theta)
+	return Vector{float32(sin * math.Cos(phi)), float32(math.Cos(theta)), float32(sin * math.Sin(phi))}, float32(sin)
+}
+
+func (e *EnvironmentLight) pixel(u, v float32) Color {
+	return pixelAt(e.pixels, e.width, e.height, u, v)
+}
+
+// pixelAt looks up the pixel containing (u, v) in [0,1]^2
+func pixelAt(pixels []Color, width, height int, u, v float32) Color {
+	x := int(u * float32(width))
+	y := int(v * float32(height))
+	if x >= width {
+		x = width - 1
+	}
+	if y >= height {
+		y = height - 1
+	}
+	return pixels[y*width+x]
+}
+
+// Radiance arriving from the environment along direction d
+func (e *EnvironmentLight) Radiance(d Vector) Color {
+	return e.pixel(e.uv(d))
+}
+
+// sample returns a direction towards the environment sampled by
+// luminance, its radiance and the pdf with respect to solid angle
+func (e *EnvironmentLight) sample(random *rand.Rand) (Vector, Color, float32) {
+	u, v, pdf := e.distribution.sample(random.Float32(), random.Float32())
+	d, sin := e.direction(u, v)
+	if pdf == 0 || sin == 0 {
+		return d, Color{}, 0
+	}
+	// change of variables from the unit square to the sphere
+	return d, e.pixel(u, v), pdf / (2 * math.Pi * math.Pi * sin)
+}
+
+// pdf with respect to solid angle of sample returning direction d
+func (e *EnvironmentLight) pdf(d Vector) float32 {
+	u, v := e.uv(d)
+	sin := float32(math.Sin(math.Pi * float64(v)))
+	if sin == 0 {
+		return 0
+	}
+	return e.distribution.pdf(u, v) / (2 * math.Pi * math.Pi * sin)
+}
+
+// piecewise constant distribution over [0,1]: pbrt 758
+type distribution1D struct {
+	f, cdf   []float32
+	integral float32
+}
+
+func newDistribution1D(f []float32) *distribution1D {
+	n := len(f)
+	cdf := make([]float32, n+1)
+	for i := 1; i <= n; i++ {
+		cdf[i] = cdf[i-1] + f[i-1]/float32(n)
+	}
+	integral := cdf[n]
+	for i := 1; i <= n; i++ {
+		if integral == 0 {
+			// all zero: fall back to uniform
+			cdf[i] = float32(i) / float32(n)
+		} else {
+			cdf[i] /= integral
+		}
+	}
+	return &distribution1D{f: f, cdf: cdf, integral: integral}
+}
+
+// sample returns x in [0,1), its pdf and the index of its segment
+func (d *distribution1D) sample(u float32) (float32, float32, int) {
+	n := len(d.f)
+	// last index with cdf <= u
+	i := sort.Search(n, func(i int) bool { return d.cdf[i+1] > u })
+	if i >= n {
+		i = n - 1
+	}
+	du := u - d.cdf[i]
+	if width := d.cdf[i+1] - d.cdf[i]; width > 0 {
+		du /= width
+	}
+	x := (float32(i) + du) / float32(n)
+	if x >= 1 {
+		x = math.Nextafter32(1, 0)
+	}
+	return x, d.pdf(i), i
+}
+
+func (d *distribution1D) pdf(i int) float32 {
+	if d.integral == 0 {
+		return 1
+	}
+	return d.f[i] / d.integral
+}
+
+// piecewise constant distribution over [0,1]^2 as a marginal
+// distribution over rows and a conditional distribution per row
+type distribution2D struct {
+	conditional []*distribution1D
+	marginal    *distribution1D
+}
+
+func newDistribution2D(f []float32, w, h int) *distribution2D {
+	conditional := make([]*distribution1D, h)
+	rows := make([]float32, h)
+	for y := 0; y < h; y++ {
+		conditional[y] = newDistribution1D(f[y*w : (y+1)*w])
+		rows[y] = conditional[y].integral
+	}
+	return &distribution2D{
+		conditional: conditional,
+		marginal:    newDistribution1D(rows),
+	}
+}
+
+func (d *distribution2D) sample(u1, u2 float32) (u, v, pdf float32) {
+	v, pdfV, row := d.marginal.sample(u2)
+	u, pdfU, _ := d.conditional[row].sample(u1)
+	return u, v, pdfV * pdfU
+}
+
+func (d *distribution2D) pdf(u, v float32) float32 {
+	h := len(d.conditional)
+	row := int(v * float32(h))
+	if row >= h {
+		row = h - 1
+	}
+	c := d.conditional[row]
+	col := int(u * float32(len(c.f)))
+	if col >= len(c.f) {
+		col = len(c.f) - 1
+	}
+	return d.marginal.pdf(row) * c.pdf(col)
+}
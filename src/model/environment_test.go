@@ -0,0 +1,59 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDistribution1D(t *testing.T) {
+	d := newDistribution1D([]float32{1, 3, 0, 4})
+	for i, tt := range []struct {
+		u     float32
+		wantX float32
+		want  int
+	}{
+		{u: 0, wantX: 0, want: 0},
+		{u: 0.0625, wantX: 0.125, want: 0},
+		{u: 0.25, wantX: 0.3333333, want: 1},
+		{u: 0.75, wantX: 0.875, want: 3},
+	} {
+		x, pdf, offset := d.sample(tt.u)
+		if offset != tt.want || math.Abs(float64(x-tt.wantX)) > 1e-5 {
+			t.Errorf("%d) got %f in segment %d want %f in %d", i, x, offset, tt.wantX, tt.want)
+		}
+		if want := d.f[offset] / 2; pdf != want {
+			t.Errorf("%d) got pdf %f want %f", i, pdf, want)
+		}
+	}
+}
+
+func TestEnvironmentLightSample(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	img := &HDRImage{Width: 16, Height: 8, Pix: make([]Color, 16*8)}
+	for i := range img.Pix {
+		img.Pix[i] = NewColor(uint8(i), 100, 200)
+	}
+	env := NewHDREnvironmentLight(img, RotateY(1), 2)
+	n := 100000
+	var sum float64
+	// directions on the border between two pixels can round to either
+	mismatches := 0
+	for i := 0; i < n; i++ {
+		d, le, pdf := env.sample(random)
+		if pdf == 0 {
+			continue
+		}
+		if got := env.pdf(d); math.Abs(float64(got-pdf)) > 1e-3*float64(pdf) || env.Radiance(d) != le {
+			mismatches++
+		}
+		sum += 1 / float64(pdf)
+	}
+	if mismatches > n/1000 {
+		t.Errorf("pdf or radiance of %d sampled directions does not match", mismatches)
+	}
+	// the expected inverse pdf is the area of the unit sphere
+	if got := sum / float64(n); math.Abs(got-4*math.Pi) > 0.1 {
+		t.Errorf("got mean inverse pdf %f want %f", got, 4*math.Pi)
+	}
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"image"
+	"math"
+	"math/rand"
+)
+
+// A GoniometricLight is a point light whose intensity varies by direction
+// as given by an image over the sphere of directions, in the same
+// equirectangular mapping as EnvironmentLight: pbrt 728
+type GoniometricLight struct {
+	light
+	origin       Vector
+	lightToWorld Transform
+	worldToLight Transform
+	width        int
+	height       int
+	pixels       []Color
+	distribution *distribution2D
+}
+
+// NewGoniometricLight scales the intensity of a PointLight by an LDR
+// image; rotation maps the image's frame, in which +y is up, to world space
+func NewGoniometricLight(o Vector, rotation Transform, img image.Image, c Color, i float32) *GoniometricLight {
+	return NewHDRGoniometricLight(o, rotation, hdrFromImage(img), c, i)
+}
+
+func NewHDRGoniometricLight(o Vector, rotation Transform, img *HDRImage, c Color, i float32) *GoniometricLight {
+	return &GoniometricLight{
+		origin:       o,
+		lightToWorld: rotation,
+		worldToLight: rotation.Inverse(),
+		width:        img.Width,
+		height:       img.Height,
+		pixels:       img.Pix,
+		distribution: equirectangularDistribution(img),
+		light: light{
+			color:     c,
+			intensity: i,
+		},
+	}
+}
+
+func (l *GoniometricLight) radiantIntensity(w Vector) Color {
+	u, v := equirectangularUV(l.worldToLight.Vector(w).Normalize())
+	return l.color.Product(pixelAt(l.pixels, l.width, l.height, u, v)).Times(l.intensity / (4 * math.Pi))
+}
+
+func (l *GoniometricLight) SampleLi(random *rand.Rand, p Vector) (Color, Vector, float32) {
+	li, segment, pdf := pointLi(l, l.origin, p)
+	if li.MaxComponent() == 0 {
+		return li, segment, 0
+	}
+	return li, segment, pdf
+}
+
+// directions are importance sampled by the luminance of the image
+func (l *GoniometricLight) SampleLe(random *rand.Rand) (Ray, Vector, Color, float32, float32) {
+	u, v, pdf := l.distribution.sample(random.Float32(), random.Float32())
+	d, sin := equirectangularDirection(u, v)
+	ray := NewRay(l.origin, l.lightToWorld.Vector(d).Normalize())
+	if pdf == 0 || sin == 0 {
+		return ray, Vector{}, Color{}, 1, 0
+	}
+	return ray, Vector{}, l.radiantIntensity(ray.Direction), 1, pdf / (2 * math.Pi * math.Pi * sin)
+}
+
+func (l *GoniometricLight) PdfLe(w, n Vector) (float32, float32) {
+	u, v := equirectangularUV(l.worldToLight.Vector(w).Normalize())
+	sin := float32(math.Sin(math.Pi * float64(v)))
+	if sin == 0 {
+		return 0, 0
+	}
+	return 0, l.distribution.pdf(u, v) / (2 * math.Pi * math.Pi * sin)
+}
+
+func (l *GoniometricLight) Power() float32 {
+	// the distribution integrates luminance times the sine of the polar
+	// angle over the unit square; mapping it to the sphere scales by 2pi^2
+	integral := l.distribution.marginal.integral * 2 * math.Pi * math.Pi
+	return l.color.Luminance() * l.intensity / (4 * math.Pi) * integral
+}
+
+// bounded as a point light at the brightest intensity of the image
+func (l *GoniometricLight) lightBounds() lightBounds {
+	var max float32
+	for _, c := range l.pixels {
+		if y := c.Luminance(); y > max {
+			max = y
+		}
+	}
+	return lightBounds{
+		bounds:    NewAABB(l.origin, l.origin),
+		phi:       l.color.Luminance() * l.intensity * max,
+		w:         Vector{0, 0, 1},
+		cosThetaO: -1,
+		cosThetaE: 0,
+	}
+}
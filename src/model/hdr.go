@@ -0,0 +1,151 @@
+package model
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strings"
+)
+
+// largest number of pixels ReadHDR accepts, as a guard against corrupt
+// resolutions
+const HDR_MAX_PIXELS = 1 << 26
+
+// HDRImage holds linear floating point radiance, row by row from the top
+type HDRImage struct {
+	Width, Height int
+	Pix           []Color
+}
+
+// hdrFromImage scales the values of an LDR image to [0,1] as they are,
+// without undoing any gamma or sRGB encoding
+func hdrFromImage(img image.Image) *HDRImage {
+	bounds := img.Bounds()
+	hdr := &HDRImage{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Pix:    make([]Color, bounds.Dx()*bounds.Dy()),
+	}
+	for y := 0; y < hdr.Height; y++ {
+		for x := 0; x < hdr.Width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			hdr.Pix[y*hdr.Width+x] = Color{float32(r) / 65535, float32(g) / 65535, float32(b) / 65535}
+		}
+	}
+	return hdr
+}
+
+// ReadHDR decodes a Radiance .hdr (RGBE) image, with or without
+// run length encoded scanlines
+func ReadHDR(r io.Reader) (*HDRImage, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(magic, "#?") {
+		return nil, errors.New("hdr: missing #? header")
+	}
+	// header lines until an empty line
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("hdr: unsupported %s", line)
+		}
+	}
+	resolution, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	var w, h int
+	if _, err := fmt.Sscanf(resolution, "-Y %d +X %d", &h, &w); err != nil {
+		return nil, fmt.Errorf("hdr: unsupported resolution %q", strings.TrimSpace(resolution))
+	}
+	if w <= 0 || h <= 0 || w > HDR_MAX_PIXELS/h {
+		return nil, fmt.Errorf("hdr: invalid resolution %dx%d", w, h)
+	}
+	img := &HDRImage{Width: w, Height: h, Pix: make([]Color, w*h)}
+	scanline := make([]byte, 4*w)
+	for y := 0; y < h; y++ {
+		if err := readHDRScanline(br, scanline, w); err != nil {
+			return nil, err
+		}
+		for x := 0; x < w; x++ {
+			img.Pix[y*w+x] = rgbe(scanline[4*x : 4*x+4])
+		}
+	}
+	return img, nil
+}
+
+// reads one scanline of w pixels into scanline as rgbe quadruples
+func readHDRScanline(br *bufio.Reader, scanline []byte, w int) error {
+	start, err := br.Peek(4)
+	if err != nil {
+		return err
+	}
+	// new style run length encoding stores each channel separately
+	if w < 8 || w > 0x7fff || start[0] != 2 || start[1] != 2 || start[2]&0x80 != 0 {
+		_, err := io.ReadFull(br, scanline)
+		return err
+	}
+	if int(start[2])<<8|int(start[3]) != w {
+		return errors.New("hdr: scanline width mismatch")
+	}
+	br.Discard(4)
+	for c := 0; c < 4; c++ {
+		for x := 0; x < w; {
+			count, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				// a run of the same value
+				n := int(count) - 128
+				if x+n > w {
+					return errors.New("hdr: bad run length")
+				}
+				v, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				for ; n > 0; n-- {
+					scanline[4*x+c] = v
+					x++
+				}
+				continue
+			}
+			n := int(count)
+			if n == 0 || x+n > w {
+				return errors.New("hdr: bad run length")
+			}
+			for ; n > 0; n-- {
+				v, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				scanline[4*x+c] = v
+				x++
+			}
+		}
+	}
+	return nil
+}
+
+// rgb with a shared exponent
+func rgbe(p []byte) Color {
+	if p[3] == 0 {
+		return Color{}
+	}
+	f := float32(math.Ldexp(1, int(p[3])-(128+8)))
+	return Color{float32(p[0]) * f, float32(p[1]) * f, float32(p[2]) * f}
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadHDR(t *testing.T) {
+	header := "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 1 +X 8\n"
+	// flat: 8 pixels of rgbe (128, 64, 0, 129) = (1, 0.5, 0)
+	flat := []byte(header)
+	for i := 0; i < 8; i++ {
+		flat = append(flat, 128, 64, 0, 129)
+	}
+	// run length encoded: each channel as a run of 8 equal values
+	rle := append([]byte(header), 2, 2, 0, 8)
+	for _, v := range []byte{128, 64, 0, 129} {
+		rle = append(rle, 128+8, v)
+	}
+	// run length encoded with literal values for the first channel
+	literal := append([]byte(header), 2, 2, 0, 8, 8, 128, 128, 128, 128, 128, 128, 128, 128)
+	for _, v := range []byte{64, 0, 129} {
+		literal = append(literal, 128+8, v)
+	}
+	for i, data := range [][]byte{flat, rle, literal} {
+		img, err := ReadHDR(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%d) %v", i, err)
+		}
+		if img.Width != 8 || img.Height != 1 {
+			t.Fatalf("%d) got size %dx%d", i, img.Width, img.Height)
+		}
+		for _, c := range img.Pix {
+			if c != (Color{1, 0.5, 0}) {
+				t.Errorf("%d) got %v want {1 0.5 0}", i, c)
+				break
+			}
+		}
+	}
+	if _, err := ReadHDR(bytes.NewReader([]byte("P6\n"))); err == nil {
+		t.Error("expected error on non hdr input")
+	}
+	for _, resolution := range []string{"-Y -2 +X 4", "-Y 2 +X 0", "-Y 100000 +X 100000"} {
+		data := "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n" + resolution + "\n"
+		if _, err := ReadHDR(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("expected error on resolution %s", resolution)
+		}
+	}
+}
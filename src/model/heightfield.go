@@ -0,0 +1,238 @@
+package model
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// A Heightfield is terrain over a grid of nx by nz heights, stored x
+// first, spanning the x and z range of an extent with y going up.
+// Heights in [0,1] map to the y range of the extent. Every cell between
+// four heights is split in two triangles like NewGridTriangleMesh, with
+// normals interpolated between the grid points
+type Heightfield struct {
+	object
+	extent  AABB
+	bounds  AABB
+	nx, nz  int
+	cellX   float32
+	cellZ   float32
+	heights []float32
+	normals []Vector
+	// lowest and highest height of every cell, to skip the cells that
+	// the ray passes over or under
+	cellMin []float32
+	cellMax []float32
+}
+
+func NewHeightfield(extent AABB, nx, nz int, heights []float32, m Material) *Heightfield {
+	if nx < 2 || nz < 2 {
+		panic("heightfield needs at least 2x2 heights")
+	}
+	if len(heights) != nx*nz {
+		panic("heightfield size does not match dimensions")
+	}
+	h := &Heightfield{
+		object:  object{m},
+		extent:  extent,
+		nx:      nx,
+		nz:      nz,
+		cellX:   (extent.Pmax.X - extent.Pmin.X) / float32(nx-1),
+		cellZ:   (extent.Pmax.Z - extent.Pmin.Z) / float32(nz-1),
+		heights: make([]float32, len(heights)),
+		normals: make([]Vector, len(heights)),
+		cellMin: make([]float32, (nx-1)*(nz-1)),
+		cellMax: make([]float32, (nx-1)*(nz-1)),
+	}
+	minY, maxY := float32(math.Inf(1)), float32(math.Inf(-1))
+	for i, v := range heights {
+		y := extent.Pmin.Y + v*(extent.Pmax.Y-extent.Pmin.Y)
+		h.heights[i] = y
+		minY, maxY = minf(minY, y), maxf(maxY, y)
+	}
+	h.bounds = NewAABB(Vector{extent.Pmin.X, minY, extent.Pmin.Z}, Vector{extent.Pmax.X, maxY, extent.Pmax.Z})
+	for z := 0; z < nz; z++ {
+		for x := 0; x < nx; x++ {
+			// central differences, one sided at the edges
+			x0, x1 := maxInt(x-1, 0), minInt(x+1, nx-1)
+			z0, z1 := maxInt(z-1, 0), minInt(z+1, nz-1)
+			dydx := (h.height(x1, z) - h.height(x0, z)) / (float32(x1-x0) * h.cellX)
+			dydz := (h.height(x, z1) - h.height(x, z0)) / (float32(z1-z0) * h.cellZ)
+			h.normals[z*nx+x] = Vector{-dydx, 1, -dydz}.Normalize()
+		}
+	}
+	for z := 0; z < nz-1; z++ {
+		for x := 0; x < nx-1; x++ {
+			a, b, c, d := h.height(x, z), h.height(x+1, z), h.height(x, z+1), h.height(x+1, z+1)
+			h.cellMin[z*(nx-1)+x] = minf(minf(a, b), minf(c, d))
+			h.cellMax[z*(nx-1)+x] = maxf(maxf(a, b), maxf(c, d))
+		}
+	}
+	return h
+}
+
+// NewHeightfieldFromImage reads heights from the gray levels of img, with
+// its columns along x and its rows along z
+func NewHeightfieldFromImage(extent AABB, img image.Image, m Material) *Heightfield {
+	b := img.Bounds()
+	nx, nz := b.Dx(), b.Dy()
+	heights := make([]float32, nx*nz)
+	for z := 0; z < nz; z++ {
+		for x := 0; x < nx; x++ {
+			gray := color.Gray16Model.Convert(img.At(b.Min.X+x, b.Min.Y+z)).(color.Gray16)
+			heights[z*nx+x] = float32(gray.Y) / math.MaxUint16
+		}
+	}
+	return NewHeightfield(extent, nx, nz, heights, m)
+}
+
+func (h *Heightfield) height(x, z int) float32 {
+	return h.heights[z*h.nx+x]
+}
+
+func (h *Heightfield) vertex(x, z int) Vector {
+	return Vector{
+		h.extent.Pmin.X + float32(x)*h.cellX,
+		h.height(x, z),
+		h.extent.Pmin.Z + float32(z)*h.cellZ,
+	}
+}
+
+// the triangles of cell x, z, which index the grid points
+func (h *Heightfield) cellTriangles(x, z int) [2][3][2]int {
+	return [2][3][2]int{
+		{{x, z}, {x + 1, z}, {x, z + 1}},
+		{{x + 1, z}, {x + 1, z + 1}, {x, z + 1}},
+	}
+}
+
+func (h *Heightfield) Bound(t Transform) AABB {
+	return h.bounds.Transform(t)
+}
+
+// Intersect walks the cells under the ray with a 2D DDA, testing only
+// cells whose heights overlap the ray: Amanatides and Woo 1987
+func (h *Heightfield) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	t0, t1, ok := h.bounds.intersectRange(r)
+	if !ok {
+		return nil, false
+	}
+	p := PointFromRay(r, t0)
+	x := clampInt(int((p.X-h.extent.Pmin.X)/h.cellX), 0, h.nx-2)
+	z := clampInt(int((p.Z-h.extent.Pmin.Z)/h.cellZ), 0, h.nz-2)
+	stepX, tMaxX, tDeltaX := h.ddaAxis(r.Origin.X, r.Direction.X, h.extent.Pmin.X, h.cellX, x)
+	stepZ, tMaxZ, tDeltaZ := h.ddaAxis(r.Origin.Z, r.Direction.Z, h.extent.Pmin.Z, h.cellZ, z)
+	tEnter := t0
+	for {
+		tExit := minf(minf(tMaxX, tMaxZ), t1)
+		y0, y1 := PointFromRay(r, tEnter).Y, PointFromRay(r, tExit).Y
+		cell := z*(h.nx-1) + x
+		if minf(y0, y1) <= h.cellMax[cell]+ERROR_MARGIN && maxf(y0, y1) >= h.cellMin[cell]-ERROR_MARGIN {
+			if si, ok := h.intersectCell(r, x, z); ok {
+				return si, true
+			}
+		}
+		if tExit >= t1 {
+			return nil, false
+		}
+		if tMaxX < tMaxZ {
+			x += stepX
+			tEnter = tMaxX
+			tMaxX += tDeltaX
+		} else {
+			z += stepZ
+			tEnter = tMaxZ
+			tMaxZ += tDeltaZ
+		}
+		if x < 0 || x > h.nx-2 || z < 0 || z > h.nz-2 {
+			return nil, false
+		}
+	}
+}
+
+// ddaAxis returns the step through cells along one axis, the distance
+// along the ray to the first cell boundary and between boundaries
+func (h *Heightfield) ddaAxis(o, d, min, size float32, cell int) (int, float32, float32) {
+	inf := float32(math.Inf(1))
+	switch {
+	case d > 0:
+		return 1, (min + float32(cell+1)*size - o) / d, size / d
+	case d < 0:
+		return -1, (min + float32(cell)*size - o) / d, -size / d
+	}
+	return 0, inf, inf
+}
+
+func (h *Heightfield) intersectCell(r Ray, x, z int) (*SurfaceInteraction, bool) {
+	var hit bool
+	var closest float32
+	var tri [3][2]int
+	for _, t := range h.cellTriangles(x, z) {
+		p0, p1, p2 := h.vertex(t[0][0], t[0][1]), h.vertex(t[1][0], t[1][1]), h.vertex(t[2][0], t[2][1])
+		d, ok := triangleIntersect(p0, p1, p2, r)
+		if !ok || d <= ERROR_MARGIN || (hit && d >= closest) {
+			continue
+		}
+		hit, closest, tri = true, d, t
+	}
+	if !hit {
+		return nil, false
+	}
+	n := h.interpolateNormal(tri, PointFromRay(r, closest))
+	return NewSurfaceInteraction(h, closest, n, r), true
+}
+
+func (h *Heightfield) interpolateNormal(tri [3][2]int, p Vector) Vector {
+	l0, l1, l2 := barycentric(h.vertex(tri[0][0], tri[0][1]), h.vertex(tri[1][0], tri[1][1]), h.vertex(tri[2][0], tri[2][1]), p)
+	n0 := h.normals[tri[0][1]*h.nx+tri[0][0]]
+	n1 := h.normals[tri[1][1]*h.nx+tri[1][0]]
+	n2 := h.normals[tri[2][1]*h.nx+tri[2][0]]
+	return n0.Times(l0).Add(n1.Times(l1)).Add(n2.Times(l2)).Normalize()
+}
+
+// the interpolated normal of the terrain above or below p
+func (h *Heightfield) SurfaceNormal(p Vector) Vector {
+	fx := (p.X - h.extent.Pmin.X) / h.cellX
+	fz := (p.Z - h.extent.Pmin.Z) / h.cellZ
+	x := clampInt(int(fx), 0, h.nx-2)
+	z := clampInt(int(fz), 0, h.nz-2)
+	tris := h.cellTriangles(x, z)
+	tri := tris[0]
+	// the diagonal of the cell runs from (x+1, z) to (x, z+1)
+	if fx-float32(x)+fz-float32(z) > 1 {
+		tri = tris[1]
+	}
+	return h.interpolateNormal(tri, Vector{p.X, h.heightAt(tri, p), p.Z})
+}
+
+// heightAt returns the height of triangle tri above p
+func (h *Heightfield) heightAt(tri [3][2]int, p Vector) float32 {
+	p0, p1, p2 := h.vertex(tri[0][0], tri[0][1]), h.vertex(tri[1][0], tri[1][1]), h.vertex(tri[2][0], tri[2][1])
+	n := VectorFromTo(p0, p1).Cross(VectorFromTo(p0, p2))
+	return p0.Y - (n.X*(p.X-p0.X)+n.Z*(p.Z-p0.Z))/n.Y
+}
+
+// UV spans the extent of the heightfield, with u along x and v along z
+func (h *Heightfield) UV(p Vector) Vector {
+	o := h.extent.Offset(p)
+	return Vector{o.X, o.Z, 0}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func clampInt(x, lo, hi int) int {
+	return minInt(maxInt(x, lo), hi)
+}
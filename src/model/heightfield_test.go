@@ -0,0 +1,130 @@
+package model
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// a ramp rising along x from 0 to 4 over 5 by 3 grid points
+func rampHeightfield() *Heightfield {
+	heights := make([]float32, 15)
+	for z := 0; z < 3; z++ {
+		for x := 0; x < 5; x++ {
+			heights[z*5+x] = float32(x) / 4
+		}
+	}
+	return NewHeightfield(NewAABB(Vector{0, 0, 0}, Vector{4, 4, 2}), 5, 3, heights, nil)
+}
+
+func TestHeightfieldIntersect(t *testing.T) {
+	flat := NewHeightfield(NewAABB(Vector{-1, 0, -1}, Vector{1, 2, 1}), 3, 3, []float32{0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5}, nil)
+	ramp := rampHeightfield()
+	up := Vector{-1, 1, 0}.Normalize()
+	for i, tt := range []struct {
+		h          *Heightfield
+		r          Ray
+		want       float32
+		wantNormal Vector
+		wantTruth  bool
+	}{
+		{
+			h:          flat,
+			r:          NewRay(Vector{0.3, 5, -0.2}, Vector{0, -1, 0}),
+			want:       4,
+			wantNormal: Vector{0, 1, 0},
+			wantTruth:  true,
+		},
+		{
+			h:         flat,
+			r:         NewRay(Vector{3, 5, 0}, Vector{0, -1, 0}),
+			wantTruth: false,
+		},
+		{
+			h:          ramp,
+			r:          NewRay(Vector{2.5, 10, 0.5}, Vector{0, -1, 0}),
+			want:       7.5,
+			wantNormal: up,
+			wantTruth:  true,
+		},
+		{
+			// walks several cells before hitting the slope
+			h:          ramp,
+			r:          NewRay(Vector{0, 3, 0.5}, Vector{1, 0, 0}),
+			want:       3,
+			wantNormal: up,
+			wantTruth:  true,
+		},
+		{
+			// terrain has no sides, so this hits the slope from below
+			h:          ramp,
+			r:          NewRay(Vector{5, 2, 1.5}, Vector{-1, 0, 0}),
+			want:       3,
+			wantNormal: up,
+			wantTruth:  true,
+		},
+		{
+			h:          ramp,
+			r:          NewRay(Vector{-1, 3, -1}, Vector{3, 0, 2}),
+			want:       float32(math.Sqrt(4*4 + 8.0/3*8.0/3)),
+			wantNormal: up,
+			wantTruth:  true,
+		},
+		{
+			h:         ramp,
+			r:         NewRay(Vector{0, 5, 1}, Vector{1, 0.1, 0}),
+			wantTruth: false,
+		},
+	} {
+		got, found := tt.h.Intersect(tt.r)
+		if !found && tt.wantTruth == false {
+			continue
+		}
+		if (!found && tt.wantTruth == true) || (found && tt.wantTruth == false) {
+			t.Errorf("%d) incorrect bool value; want %v", i, tt.wantTruth)
+			continue
+		}
+		if !compareFloat32(got.distance, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got.distance, tt.want)
+		}
+		if !compareVectors(got.normal, tt.wantNormal) {
+			t.Errorf("%d) got normal %v want %v", i, got.normal, tt.wantNormal)
+		}
+	}
+}
+
+func TestHeightfieldSurfaceNormal(t *testing.T) {
+	// a single peak in the middle
+	h := NewHeightfield(NewAABB(Vector{-1, 0, -1}, Vector{1, 1, 1}), 3, 3, []float32{0, 0, 0, 0, 1, 0, 0, 0, 0}, nil)
+	for i, tt := range []struct {
+		v    Vector
+		want Vector
+	}{
+		{v: Vector{0, 1, 0}, want: Vector{0, 1, 0}},
+		{v: Vector{1, 0, 0}, want: Vector{1, 1, 0}.Normalize()},
+		// halfway between the normals of the peak and the edge
+		{v: Vector{-0.5, 0.5, 0}, want: Vector{-1, 1 + math.Sqrt2, 0}.Normalize()},
+	} {
+		got := h.SurfaceNormal(tt.v)
+		if !compareVectors(got, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestHeightfieldFromImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	img.Set(2, 1, color.Gray{255})
+	h := NewHeightfieldFromImage(NewAABB(Vector{0, 0, 0}, Vector{2, 10, 1}), img, nil)
+	if got, want := h.Bound(ScaleUniform(1)), NewAABB(Vector{0, 0, 0}, Vector{2, 10, 1}); got != want {
+		t.Errorf("got bounds %v want %v", got, want)
+	}
+	si, ok := h.Intersect(NewRay(Vector{2, 20, 1}, Vector{0, -1, 0}))
+	if !ok || !compareFloat32(si.distance, 10) {
+		t.Fatalf("got hit %v want distance 10", si)
+	}
+	if got := ParametricUVFunc(si); !compareVectors(got, Vector{1, 1, 0}) {
+		t.Errorf("got uv %v want {1 1 0}", got)
+	}
+}
@@ -0,0 +1,221 @@
+package model
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// resolution of the image a profile is tabulated into by NewIESLight
+const (
+	IES_IMAGE_WIDTH  = 256
+	IES_IMAGE_HEIGHT = 128
+)
+
+// IESProfile is the candela distribution of a light fixture read from an
+// IESNA LM-63 photometric file. Only type C photometry is supported:
+// vertical angles are measured from straight down, horizontal angles
+// around the vertical axis. All angles are in degrees
+type IESProfile struct {
+	Vertical   []float32
+	Horizontal []float32
+	// candela per horizontal angle, per vertical angle, with the
+	// candela multiplier applied
+	Candela [][]float32
+}
+
+// ReadIES parses an IESNA LM-63 photometric file
+func ReadIES(r io.Reader) (*IESProfile, error) {
+	scanner := bufio.NewScanner(r)
+	tilt := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "TILT=") {
+			tilt = strings.TrimPrefix(line, "TILT=")
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if tilt == "" {
+		return nil, errors.New("ies: missing TILT line")
+	}
+	var values []float32
+	for scanner.Scan() {
+		fields := strings.FieldsFunc(scanner.Text(), func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ',' || r == '\r'
+		})
+		for _, f := range fields {
+			v, err := strconv.ParseFloat(f, 32)
+			if err != nil {
+				return nil, fmt.Errorf("ies: %v", err)
+			}
+			values = append(values, float32(v))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	next := func(n int) ([]float32, error) {
+		if len(values) < n {
+			return nil, fmt.Errorf("ies: expected %d more values, got %d", n, len(values))
+		}
+		v := values[:n]
+		values = values[n:]
+		return v, nil
+	}
+	// counts are stored as floats like all other values, and can only be
+	// as large as the number of values left to read
+	count := func(f float32) (int, bool) {
+		if f < 0 || f > float32(len(values)) || f != float32(math.Trunc(float64(f))) {
+			return 0, false
+		}
+		return int(f), true
+	}
+	// lamp tilt data is ignored: lamp to luminaire geometry, then
+	// a number of angle and multiplier pairs
+	if tilt == "INCLUDE" {
+		header, err := next(2)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := count(header[1])
+		if !ok {
+			return nil, fmt.Errorf("ies: invalid number of tilt angles %v", header[1])
+		}
+		if _, err := next(2 * n); err != nil {
+			return nil, err
+		}
+	}
+	// number of lamps, lumens per lamp, candela multiplier, number of
+	// vertical and horizontal angles, photometric type, units type,
+	// width, length and height, ballast factor, future use, input watts
+	header, err := next(13)
+	if err != nil {
+		return nil, err
+	}
+	multiplier := header[2]
+	if photometricType := int(header[5]); photometricType != 1 {
+		return nil, fmt.Errorf("ies: unsupported photometric type %d", photometricType)
+	}
+	nv, okv := count(header[3])
+	nh, okh := count(header[4])
+	if !okv || !okh || nv < 1 || nh < 1 {
+		return nil, fmt.Errorf("ies: invalid number of angles %v x %v", header[3], header[4])
+	}
+	p := &IESProfile{}
+	if p.Vertical, err = next(nv); err != nil {
+		return nil, err
+	}
+	if p.Horizontal, err = next(nh); err != nil {
+		return nil, err
+	}
+	p.Candela = make([][]float32, nh)
+	for i := range p.Candela {
+		row, err := next(nv)
+		if err != nil {
+			return nil, err
+		}
+		for j := range row {
+			row[j] *= multiplier
+		}
+		p.Candela[i] = row
+	}
+	return p, nil
+}
+
+// horizontalAngle maps an angle in [0,360) into the range of horizontal
+// angles the profile covers, using the symmetry implied by that range
+func (p *IESProfile) horizontalAngle(h float32) float32 {
+	first, last := p.Horizontal[0], p.Horizontal[len(p.Horizontal)-1]
+	switch {
+	case last == 0:
+		// rotationally symmetric
+		return 0
+	case first == 0 && last == 90:
+		// symmetric in each quadrant
+		h = float32(math.Mod(float64(h), 180))
+		if h > 90 {
+			h = 180 - h
+		}
+	case first == 0 && last == 180:
+		// symmetric about the 0-180 degree plane
+		if h > 180 {
+			h = 360 - h
+		}
+	case first == 90 && last == 270:
+		// symmetric about the 90-270 degree plane
+		if h < 90 {
+			h = 180 - h
+		} else if h > 270 {
+			h = 540 - h
+		}
+	}
+	return h
+}
+
+// angleSegment finds the segment of sorted angles containing a and the
+// position of a within it
+func angleSegment(angles []float32, a float32) (int, float32) {
+	i := sort.Search(len(angles), func(i int) bool { return angles[i] > a }) - 1
+	if i < 0 {
+		return 0, 0
+	}
+	if i >= len(angles)-1 {
+		return len(angles) - 1, 0
+	}
+	return i, (a - angles[i]) / (angles[i+1] - angles[i])
+}
+
+// Intensity returns the candela at vertical angle v and horizontal angle h,
+// interpolating bilinearly. There is no light outside the vertical angles
+// of the profile
+func (p *IESProfile) Intensity(v, h float32) float32 {
+	if v < p.Vertical[0] || v > p.Vertical[len(p.Vertical)-1] {
+		return 0
+	}
+	h = float32(math.Mod(float64(h), 360))
+	if h < 0 {
+		h += 360
+	}
+	h = p.horizontalAngle(h)
+	vi, vt := angleSegment(p.Vertical, v)
+	hi, ht := angleSegment(p.Horizontal, h)
+	at := func(hi int) float32 {
+		row := p.Candela[hi]
+		if vt == 0 {
+			return row[vi]
+		}
+		return (1-vt)*row[vi] + vt*row[vi+1]
+	}
+	if ht == 0 {
+		return at(hi)
+	}
+	return (1-ht)*at(hi) + ht*at(hi+1)
+}
+
+// NewIESLight returns a point light with the angular distribution of
+// profile, emitting scale times its candela values. With rotation the
+// identity the fixture points down (-y), horizontal angle 0 along +x and
+// horizontal angles increasing towards +z
+func NewIESLight(o Vector, rotation Transform, profile *IESProfile, c Color, scale float32) *GoniometricLight {
+	w, h := IES_IMAGE_WIDTH, IES_IMAGE_HEIGHT
+	img := &HDRImage{Width: w, Height: h, Pix: make([]Color, w*h)}
+	for y := 0; y < h; y++ {
+		// vertical angles are measured from -y, v from +y
+		vertical := 180 - 180*(float32(y)+0.5)/float32(h)
+		for x := 0; x < w; x++ {
+			horizontal := 360 * (float32(x) + 0.5) / float32(w)
+			i := profile.Intensity(vertical, horizontal)
+			img.Pix[y*w+x] = Color{i, i, i}
+		}
+	}
+	// a goniometric light emits intensity / 4pi times the image
+	return NewHDRGoniometricLight(o, rotation, img, c, 4*math.Pi*scale)
+}
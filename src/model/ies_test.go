@@ -0,0 +1,97 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const testIES = `IESNA:LM-63-2002
+[TEST] test fixture
+[MANUFAC] none
+TILT=INCLUDE
+1
+2
+0 90
+1 1
+1 1000 2 3 2 1 2 0.5 0.5 0
+1.0 1.0 100
+0 45 90
+0 90
+100 50 0
+200, 100, 0
+`
+
+func TestReadIES(t *testing.T) {
+	p, err := ReadIES(strings.NewReader(testIES))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range []struct {
+		v, h float32
+		want float32
+	}{
+		{v: 0, h: 0, want: 200},
+		{v: 22.5, h: 0, want: 150},
+		{v: 45, h: 90, want: 200},
+		{v: 45, h: 45, want: 150},
+		// quadrant symmetry
+		{v: 45, h: 180, want: 100},
+		{v: 45, h: 270, want: 200},
+		{v: 45, h: 315, want: 150},
+		// no light above the profile's vertical angles
+		{v: 120, h: 0, want: 0},
+	} {
+		if got := p.Intensity(tt.v, tt.h); math.Abs(float64(got-tt.want)) > 1e-3 {
+			t.Errorf("%d) got %f want %f", i, got, tt.want)
+		}
+	}
+}
+
+func TestReadIESErrors(t *testing.T) {
+	for i, tt := range []struct {
+		ies  string
+		want string
+	}{
+		{ies: "IESNA:LM-63-2002\n1 1000 1 1 1 1 2 0 0 0\n", want: "ies: missing TILT line"},
+		{ies: "TILT=NONE\n1 1000 1 1 1 2 2 0 0 0 1 1 100\n0\n0\n100\n", want: "ies: unsupported photometric type 2"},
+		{ies: "TILT=NONE\n1 1000 1 2 1 1 2 0 0 0 1 1 100\n0 90\n0\n100\n", want: "ies: expected 2 more values, got 1"},
+		{ies: "TILT=INCLUDE\n1 -3\n1 1000 1 1 1 1 2 0 0 0 1 1 100\n0\n0\n100\n", want: "ies: invalid number of tilt angles -3"},
+		{ies: "TILT=NONE\n1 1000 1 -1 1 1 2 0 0 0 1 1 100\n0\n0\n100\n", want: "ies: invalid number of angles -1 x 1"},
+		{ies: "TILT=NONE\n1 1000 1 1e30 1 1 2 0 0 0 1 1 100\n0\n0\n100\n", want: "ies: invalid number of angles 1e+30 x 1"},
+		{ies: "TILT=NONE\n1 1000 1 1.5 1 1 2 0 0 0 1 1 100\n0\n0\n100\n", want: "ies: invalid number of angles 1.5 x 1"},
+	} {
+		_, err := ReadIES(strings.NewReader(tt.ies))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%d) got error %v want %s", i, err, tt.want)
+		}
+	}
+}
+
+func TestIESLight(t *testing.T) {
+	p, err := ReadIES(strings.NewReader(testIES))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewIESLight(Vector{0, 10, 0}, ScaleUniform(1), p, NewColor(255, 255, 255), 0.01)
+	// straight down: 200 candela at distance 10
+	li, _, pdf := l.SampleLi(nil, Vector{0, 0, 0})
+	if pdf != 1 || math.Abs(float64(li.r-0.02)) > 1e-3 {
+		t.Errorf("got %v with pdf %f below the light, want 0.02", li, pdf)
+	}
+	// nothing above the horizontal plane of the fixture
+	if li, _, pdf := l.SampleLi(nil, Vector{1, 20, 0}); pdf != 0 || li != (Color{}) {
+		t.Errorf("got %v with pdf %f above the light", li, pdf)
+	}
+	random := rand.New(rand.NewSource(42))
+	for i := 0; i < 100; i++ {
+		ray, _, le, _, pdfDir := l.SampleLe(random)
+		if ray.Direction.Y > 0 || le.r <= 0 {
+			t.Fatalf("sampled direction %v with intensity %v", ray.Direction, le)
+		}
+		if _, got := l.PdfLe(ray.Direction, Vector{}); math.Abs(float64(got-pdfDir)) > 1e-3*float64(pdfDir) {
+			t.Errorf("got pdf %f want %f", got, pdfDir)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package model
+
+import "math"
+
+// default precision of finding the roots of an ImplicitSurface
+const (
+	IMPLICIT_EPSILON    = 1e-3
+	IMPLICIT_MAX_STEPS  = 1024
+	IMPLICIT_BISECTIONS = 32
+)
+
+// A Field is a scalar field over space, such as a density or a potential
+type Field func(p Vector) float32
+
+// An ImplicitSurface is where Field equals Iso, with the inside of the
+// object where the field exceeds it as with densities. Lipschitz bounds
+// how fast the field changes: |f(p) - f(q)| <= Lipschitz * |p - q|,
+// which tells how far a ray can safely march without crossing the surface.
+// Bounds has to contain the whole surface. The normal is the gradient,
+// given by Gradient if set or by finite differences otherwise
+type ImplicitSurface struct {
+	object
+	Field     Field
+	Gradient  func(p Vector) Vector
+	Iso       float32
+	Lipschitz float32
+	Bounds    AABB
+	// steps are at least Epsilon long, which is also the size of the
+	// finite differences for the gradient
+	Epsilon  float32
+	MaxSteps int
+}
+
+func NewImplicitSurface(f Field, iso, lipschitz float32, bounds AABB, m Material) *ImplicitSurface {
+	if lipschitz <= 0 {
+		panic("lipschitz bound has to be positive!")
+	}
+	return &ImplicitSurface{
+		object:    object{m},
+		Field:     f,
+		Iso:       iso,
+		Lipschitz: lipschitz,
+		Bounds:    bounds,
+		Epsilon:   IMPLICIT_EPSILON,
+		MaxSteps:  IMPLICIT_MAX_STEPS,
+	}
+}
+
+func (s *ImplicitSurface) Bound(t Transform) AABB {
+	return s.Bounds.Transform(t)
+}
+
+// Intersect marches along the ray in steps that cannot skip the surface
+// by the Lipschitz bound, until the field crosses Iso, and then finds
+// the root between the last two steps by bisection: Kalra and Barr 1989
+func (s *ImplicitSurface) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	t, tMax, ok := s.Bounds.intersectRange(r)
+	if !ok {
+		return nil, false
+	}
+	// rays leaving the surface start on it, so start just past the origin
+	t = maxf(t, ERROR_MARGIN)
+	g := s.Field(PointFromRay(r, t)) - s.Iso
+	for i := 0; i < s.MaxSteps && t < tMax; i++ {
+		next := minf(t+maxf(absf(g)/s.Lipschitz, s.Epsilon), tMax)
+		gNext := s.Field(PointFromRay(r, next)) - s.Iso
+		if (g > 0) != (gNext > 0) {
+			d := s.bisect(r, t, next, g)
+			return NewSurfaceInteraction(s, d, s.SurfaceNormal(PointFromRay(r, d)), r), true
+		}
+		t, g = next, gNext
+	}
+	return nil, false
+}
+
+// bisect returns the root between t0 and t1, given the field at t0
+func (s *ImplicitSurface) bisect(r Ray, t0, t1, g0 float32) float32 {
+	for i := 0; i < IMPLICIT_BISECTIONS; i++ {
+		mid := (t0 + t1) / 2
+		g := s.Field(PointFromRay(r, mid)) - s.Iso
+		if (g > 0) == (g0 > 0) {
+			t0, g0 = mid, g
+		} else {
+			t1 = mid
+		}
+	}
+	return (t0 + t1) / 2
+}
+
+// the normal points out of the object, against the gradient of the field
+func (s *ImplicitSurface) SurfaceNormal(p Vector) Vector {
+	if s.Gradient != nil {
+		return s.Gradient(p).Times(-1).Normalize()
+	}
+	h := s.Epsilon
+	return Vector{
+		s.Field(Vector{p.X - h, p.Y, p.Z}) - s.Field(Vector{p.X + h, p.Y, p.Z}),
+		s.Field(Vector{p.X, p.Y - h, p.Z}) - s.Field(Vector{p.X, p.Y + h, p.Z}),
+		s.Field(Vector{p.X, p.Y, p.Z - h}) - s.Field(Vector{p.X, p.Y, p.Z + h}),
+	}.Normalize()
+}
+
+// A Metaball adds Strength to the field at its Center, falling off with
+// distance as set by Radius
+type Metaball struct {
+	Center   Vector
+	Radius   float32
+	Strength float32
+}
+
+// emptyImplicitSurface has a field that is 0 everywhere in empty bounds,
+// so rays never hit it
+func emptyImplicitSurface(iso float32, m Material) *ImplicitSurface {
+	return NewImplicitSurface(func(Vector) float32 { return 0 }, iso, 1, AABB{}, m)
+}
+
+// NewMetaballs is the surface where the sum of the soft objects of Wyvill,
+// McPheeters and Wyvill 1986 equals iso. A metaball contributes
+// Strength (1 - r^2/Radius^2)^3 up to Radius, and nothing beyond it
+func NewMetaballs(balls []Metaball, iso float32, m Material) *ImplicitSurface {
+	if len(balls) == 0 {
+		return emptyImplicitSurface(iso, m)
+	}
+	// the falloff is steepest at r = Radius/sqrt(5)
+	steepest := 6 / math.Sqrt(5) * 16 / 25
+	var lipschitz float32
+	bounds := NewAABB(balls[0].Center, balls[0].Center)
+	for _, b := range balls {
+		lipschitz += float32(steepest) * b.Strength / b.Radius
+		r := Vector{b.Radius, b.Radius, b.Radius}
+		bounds = bounds.AddAABB(NewAABB(b.Center.Sub(r), b.Center.Add(r)))
+	}
+	s := NewImplicitSurface(func(p Vector) float32 {
+		var sum float32
+		for _, b := range balls {
+			x := VectorFromTo(b.Center, p)
+			r2 := x.Dot(x) / (b.Radius * b.Radius)
+			if r2 < 1 {
+				sum += b.Strength * (1 - r2) * (1 - r2) * (1 - r2)
+			}
+		}
+		return sum
+	}, iso, lipschitz, bounds, m)
+	s.Gradient = func(p Vector) Vector {
+		var sum Vector
+		for _, b := range balls {
+			x := VectorFromTo(b.Center, p)
+			r2 := x.Dot(x) / (b.Radius * b.Radius)
+			if r2 < 1 {
+				sum = sum.Add(x.Times(-6 * b.Strength * (1 - r2) * (1 - r2) / (b.Radius * b.Radius)))
+			}
+		}
+		return sum
+	}
+	return s
+}
+
+// NewBlobs is the surface where the sum of the Gaussian blobs of Blinn
+// 1982 equals iso. A blob contributes Strength exp(-r^2/Radius^2), so a
+// single blob of Strength e*iso has a surface at Radius
+func NewBlobs(blobs []Metaball, iso float32, m Material) *ImplicitSurface {
+	if len(blobs) == 0 {
+		return emptyImplicitSurface(iso, m)
+	}
+	// the field only exceeds iso where one of the n blobs exceeds iso/n
+	n := float64(len(blobs))
+	var lipschitz float32
+	bounds := NewAABB(blobs[0].Center, blobs[0].Center)
+	for _, b := range blobs {
+		// the falloff is steepest at r = Radius/sqrt(2)
+		lipschitz += float32(math.Sqrt(2/math.E)) * b.Strength / b.Radius
+		reach := float64(b.Radius) * math.Sqrt(math.Max(0, math.Log(float64(b.Strength)*n/float64(iso))))
+		r := Vector{float32(reach), float32(reach), float32(reach)}
+		bounds = bounds.AddAABB(NewAABB(b.Center.Sub(r), b.Center.Add(r)))
+	}
+	s := NewImplicitSurface(func(p Vector) float32 {
+		var sum float32
+		for _, b := range blobs {
+			x := VectorFromTo(b.Center, p)
+			sum += b.Strength * float32(math.Exp(float64(-x.Dot(x)/(b.Radius*b.Radius))))
+		}
+		return sum
+	}, iso, lipschitz, bounds, m)
+	s.Gradient = func(p Vector) Vector {
+		var sum Vector
+		for _, b := range blobs {
+			x := VectorFromTo(b.Center, p)
+			f := b.Strength * float32(math.Exp(float64(-x.Dot(x)/(b.Radius*b.Radius))))
+			sum = sum.Add(x.Times(-2 * f / (b.Radius * b.Radius)))
+		}
+		return sum
+	}
+	return s
+}
@@ -0,0 +1,159 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestImplicitSurfaceIntersect(t *testing.T) {
+	// a density falling off linearly from the origin
+	sphere := NewImplicitSurface(func(p Vector) float32 {
+		return 1 - p.Length()
+	}, 0.5, 1, NewAABB(Vector{-1, -1, -1}, Vector{1, 1, 1}), nil)
+	wyvill := NewMetaballs([]Metaball{
+		{Center: Vector{0, 0, 0}, Radius: 2, Strength: 1},
+	}, 0.125, nil)
+	pair := NewMetaballs([]Metaball{
+		{Center: Vector{-5, 0, 0}, Radius: 2, Strength: 1},
+		{Center: Vector{5, 0, 0}, Radius: 2, Strength: 1},
+	}, 0.125, nil)
+	blob := NewBlobs([]Metaball{
+		{Center: Vector{0, 0, 0}, Radius: 1, Strength: math.E},
+	}, 1, nil)
+	for i, tt := range []struct {
+		s          Object
+		r          Ray
+		want       float32
+		wantNormal Vector
+		wantTruth  bool
+	}{
+		{
+			s:          sphere,
+			r:          NewRay(Vector{0, 0, 5}, Vector{0, 0, -1}),
+			want:       4.5,
+			wantNormal: Vector{0, 0, 1},
+			wantTruth:  true,
+		},
+		{
+			s:          sphere,
+			r:          NewRay(Vector{0, 0, 0}, Vector{0, 1, 0}),
+			want:       0.5,
+			wantNormal: Vector{0, 1, 0},
+			wantTruth:  true,
+		},
+		{
+			// a ray leaving the surface finds its other side
+			s:          sphere,
+			r:          NewRay(Vector{0, 0, 0.5}, Vector{0, 0, -1}),
+			want:       1,
+			wantNormal: Vector{0, 0, -1},
+			wantTruth:  true,
+		},
+		{
+			s:         sphere,
+			r:         NewRay(Vector{0, 0, 0.5}, Vector{0, 0, 1}),
+			wantTruth: false,
+		},
+		{
+			s:          wyvill,
+			r:          NewRay(Vector{5, 0, 0}, Vector{-1, 0, 0}),
+			want:       5 - float32(math.Sqrt2),
+			wantNormal: Vector{1, 0, 0},
+			wantTruth:  true,
+		},
+		{
+			// the ray passes between both metaballs
+			s:         pair,
+			r:         NewRay(Vector{0, 5, 0}, Vector{0, -1, 0}),
+			wantTruth: false,
+		},
+		{
+			s:          pair,
+			r:          NewRay(Vector{0, 0, 0}, Vector{1, 0, 0}),
+			want:       5 - float32(math.Sqrt2),
+			wantNormal: Vector{-1, 0, 0},
+			wantTruth:  true,
+		},
+		{
+			s:          blob,
+			r:          NewRay(Vector{0, -5, 0}, Vector{0, 1, 0}),
+			want:       4,
+			wantNormal: Vector{0, -1, 0},
+			wantTruth:  true,
+		},
+		{
+			s:          NewSharedObject(blob, Translate(Vector{0, 0, 10})),
+			r:          NewRay(Vector{0, 0, 0}, Vector{0, 0, 1}),
+			want:       9,
+			wantNormal: Vector{0, 0, -1},
+			wantTruth:  true,
+		},
+	} {
+		got, found := tt.s.Intersect(tt.r)
+		if !found && tt.wantTruth == false {
+			continue
+		}
+		if (!found && tt.wantTruth == true) || (found && tt.wantTruth == false) {
+			t.Errorf("%d) incorrect bool value; want %v", i, tt.wantTruth)
+			continue
+		}
+		if !compareFloat32(got.distance, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got.distance, tt.want)
+		}
+		if !compareVectors(got.normal, tt.wantNormal) {
+			t.Errorf("%d) got normal %v want %v", i, got.normal, tt.wantNormal)
+		}
+	}
+}
+
+func TestMetaballsBound(t *testing.T) {
+	for i, tt := range []struct {
+		s    *ImplicitSurface
+		want AABB
+	}{
+		{
+			s: NewMetaballs([]Metaball{
+				{Center: Vector{-5, 0, 0}, Radius: 2, Strength: 1},
+				{Center: Vector{5, 1, 0}, Radius: 1, Strength: 1},
+			}, 0.5, nil),
+			want: NewAABB(Vector{-7, -2, -2}, Vector{6, 2, 2}),
+		},
+		{
+			// two blobs each need to exceed half of iso
+			s: NewBlobs([]Metaball{
+				{Center: Vector{0, 0, 0}, Radius: 1, Strength: math.E / 2},
+				{Center: Vector{0, 0, 0}, Radius: 1, Strength: math.E / 2},
+			}, 1, nil),
+			want: NewAABB(Vector{-1, -1, -1}, Vector{1, 1, 1}),
+		},
+	} {
+		got := tt.s.Bound(ScaleUniform(1))
+		if !compareVectors(got.Pmin, tt.want.Pmin) || !compareVectors(got.Pmax, tt.want.Pmax) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestMetaballsEmpty(t *testing.T) {
+	for i, s := range []*ImplicitSurface{NewMetaballs(nil, 0.5, nil), NewBlobs(nil, 0.5, nil)} {
+		if got := s.Bound(ScaleUniform(1)); got != (AABB{}) {
+			t.Errorf("%d) got bounds %v want empty", i, got)
+		}
+		if _, ok := s.Intersect(NewRay(Vector{0, 0, 5}, Vector{0, 0, -1})); ok {
+			t.Errorf("%d) expected no hit", i)
+		}
+	}
+}
+
+func TestImplicitSurfaceInBVH(t *testing.T) {
+	var objects []Object
+	for i := 0; i < 10; i++ {
+		c := Vector{float32(5 * i), 0, 0}
+		objects = append(objects, NewMetaballs([]Metaball{{Center: c, Radius: 2, Strength: 1}}, 0.125, nil))
+	}
+	bvh := NewBVH(objects, SplitSurfaceAreaHeuristic)
+	si, ok := bvh.ClosestIntersection(NewRay(Vector{20, 0, 10}, Vector{0, 0, -1}), MAX_RAY_DISTANCE)
+	if !ok || !compareFloat32(si.distance, 10-float32(math.Sqrt2)) {
+		t.Fatalf("got hit %v want distance %f", si, 10-math.Sqrt2)
+	}
+}
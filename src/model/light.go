@@ -1,11 +1,64 @@
 package model
 
-import "math"
+import (
+	"math"
+	"math/rand"
+)
 
+// A Light illuminates the scene. Every tracer can use every light:
+// delta lights such as point and distant lights can only be found by
+// sampling them, area lights also by a ray hitting their surface
 type Light interface {
-	Intensity(distance float32) float32
-	Color() Color
-	GetLightSegment(p Vector) Vector
+	// SampleLi samples light arriving at point p. It returns the radiance
+	// arriving at p, the segment from p to the sampled point on the light
+	// and the pdf of the sample with respect to solid angle. For delta
+	// lights the pdf is 1 and the radiance is the irradiance at p.
+	// A pdf of 0 means no light arrives at p
+	SampleLi(random *rand.Rand, p Vector) (Color, Vector, float32)
+	// SampleLe samples a ray leaving the light, for tracing photons and
+	// light subpaths. It returns the ray, the normal at its origin (zero if
+	// the light has no surface), the emitted radiance and the area density
+	// of the origin and solid angle density of the direction
+	SampleLe(random *rand.Rand) (Ray, Vector, Color, float32, float32)
+	// PdfLe returns the densities SampleLe would have for a ray leaving
+	// in direction w from a point with normal n. Delta distributions have
+	// a density of 0: pbrt 734
+	PdfLe(w, n Vector) (float32, float32)
+	IsDelta() bool
+	// IsInfinite reports whether the light is infinitely far away, so that
+	// the rays leaving it are parallel
+	IsInfinite() bool
+	// Power returns the total power the light emits as luminance, used to
+	// choose lights in proportion to how much light they add to the scene
+	Power() float32
+}
+
+// lights that depend on the extent of the scene, set up in Precompute
+type preprocessor interface {
+	preprocess(bounds AABB) Light
+}
+
+// lights emitting from a single point with an intensity that depends on
+// the direction w leaving the light, such as spot lights
+type pointEmitter interface {
+	Light
+	radiantIntensity(w Vector) Color
+}
+
+// SampleLi of a pointEmitter at origin: intensity falls off with the
+// square of the distance
+func pointLi(l pointEmitter, origin, p Vector) (Color, Vector, float32) {
+	segment := VectorFromTo(p, origin)
+	dist2 := segment.Dot(segment)
+	return l.radiantIntensity(segment.Times(-1).Normalize()).Times(1 / dist2), segment, 1
+}
+
+// An Emitter is a primitive with a RadiantMaterial that can be sampled
+// uniformly by area for direct light sampling
+type Emitter interface {
+	Object
+	Sample(random *rand.Rand) Vector
+	SurfaceArea() float32
 }
 
 type light struct {
@@ -17,6 +70,14 @@ func (l light) Color() Color {
 	return l.color
 }
 
+func (light) IsDelta() bool {
+	return true
+}
+
+func (light) IsInfinite() bool {
+	return false
+}
+
 type PointLight struct {
 	light
 	origin Vector
@@ -32,17 +93,133 @@ func NewPointLight(o Vector, c Color, i float32) PointLight {
 	}
 }
 
-func (l PointLight) Intensity(r float32) float32 {
-	return l.intensity / (4 * math.Pi * r * r)
+// intensity is the power of the light, emitted equally in all directions
+func (l PointLight) radiantIntensity(w Vector) Color {
+	return l.color.Times(l.intensity / (4 * math.Pi))
+}
+
+func (l PointLight) SampleLi(random *rand.Rand, p Vector) (Color, Vector, float32) {
+	return pointLi(l, l.origin, p)
+}
+
+func (l PointLight) SampleLe(random *rand.Rand) (Ray, Vector, Color, float32, float32) {
+	ray := NewRay(l.origin, uniformSampleSphere(random))
+	return ray, Vector{}, l.radiantIntensity(ray.Direction), 1, 1 / (4 * math.Pi)
+}
+
+func (l PointLight) PdfLe(w, n Vector) (float32, float32) {
+	return 0, 1 / (4 * math.Pi)
+}
+
+func (l PointLight) Power() float32 {
+	return l.color.Luminance() * l.intensity
 }
 
-func (l PointLight) GetLightSegment(p Vector) Vector {
-	return VectorFromTo(p, l.origin)
+func (l PointLight) lightBounds() lightBounds {
+	return lightBounds{
+		bounds:    NewAABB(l.origin, l.origin),
+		phi:       l.Power(),
+		w:         Vector{0, 0, 1},
+		cosThetaO: -1,
+		cosThetaE: 0,
+	}
+}
+
+// A SpotLight is a point light shining in a cone around its direction:
+// at full intensity up to falloffAngle from its axis, fading to nothing
+// at coneAngle. Angles are in radians: pbrt 721
+type SpotLight struct {
+	light
+	origin    Vector
+	direction Vector
+	// cosines of the cone and falloff angles
+	cosTotal, cosFalloff float32
+}
+
+// NewSpotLight with intensity i is as bright as a PointLight with
+// intensity i inside its falloff angle
+func NewSpotLight(o, direction Vector, c Color, i float32, coneAngle, falloffAngle float64) SpotLight {
+	if falloffAngle > coneAngle {
+		falloffAngle = coneAngle
+	}
+	return SpotLight{
+		origin:     o,
+		direction:  direction.Normalize(),
+		cosTotal:   float32(math.Cos(coneAngle)),
+		cosFalloff: float32(math.Cos(falloffAngle)),
+		light: light{
+			color:     c,
+			intensity: i,
+		},
+	}
+}
+
+// smooth falloff from the falloff angle to the edge of the cone
+func (l SpotLight) falloff(w Vector) float32 {
+	cos := w.Dot(l.direction)
+	if cos < l.cosTotal {
+		return 0
+	}
+	if cos >= l.cosFalloff {
+		return 1
+	}
+	delta := (cos - l.cosTotal) / (l.cosFalloff - l.cosTotal)
+	return (delta * delta) * (delta * delta)
+}
+
+func (l SpotLight) radiantIntensity(w Vector) Color {
+	return l.color.Times(l.intensity / (4 * math.Pi) * l.falloff(w))
+}
+
+func (l SpotLight) SampleLi(random *rand.Rand, p Vector) (Color, Vector, float32) {
+	li, segment, pdf := pointLi(l, l.origin, p)
+	if li.MaxComponent() == 0 {
+		return li, segment, 0
+	}
+	return li, segment, pdf
+}
+
+// directions are sampled uniformly within the cone
+func (l SpotLight) SampleLe(random *rand.Rand) (Ray, Vector, Color, float32, float32) {
+	ray := NewRay(l.origin, uniformSampleCone(random, l.direction, float64(l.cosTotal)))
+	return ray, Vector{}, l.radiantIntensity(ray.Direction), 1, l.conePDF()
+}
+
+func (l SpotLight) PdfLe(w, n Vector) (float32, float32) {
+	if w.Dot(l.direction) < l.cosTotal {
+		return 0, 0
+	}
+	return 0, l.conePDF()
+}
+
+func (l SpotLight) conePDF() float32 {
+	return 1 / (2 * math.Pi * (1 - l.cosTotal))
+}
+
+// power inside the cone, approximating the falloff as linear: pbrt 723
+func (l SpotLight) Power() float32 {
+	i := l.color.Luminance() * l.intensity / (4 * math.Pi)
+	return i * 2 * math.Pi * (1 - (l.cosFalloff+l.cosTotal)/2)
+}
+
+// the bound is the power of a point light of the same intensity, the
+// cone takes care of where it goes
+func (l SpotLight) lightBounds() lightBounds {
+	return lightBounds{
+		bounds:    NewAABB(l.origin, l.origin),
+		phi:       l.color.Luminance() * l.intensity,
+		w:         l.direction,
+		cosThetaO: l.cosFalloff,
+		cosThetaE: float32(math.Cos(safeAcos(l.cosTotal) - safeAcos(l.cosFalloff))),
+	}
 }
 
 type DistantLight struct {
 	light
 	direction Vector
+	// bounding sphere of the scene, which SampleLe shoots rays into
+	center Vector
+	radius float32
 }
 
 func NewDistantLight(d Vector, c Color, i float32) DistantLight {
@@ -58,10 +235,267 @@ func NewDistantLight(d Vector, c Color, i float32) DistantLight {
 	}
 }
 
-func (l DistantLight) Intensity(r float32) float32 {
-	return l.intensity
+func (l DistantLight) SampleLi(random *rand.Rand, p Vector) (Color, Vector, float32) {
+	return l.color.Times(l.intensity), l.direction.Times(MAX_RAY_DISTANCE), 1
+}
+
+// parallel rays from a disk just outside the scene, covering all of it
+func (l DistantLight) SampleLe(random *rand.Rand) (Ray, Vector, Color, float32, float32) {
+	u, v := coordinateSystem(l.direction)
+	x, y := uniformSampleDisk(random)
+	disk := l.center.Add(u.Times(x * l.radius)).Add(v.Times(y * l.radius))
+	ray := NewRay(disk.Add(l.direction.Times(l.radius)), l.direction.Times(-1))
+	pdfPos := 1 / (math.Pi * l.radius * l.radius)
+	return ray, Vector{}, l.color.Times(l.intensity), pdfPos, 1
+}
+
+func (l DistantLight) PdfLe(w, n Vector) (float32, float32) {
+	return 1 / (math.Pi * l.radius * l.radius), 0
+}
+
+// power arriving on a disk covering the scene
+func (l DistantLight) IsInfinite() bool {
+	return true
+}
+
+func (l DistantLight) Power() float32 {
+	return l.color.Luminance() * l.intensity * math.Pi * l.radius * l.radius
+}
+
+func (l DistantLight) preprocess(bounds AABB) Light {
+	l.center = bounds.Pmin.Add(bounds.Pmax).Times(0.5)
+	l.radius = VectorFromTo(l.center, bounds.Pmax).Length()
+	return l
+}
+
+// An AreaLight is an emitter found among the scene's objects by
+// Precompute, placed in world space by the instances it is part of.
+// Emission is along the surface normal, unless its RadiantMaterial is
+// two-sided
+type AreaLight struct {
+	shape    Emitter
+	toWorld  Transform
+	toObject Transform
+	area     float32
+	twoSided bool
+	// luminance of the emitted radiance, averaged over the surface
+	luminance float32
+	// spheres are sampled by the solid angle they cover, in world space
+	sphere bool
+	center Vector
+	radius float32
+}
+
+// number of points averaged to estimate the radiance of an area light
+const AREA_LIGHT_POWER_SAMPLES = 16
+
+func newAreaLight(random *rand.Rand, shape Emitter, toWorld Transform) *AreaLight {
+	l := &AreaLight{
+		shape:    shape,
+		toWorld:  toWorld,
+		toObject: toWorld.Inverse(),
+		twoSided: twoSidedEmitter(shape.GetMaterial()),
+	}
+	// exact for transforms that scale uniformly
+	det := math.Abs(float64(toWorld.m.determinant()))
+	switch t := shape.(type) {
+	case Triangle:
+		l.area = triangleSurfaceArea(toWorld.Point(t.P0), toWorld.Point(t.P1), toWorld.Point(t.P2))
+	case TriangleInMesh:
+		p0, p1, p2 := t.Points()
+		l.area = triangleSurfaceArea(toWorld.Point(p0), toWorld.Point(p1), toWorld.Point(p2))
+	case Sphere:
+		l.sphere = true
+		l.center = toWorld.Point(t.Center)
+		l.radius = t.Radius * float32(math.Cbrt(det))
+		l.area = 4 * math.Pi * l.radius * l.radius
+	default:
+		l.area = shape.SurfaceArea() * float32(math.Pow(det, 2.0/3.0))
+	}
+	for i := 0; i < AREA_LIGHT_POWER_SAMPLES; i++ {
+		_, _, le := l.sample(random)
+		l.luminance += le.Luminance() / AREA_LIGHT_POWER_SAMPLES
+	}
+	return l
+}
+
+// twoSidedEmitter reports whether emitters with material m emit from
+// both sides of their surface
+func twoSidedEmitter(m Material) bool {
+	mat, ok := m.(*RadiantMaterial)
+	return ok && mat.TwoSided
+}
+
+// emittedRadiance is the radiance leaving the emitter hit by si in
+// direction wo, black from the back of one-sided emitters
+func emittedRadiance(si *SurfaceInteraction, wo Vector) Color {
+	if !twoSidedEmitter(si.object.GetMaterial()) && si.normal.Dot(wo) <= 0 {
+		return Color{}
+	}
+	return si.object.GetColor(si)
+}
+
+// sample returns a uniformly sampled point on the light in world space,
+// its normal and the radiance it emits
+func (l *AreaLight) sample(random *rand.Rand) (Vector, Vector, Color) {
+	p := l.shape.Sample(random)
+	n := l.shape.SurfaceNormal(p)
+	return l.toWorld.Point(p), l.toWorld.Normal(n).Normalize(), l.emission(p, n)
+}
+
+// emission at point p with normal n in object space, where textures
+// find their uv coordinates
+func (l *AreaLight) emission(p, n Vector) Color {
+	return l.shape.GetColor(NewSurfaceInteraction(l.shape, 0, n, Ray{Origin: p}))
+}
+
+// cosine between normal n and direction w leaving the light, negative if
+// the light does not emit towards w
+func (l *AreaLight) cos(n, w Vector) float32 {
+	cos := n.Dot(w)
+	if l.twoSided && cos < 0 {
+		return -cos
+	}
+	return cos
+}
+
+func (l *AreaLight) SampleLi(random *rand.Rand, p Vector) (Color, Vector, float32) {
+	if l.sphere && VectorFromTo(l.center, p).Length() > l.radius*(1+ERROR_MARGIN) {
+		return l.sampleSphere(random, p)
+	}
+	q, n, le := l.sample(random)
+	segment := VectorFromTo(p, q)
+	dist := segment.Length()
+	cos := l.cos(n, segment.Times(-1/dist))
+	if cos <= 0 {
+		return Color{}, segment, 0
+	}
+	return le, segment, l.pdf(p, dist, cos)
+}
+
+// sampleSphere samples the cone of directions from p towards a sphere
+// outside of it uniformly, which only finds its visible side: pbrt 840
+func (l *AreaLight) sampleSphere(random *rand.Rand, p Vector) (Color, Vector, float32) {
+	wc := VectorFromTo(p, l.center)
+	dc := float64(wc.Length())
+	wc = wc.Normalize()
+	r := float64(l.radius)
+	sinThetaMax := r / dc
+	cosThetaMax := math.Sqrt(math.Max(0, 1-sinThetaMax*sinThetaMax))
+	cosTheta := 1 - random.Float64()*(1-cosThetaMax)
+	sin2Theta := 1 - cosTheta*cosTheta
+	phi := 2 * math.Pi * random.Float64()
+	// angle alpha at the center of the sphere between the direction to p
+	// and the sampled point
+	ds := dc*cosTheta - math.Sqrt(math.Max(0, r*r-dc*dc*sin2Theta))
+	cosAlpha := (dc*dc + r*r - ds*ds) / (2 * dc * r)
+	sinAlpha := math.Sqrt(math.Max(0, 1-cosAlpha*cosAlpha))
+	u, v := coordinateSystem(wc)
+	n := u.Times(float32(-sinAlpha * math.Cos(phi))).Add(v.Times(float32(-sinAlpha * math.Sin(phi)))).Add(wc.Times(float32(-cosAlpha)))
+	q := l.center.Add(n.Times(l.radius))
+	objectPoint := l.toObject.Point(q)
+	le := l.emission(objectPoint, l.shape.SurfaceNormal(objectPoint))
+	return le, VectorFromTo(p, q), l.conePDF(cosThetaMax)
+}
+
+func (l *AreaLight) conePDF(cosThetaMax float64) float32 {
+	return float32(1 / (2 * math.Pi * (1 - cosThetaMax)))
+}
+
+// emission is cosine weighted, matching a lambertian emitter. Two-sided
+// emitters choose either side with equal probability
+func (l *AreaLight) SampleLe(random *rand.Rand) (Ray, Vector, Color, float32, float32) {
+	q, n, le := l.sample(random)
+	direction := cosineSampleHemisphere(random, n)
+	if l.twoSided && random.Float32() < 0.5 {
+		direction = direction.Times(-1)
+	}
+	_, pdfDir := l.PdfLe(direction, n)
+	return NewRay(q, direction), n, le, 1 / l.area, pdfDir
+}
+
+func (l *AreaLight) PdfLe(w, n Vector) (float32, float32) {
+	if !l.twoSided {
+		return 1 / l.area, cosineHemispherePDF(n, w)
+	}
+	if n.Dot(w) < 0 {
+		n = n.Times(-1)
+	}
+	return 1 / l.area, cosineHemispherePDF(n, w) / 2
+}
+
+func (l *AreaLight) IsDelta() bool {
+	return false
+}
+
+func (l *AreaLight) IsInfinite() bool {
+	return false
+}
+
+// lambertian emission: pbrt 735
+func (l *AreaLight) Power() float32 {
+	if l.twoSided {
+		return 2 * math.Pi * l.area * l.luminance
+	}
+	return math.Pi * l.area * l.luminance
+}
+
+func (l *AreaLight) lightBounds() lightBounds {
+	b := lightBounds{
+		bounds:    l.shape.Bound(l.toWorld),
+		phi:       l.Power(),
+		w:         Vector{0, 0, 1},
+		cosThetaO: -1,
+		cosThetaE: 0,
+		twoSided:  l.twoSided,
+	}
+	switch l.shape.(type) {
+	case Triangle, TriangleInMesh:
+		// flat emitters only emit around their normal, which is the same
+		// everywhere on a triangle
+		b.w = l.toWorld.Normal(l.shape.SurfaceNormal(Vector{})).Normalize()
+		b.cosThetaO = 1
+	case Sphere:
+		r := Vector{l.radius, l.radius, l.radius}
+		b.bounds = NewAABB(l.center.Sub(r), l.center.Add(r))
+	}
+	return b
+}
+
+// solid angle pdf at p of SampleLi returning a point at distance dist
+// where the light's surface has cosine cos with the direction towards p
+func (l *AreaLight) pdf(p Vector, dist, cos float32) float32 {
+	if l.sphere {
+		dc := VectorFromTo(l.center, p).Length()
+		if dc > l.radius*(1+ERROR_MARGIN) {
+			sinThetaMax := float64(l.radius / dc)
+			return l.conePDF(math.Sqrt(math.Max(0, 1-sinThetaMax*sinThetaMax)))
+		}
+	}
+	return dist * dist / (cos * l.area)
+}
+
+// uniform sampling over the unit disk using polar coordinates: pbrt 777
+func uniformSampleDisk(random *rand.Rand) (float32, float32) {
+	r := math.Sqrt(random.Float64())
+	phi := 2 * math.Pi * random.Float64()
+	return float32(r * math.Cos(phi)), float32(r * math.Sin(phi))
+}
+
+// uniform sampling of directions within angle acos(cosMax) around axis:
+// pbrt 781. cosMax is a float64 so that very narrow cones keep precision
+func uniformSampleCone(random *rand.Rand, axis Vector, cosMax float64) Vector {
+	cos := 1 - random.Float64()*(1-cosMax)
+	sin := math.Sqrt(math.Max(0, 1-cos*cos))
+	phi := 2 * math.Pi * random.Float64()
+	u, v := coordinateSystem(axis)
+	return u.Times(float32(sin * math.Cos(phi))).Add(v.Times(float32(sin * math.Sin(phi)))).Add(axis.Times(float32(cos)))
 }
 
-func (l DistantLight) GetLightSegment(p Vector) Vector {
-	return l.direction.Times(MAX_RAY_DISTANCE)
+// uniform sampling over the unit sphere: pbrt 776
+func uniformSampleSphere(random *rand.Rand) Vector {
+	z := 1 - 2*random.Float64()
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := 2 * math.Pi * random.Float64()
+	return Vector{float32(r * math.Cos(phi)), float32(r * math.Sin(phi)), float32(z)}
 }
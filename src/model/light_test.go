@@ -0,0 +1,117 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSpotLight(t *testing.T) {
+	// halfway between falloff and cone angle in cosine
+	cos := (math.Cos(math.Pi/4) + math.Cos(math.Pi/8)) / 2
+	sin := math.Sqrt(1 - cos*cos)
+	l := NewSpotLight(Vector{0, 0, 0}, Vector{0, -1, 0}, NewColor(255, 255, 255), 4*math.Pi, math.Pi/4, math.Pi/8)
+	for i, tt := range []struct {
+		p    Vector
+		want float32
+	}{
+		{p: Vector{0, -2, 0}, want: 0.25},
+		// inside the falloff angle
+		{p: Vector{0.5, -2, 0}, want: 1 / 4.25},
+		{p: Vector{float32(sin), -float32(cos), 0}, want: 0.0625},
+		{p: Vector{2, -1, 0}, want: 0},
+		{p: Vector{0, 2, 0}, want: 0},
+	} {
+		li, _, _ := l.SampleLi(nil, tt.p)
+		if math.Abs(float64(li.r-tt.want)) > 1e-2 {
+			t.Errorf("%d) got %f want %f", i, li.r, tt.want)
+		}
+	}
+	random := rand.New(rand.NewSource(42))
+	n := 10000
+	var sum float64
+	for i := 0; i < n; i++ {
+		ray, _, _, _, pdfDir := l.SampleLe(random)
+		if ray.Direction.Dot(l.direction) < l.cosTotal-1e-4 {
+			t.Fatalf("sampled direction %v outside the cone", ray.Direction)
+		}
+		sum += 1 / float64(pdfDir)
+	}
+	// the expected inverse pdf is the solid angle of the cone
+	want := 2 * math.Pi * (1 - math.Cos(math.Pi/4))
+	if got := sum / float64(n); math.Abs(got-want) > 1e-3 {
+		t.Errorf("got mean inverse pdf %f want %f", got, want)
+	}
+}
+
+func TestAreaLightSphere(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	sphere := NewSphere(Vector{0, 0, 0}, 1, NewRadiantMaterial(NewUVTexture(SphereUVFunc)))
+	l := newAreaLight(random, sphere, Translate(Vector{0, 2, 0}).Mul(ScaleUniform(2)))
+	if math.Abs(float64(l.area-16*math.Pi)) > 1e-3 {
+		t.Fatalf("got area %f want %f", l.area, 16*math.Pi)
+	}
+	p := Vector{0, 2, -4}
+	n := 10000
+	var sum float64
+	for i := 0; i < n; i++ {
+		li, segment, pdf := l.SampleLi(random, p)
+		q := p.Add(segment)
+		normal := VectorFromTo(l.center, q).Times(1 / l.radius)
+		if math.Abs(float64(normal.Length()-1)) > 1e-3 || normal.Dot(segment) >= 0 {
+			t.Fatalf("sampled %v not on the visible side of the sphere", q)
+		}
+		// the texture is looked up at the point on the untransformed sphere
+		u, v := equirectangularUV(normal)
+		if math.Abs(float64(li.r-u)) > 1e-3 || math.Abs(float64(li.g-(1-v))) > 1e-3 {
+			t.Fatalf("got radiance %v at %v want uv %f %f", li, normal, u, 1-v)
+		}
+		dist := segment.Length()
+		if got := l.pdf(p, dist, normal.Dot(segment.Times(-1/dist))); got != pdf {
+			t.Fatalf("got pdf %f want %f", got, pdf)
+		}
+		sum += 1 / float64(pdf)
+	}
+	// the expected inverse pdf is the solid angle of the sphere seen from p
+	want := 2 * math.Pi * (1 - math.Sqrt(1-0.25))
+	if got := sum / float64(n); math.Abs(got-want) > 1e-3 {
+		t.Errorf("got mean inverse pdf %f want %f", got, want)
+	}
+}
+
+func TestAreaLightTwoSided(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	for i, tt := range []struct {
+		twoSided bool
+		power    float32
+	}{
+		{twoSided: false, power: 0.5 * math.Pi},
+		{twoSided: true, power: math.Pi},
+	} {
+		material := NewRadiantMaterial(NewConstantTexture(NewColor(255, 255, 255)))
+		material.TwoSided = tt.twoSided
+		triangle := NewTriangle(Vector{0, 0, 0}, Vector{1, 0, 1}, Vector{1, 0, 0}, material)
+		l := newAreaLight(random, triangle, identity)
+		if got := l.Power(); math.Abs(float64(got-tt.power)) > 1e-4 {
+			t.Errorf("%d) got power %f want %f", i, got, tt.power)
+		}
+		n := triangle.SurfaceNormal(Vector{})
+		_, _, pdf := l.SampleLi(random, n.Times(-1))
+		if got := pdf > 0; got != tt.twoSided {
+			t.Errorf("%d) got light arriving behind the triangle %t", i, got)
+		}
+		var behind int
+		for j := 0; j < 1000; j++ {
+			ray, normal, _, _, pdfDir := l.SampleLe(random)
+			if ray.Direction.Dot(normal) < 0 {
+				behind++
+			}
+			if _, got := l.PdfLe(ray.Direction, normal); math.Abs(float64(got-pdfDir)) > 1e-4 {
+				t.Errorf("%d) got pdf %f want %f", i, got, pdfDir)
+			}
+		}
+		if tt.twoSided != (behind > 400) || (tt.twoSided && behind > 600) {
+			t.Errorf("%d) %d of 1000 rays leave behind the triangle", i, behind)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package model
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Light BVH: Conty Estevez and Kulla 2018, "Importance Sampling of Many
+// Lights with Adaptive Tree Splitting", as in pbrt-v4 12.6.3.
+// Lights are grouped by position and emission direction; sampling walks
+// down the tree choosing a child by its estimated importance to the
+// point being lit. Lights without bounds, such as distant lights, are
+// sampled separately.
+
+// lightBounds bound the emission of one or more lights: all of it comes
+// from within bounds, leaving in directions within angle thetaE of a
+// cone of normals with angle thetaO around w
+type lightBounds struct {
+	bounds AABB
+	// total power, or a conservative estimate
+	phi                  float32
+	w                    Vector
+	cosThetaO, cosThetaE float32
+	// emitting on both sides of the normals
+	twoSided bool
+}
+
+// lights that can be placed in a light BVH
+type boundedLight interface {
+	lightBounds() lightBounds
+}
+
+// unionLightBounds bounds the emission of both a and b
+func unionLightBounds(a, b lightBounds) lightBounds {
+	if a.phi == 0 {
+		return b
+	}
+	if b.phi == 0 {
+		return a
+	}
+	w, cosThetaO := unionDirectionCone(a.w, a.cosThetaO, b.w, b.cosThetaO)
+	return lightBounds{
+		bounds:    a.bounds.AddAABB(b.bounds),
+		phi:       a.phi + b.phi,
+		w:         w,
+		cosThetaO: cosThetaO,
+		cosThetaE: float32(math.Min(float64(a.cosThetaE), float64(b.cosThetaE))),
+		twoSided:  a.twoSided || b.twoSided,
+	}
+}
+
+// unionDirectionCone returns the smallest cone found containing the
+// cones around a and b with cosines of their angles cosA and cosB
+func unionDirectionCone(a Vector, cosA float32, b Vector, cosB float32) (Vector, float32) {
+	thetaA := safeAcos(cosA)
+	thetaB := safeAcos(cosB)
+	thetaD := safeAcos(a.Dot(b))
+	if math.Min(thetaD+thetaB, math.Pi) <= thetaA {
+		return a, cosA
+	}
+	if math.Min(thetaD+thetaA, math.Pi) <= thetaB {
+		return b, cosB
+	}
+	thetaO := (thetaA + thetaD + thetaB) / 2
+	if thetaO >= math.Pi {
+		return a, -1
+	}
+	// rotate a towards b so that the new cone just contains both
+	axis := a.Cross(b)
+	if axis.Dot(axis) == 0 {
+		return a, -1
+	}
+	w := rotateAround(a, axis.Normalize(), thetaO-thetaA)
+	return w, float32(math.Cos(thetaO))
+}
+
+func safeAcos(cos float32) float64 {
+	return math.Acos(math.Max(-1, math.Min(1, float64(cos))))
+}
+
+// rotateAround rotates v by theta radians around unit axis k: Rodrigues
+func rotateAround(v, k Vector, theta float64) Vector {
+	cos, sin := float32(math.Cos(theta)), float32(math.Sin(theta))
+	return v.Times(cos).Add(k.Cross(v).Times(sin)).Add(k.Times(k.Dot(v) * (1 - cos)))
+}
+
+// cosSubClamped returns cos(max(0, a - b)) given sines and cosines of a and b
+func cosSubClamped(sinA, cosA, sinB, cosB float32) float32 {
+	if cosA > cosB {
+		return 1
+	}
+	return cosA*cosB + sinA*sinB
+}
+
+// sinSubClamped returns sin(max(0, a - b)) given sines and cosines of a and b
+func sinSubClamped(sinA, cosA, sinB, cosB float32) float32 {
+	if cosA > cosB {
+		return 0
+	}
+	return sinA*cosB - cosA*sinB
+}
+
+func sinFromCos(cos float32) float32 {
+	return float32(math.Sqrt(math.Max(0, 1-float64(cos*cos))))
+}
+
+// importance estimates the light arriving at p with surface normal n
+// from lights bounded by b; n is zero for points in a medium.
+// Only zero if no light can arrive at p: pbrt-v4 12.6.3
+func (b lightBounds) importance(p, n Vector) float32 {
+	pc := b.bounds.Centroid()
+	d2 := VectorFromTo(pc, p).Dot(VectorFromTo(pc, p))
+	// avoid the singularity for points close to or inside the bounds
+	d2 = float32(math.Max(float64(d2), float64(VectorFromTo(b.bounds.Pmin, b.bounds.Pmax).Length()/2)))
+	wi := VectorFromTo(pc, p).Normalize()
+	cosThetaW := b.w.Dot(wi)
+	if b.twoSided {
+		cosThetaW = float32(math.Abs(float64(cosThetaW)))
+	}
+	sinThetaW := sinFromCos(cosThetaW)
+	// cone of directions from p to the bounds
+	cosThetaB := boundSubtendedCos(b.bounds, p)
+	sinThetaB := sinFromCos(cosThetaB)
+	// minimum angle between the emission cone and the direction to p
+	sinThetaO := sinFromCos(b.cosThetaO)
+	cosThetaX := cosSubClamped(sinThetaW, cosThetaW, sinThetaO, b.cosThetaO)
+	sinThetaX := sinSubClamped(sinThetaW, cosThetaW, sinThetaO, b.cosThetaO)
+	cosThetaP := cosSubClamped(sinThetaX, cosThetaX, sinThetaB, cosThetaB)
+	if cosThetaP <= b.cosThetaE {
+		return 0
+	}
+	importance := b.phi * cosThetaP / d2
+	if n != (Vector{}) {
+		cosThetaI := float32(math.Abs(float64(wi.Dot(n))))
+		sinThetaI := sinFromCos(cosThetaI)
+		importance *= cosSubClamped(sinThetaI, cosThetaI, sinThetaB, cosThetaB)
+	}
+	return float32(math.Max(0, float64(importance)))
+}
+
+// boundSubtendedCos returns the cosine of the angle of the cone from p
+// containing a bounding sphere of b, -1 if p is inside it
+func boundSubtendedCos(b AABB, p Vector) float32 {
+	center := b.Centroid()
+	radius := VectorFromTo(center, b.Pmax).Length()
+	d := VectorFromTo(p, center)
+	dist2 := d.Dot(d)
+	if dist2 < radius*radius {
+		return -1
+	}
+	sin2 := radius * radius / dist2
+	return float32(math.Sqrt(math.Max(0, 1-float64(sin2))))
+}
+
+// orientation and surface area heuristic cost of a node: pbrt-v4 12.6.3
+func (b lightBounds) cost(bounds AABB, dim Dimension) float32 {
+	thetaO := safeAcos(b.cosThetaO)
+	thetaE := safeAcos(b.cosThetaE)
+	thetaW := math.Min(thetaO+thetaE, math.Pi)
+	sinThetaO := math.Sin(thetaO)
+	mOmega := 2*math.Pi*(1-math.Cos(thetaO)) +
+		math.Pi/2*(2*thetaW*sinThetaO-math.Cos(thetaO-2*thetaW)-2*thetaO*sinThetaO+math.Cos(thetaO))
+	// favour splitting along the longest axis
+	diagonal := VectorFromTo(bounds.Pmin, bounds.Pmax)
+	kr := float32(1)
+	if d := diagonal.Get(dim); d > 0 {
+		kr = diagonal.Get(bounds.MaximumExtent()) / d
+	}
+	return b.phi * float32(mOmega) * kr * b.bounds.SurfaceArea()
+}
+
+type lightBVHNode struct {
+	lightBounds
+	// index of the second child for interior nodes, the first child
+	// directly follows its parent. Index into lights for leaves
+	index int
+	leaf  bool
+}
+
+// bvhLightSampler chooses lights by their importance to the point lit
+type bvhLightSampler struct {
+	lights []Light
+	// lights without bounds, chosen uniformly
+	infinite []Light
+	nodes    []lightBVHNode
+	// path from the root to the leaf of each bounded light, one bit per
+	// level: 0 for the first child and 1 for the second
+	trails map[Light]uint64
+}
+
+func newBVHLightSampler(lights []Light) *bvhLightSampler {
+	s := &bvhLightSampler{lights: lights, trails: map[Light]uint64{}}
+	var bounded []int
+	var bounds []lightBounds
+	for i, l := range lights {
+		b, ok := l.(boundedLight)
+		if !ok {
+			s.infinite = append(s.infinite, l)
+			continue
+		}
+		lb := b.lightBounds()
+		// lights that emit nothing are never chosen
+		if lb.phi > 0 {
+			bounded = append(bounded, i)
+			bounds = append(bounds, lb)
+		}
+	}
+	if len(bounded) > 0 {
+		s.build(bounded, bounds, 0, 0)
+	}
+	return s
+}
+
+// build adds a subtree for the given lights and returns its bounds;
+// trail and depth describe the path from the root to the subtree. Deep
+// down lopsided splits, lights are split in the middle so that every
+// trail fits in 64 bits
+func (s *bvhLightSampler) build(lights []int, bounds []lightBounds, trail uint64, depth uint) lightBounds {
+	if len(lights) == 1 {
+		s.nodes = append(s.nodes, lightBVHNode{lightBounds: bounds[0], index: lights[0], leaf: true})
+		s.trails[s.lights[lights[0]]] = trail
+		return bounds[0]
+	}
+	var all lightBounds
+	var centroidBounds AABB
+	for i, b := range bounds {
+		all = unionLightBounds(all, b)
+		if i == 0 {
+			centroidBounds = NewAABB(b.bounds.Centroid(), b.bounds.Centroid())
+		} else {
+			centroidBounds = centroidBounds.AddPoint(b.bounds.Centroid())
+		}
+	}
+	mid := len(lights) / 2
+	// splitting in the middle from here on takes this many more levels;
+	// the trail has no bits for levels past 64
+	if depth+uint(bits.Len(uint(len(lights)-1))) < 64 {
+		mid = splitLights(lights, bounds, all.bounds, centroidBounds)
+	}
+	node := len(s.nodes)
+	s.nodes = append(s.nodes, lightBVHNode{})
+	b0 := s.build(lights[:mid], bounds[:mid], trail, depth+1)
+	s.nodes[node].index = len(s.nodes)
+	b1 := s.build(lights[mid:], bounds[mid:], trail|1<<depth, depth+1)
+	s.nodes[node].lightBounds = unionLightBounds(b0, b1)
+	return s.nodes[node].lightBounds
+}
+
+// splitLights partitions lights and their bounds around the split
+// minimizing the orientation and surface area heuristic, and returns the
+// index of the first light after the split
+func splitLights(lights []int, bounds []lightBounds, all, centroidBounds AABB) int {
+	n := len(bounds)
+	type bucket struct {
+		lightBounds
+		count int
+	}
+	minCost := float32(math.MaxFloat32)
+	minDim, minBucket := Dimension(-1), -1
+	for _, dim := range []Dimension{X, Y, Z} {
+		if centroidBounds.Pmax.Get(dim) == centroidBounds.Pmin.Get(dim) {
+			continue
+		}
+		var buckets [nBuckets]bucket
+		for _, b := range bounds {
+			i := lightBucket(b, centroidBounds, dim)
+			buckets[i].lightBounds = unionLightBounds(buckets[i].lightBounds, b)
+			buckets[i].count++
+		}
+		for i := 0; i < nBuckets-1; i++ {
+			var below, above lightBounds
+			for j := 0; j <= i; j++ {
+				below = unionLightBounds(below, buckets[j].lightBounds)
+			}
+			for j := i + 1; j < nBuckets; j++ {
+				above = unionLightBounds(above, buckets[j].lightBounds)
+			}
+			if below.phi == 0 || above.phi == 0 {
+				continue
+			}
+			if cost := below.cost(all, dim) + above.cost(all, dim); cost < minCost {
+				minCost, minDim, minBucket = cost, dim, i
+			}
+		}
+	}
+	if minBucket == -1 {
+		// all centroids coincide: split in the middle
+		return n / 2
+	}
+	mid := 0
+	for i := range bounds {
+		if lightBucket(bounds[i], centroidBounds, minDim) <= minBucket {
+			bounds[i], bounds[mid] = bounds[mid], bounds[i]
+			lights[i], lights[mid] = lights[mid], lights[i]
+			mid++
+		}
+	}
+	return mid
+}
+
+func lightBucket(b lightBounds, centroidBounds AABB, dim Dimension) int {
+	i := int(float32(nBuckets) * centroidBounds.Offset(b.bounds.Centroid()).Get(dim))
+	if i >= nBuckets {
+		i = nBuckets - 1
+	}
+	return i
+}
+
+// infinite lights are chosen with the same probability as the tree
+func (s *bvhLightSampler) pInfinite() float32 {
+	n := len(s.infinite)
+	if n == 0 {
+		return 0
+	}
+	if len(s.nodes) > 0 {
+		return float32(n) / float32(n+1)
+	}
+	return 1
+}
+
+func (s *bvhLightSampler) sample(u float32, p, n Vector) (Light, float32) {
+	if len(s.nodes) == 0 && len(s.infinite) == 0 {
+		return nil, 0
+	}
+	pInfinite := s.pInfinite()
+	if u < pInfinite {
+		i := int(u / pInfinite * float32(len(s.infinite)))
+		if i >= len(s.infinite) {
+			i = len(s.infinite) - 1
+		}
+		return s.infinite[i], pInfinite / float32(len(s.infinite))
+	}
+	if len(s.nodes) == 0 {
+		return nil, 0
+	}
+	u = remap(u, pInfinite, 1)
+	pmf := 1 - pInfinite
+	i := 0
+	for {
+		node := s.nodes[i]
+		if node.leaf {
+			// a single light is always chosen, however unimportant
+			if i > 0 || node.importance(p, n) > 0 {
+				return s.lights[node.index], pmf
+			}
+			return nil, 0
+		}
+		i0 := s.nodes[i+1].importance(p, n)
+		i1 := s.nodes[node.index].importance(p, n)
+		if i0 == 0 && i1 == 0 {
+			return nil, 0
+		}
+		p0 := i0 / (i0 + i1)
+		if u < p0 {
+			i++
+			u = remap(u, 0, p0)
+			pmf *= p0
+		} else {
+			i = node.index
+			u = remap(u, p0, 1)
+			pmf *= 1 - p0
+		}
+	}
+}
+
+// remap rescales u in [a,b) to [0,1)
+func remap(u, a, b float32) float32 {
+	u = (u - a) / (b - a)
+	if u >= 1 {
+		u = math.Nextafter32(1, 0)
+	}
+	return u
+}
+
+func (s *bvhLightSampler) pmf(p, n Vector, l Light) float32 {
+	trail, ok := s.trails[l]
+	if !ok {
+		for _, inf := range s.infinite {
+			if inf == l {
+				return s.pInfinite() / float32(len(s.infinite))
+			}
+		}
+		return 0
+	}
+	pmf := 1 - s.pInfinite()
+	i := 0
+	for {
+		node := s.nodes[i]
+		if node.leaf {
+			if i > 0 || node.importance(p, n) > 0 {
+				return pmf
+			}
+			return 0
+		}
+		i0 := s.nodes[i+1].importance(p, n)
+		i1 := s.nodes[node.index].importance(p, n)
+		if i0 == 0 && i1 == 0 {
+			return 0
+		}
+		if trail&1 == 0 {
+			pmf *= i0 / (i0 + i1)
+			i++
+		} else {
+			pmf *= i1 / (i0 + i1)
+			i = node.index
+		}
+		trail >>= 1
+	}
+}
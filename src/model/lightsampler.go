@@ -0,0 +1,190 @@
+package model
+
+import "math"
+
+// LightSampling decides how direct light sampling chooses a light
+type LightSampling int
+
+const (
+	// power based sampling, or a light BVH for more than
+	// LIGHT_BVH_THRESHOLD lights
+	DefaultLightSampling LightSampling = iota
+	// every light is equally likely
+	UniformLightSampling
+	// lights are chosen proportional to their power
+	PowerLightSampling
+	// lights are chosen by their estimated contribution to the point
+	// being shaded using a bounding volume hierarchy over the lights
+	BVHLightSampling
+)
+
+// above this many lights DefaultLightSampling uses a light BVH
+const LIGHT_BVH_THRESHOLD = 64
+
+// a lightSampler chooses one of the scene's lights: pbrt-v4 12.6
+type lightSampler interface {
+	// sample chooses a light for the point p with surface normal n, which
+	// is zero for points in a medium, using u in [0,1). It returns the
+	// light and the probability of choosing it, or nil if no light is
+	// expected to contribute at p
+	sample(u float32, p, n Vector) (Light, float32)
+	// pmf returns the probability of sample choosing l
+	pmf(p, n Vector, l Light) float32
+}
+
+func newLightSampler(t LightSampling, lights []Light) lightSampler {
+	switch t {
+	case UniformLightSampling:
+		return uniformLightSampler{lights}
+	case PowerLightSampling:
+		return newPowerLightSampler(lights)
+	case BVHLightSampling:
+		return newBVHLightSampler(lights)
+	}
+	if len(lights) > LIGHT_BVH_THRESHOLD {
+		return newBVHLightSampler(lights)
+	}
+	return newPowerLightSampler(lights)
+}
+
+type uniformLightSampler struct {
+	lights []Light
+}
+
+func (s uniformLightSampler) sample(u float32, p, n Vector) (Light, float32) {
+	if len(s.lights) == 0 {
+		return nil, 0
+	}
+	i := int(u * float32(len(s.lights)))
+	if i >= len(s.lights) {
+		i = len(s.lights) - 1
+	}
+	return s.lights[i], 1 / float32(len(s.lights))
+}
+
+func (s uniformLightSampler) pmf(p, n Vector, l Light) float32 {
+	if len(s.lights) == 0 {
+		return 0
+	}
+	return 1 / float32(len(s.lights))
+}
+
+// powerLightSampler chooses lights proportional to their power,
+// independent of the point being lit
+type powerLightSampler struct {
+	lights []Light
+	alias  *aliasTable
+	index  map[Light]int
+}
+
+func newPowerLightSampler(lights []Light) *powerLightSampler {
+	power := make([]float32, len(lights))
+	index := make(map[Light]int, len(lights))
+	for i, l := range lights {
+		power[i] = l.Power()
+		index[l] = i
+	}
+	return &powerLightSampler{
+		lights: lights,
+		alias:  newAliasTable(power),
+		index:  index,
+	}
+}
+
+func (s *powerLightSampler) sample(u float32, p, n Vector) (Light, float32) {
+	if len(s.lights) == 0 {
+		return nil, 0
+	}
+	i, pmf := s.alias.sample(u)
+	return s.lights[i], pmf
+}
+
+func (s *powerLightSampler) pmf(p, n Vector, l Light) float32 {
+	i, ok := s.index[l]
+	if !ok {
+		return 0
+	}
+	return s.alias.pmf(i)
+}
+
+// aliasTable samples from a discrete distribution in constant time
+// using Walker's alias method: pbrt-v4 A.1
+type aliasTable struct {
+	bins []aliasBin
+}
+
+type aliasBin struct {
+	// probability of choosing this bin's own index instead of its alias
+	q     float32
+	p     float32
+	alias int
+}
+
+// newAliasTable builds a table for weights, which need not be normalized.
+// If all weights are zero every index is equally likely
+func newAliasTable(weights []float32) *aliasTable {
+	n := len(weights)
+	bins := make([]aliasBin, n)
+	var sum float64
+	for _, w := range weights {
+		sum += float64(w)
+	}
+	// scaled probabilities: bins with less than 1 are filled up by an alias
+	scaled := make([]float64, n)
+	var under, over []int
+	for i, w := range weights {
+		p := 1 / float64(n)
+		if sum > 0 {
+			p = float64(w) / sum
+		}
+		bins[i] = aliasBin{p: float32(p), alias: -1}
+		scaled[i] = p * float64(n)
+		if scaled[i] < 1 {
+			under = append(under, i)
+		} else {
+			over = append(over, i)
+		}
+	}
+	for len(under) > 0 && len(over) > 0 {
+		u, o := under[len(under)-1], over[len(over)-1]
+		under, over = under[:len(under)-1], over[:len(over)-1]
+		bins[u].q = float32(scaled[u])
+		bins[u].alias = o
+		// the alias gives away what the under full bin lacked
+		scaled[o] = scaled[o] + scaled[u] - 1
+		if scaled[o] < 1 {
+			under = append(under, o)
+		} else {
+			over = append(over, o)
+		}
+	}
+	// left over bins are full, up to rounding errors
+	for _, i := range append(under, over...) {
+		bins[i].q = 1
+		bins[i].alias = -1
+	}
+	return &aliasTable{bins: bins}
+}
+
+// sample returns an index for u in [0,1) and its probability
+func (t *aliasTable) sample(u float32) (int, float32) {
+	n := len(t.bins)
+	offset := int(u * float32(n))
+	if offset >= n {
+		offset = n - 1
+	}
+	// the remainder of u is uniform within the bin
+	up := u*float32(n) - float32(offset)
+	if up >= 1 {
+		up = math.Nextafter32(1, 0)
+	}
+	if up < t.bins[offset].q {
+		return offset, t.bins[offset].p
+	}
+	alias := t.bins[offset].alias
+	return alias, t.bins[alias].p
+}
+
+func (t *aliasTable) pmf(i int) float32 {
+	return t.bins[i].p
+}
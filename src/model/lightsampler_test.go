@@ -0,0 +1,175 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAliasTable(t *testing.T) {
+	for i, tt := range []struct {
+		weights []float32
+		want    []float32
+	}{
+		{weights: []float32{1, 0, 3, 4}, want: []float32{0.125, 0, 0.375, 0.5}},
+		{weights: []float32{0, 0}, want: []float32{0.5, 0.5}},
+		{weights: []float32{5}, want: []float32{1}},
+	} {
+		table := newAliasTable(tt.weights)
+		n := 10000
+		counts := make([]int, len(tt.weights))
+		for j := 0; j < n; j++ {
+			k, pmf := table.sample((float32(j) + 0.5) / float32(n))
+			if pmf != table.pmf(k) {
+				t.Errorf("%d) sampled %d with pmf %f, want %f", i, k, pmf, table.pmf(k))
+			}
+			counts[k]++
+		}
+		for k, want := range tt.want {
+			if got := table.pmf(k); math.Abs(float64(got-want)) > 1e-6 {
+				t.Errorf("%d) got pmf %f for %d want %f", i, got, k, want)
+			}
+			if got := float32(counts[k]) / float32(n); math.Abs(float64(got-want)) > 1e-3 {
+				t.Errorf("%d) sampled %d with frequency %f want %f", i, k, got, want)
+			}
+		}
+	}
+}
+
+// manyLightsScene is a floor lit by a few large emitters among many tiny
+// ones facing in random directions, like LED strips in a room
+func manyLightsScene(random *rand.Rand, n int, sampling LightSampling) *Scene {
+	scene := NewScene(NewPerspectiveCamera(16, 16, 0.5*math.Pi))
+	scene.LightSampling = sampling
+	floor := NewDiffuseMaterial(NewConstantTexture(NewColor(200, 200, 200)))
+	scene.Add(NewTriangle(Vector{-100, 0, -100}, Vector{100, 0, 100}, Vector{100, 0, -100}, floor))
+	scene.Add(NewTriangle(Vector{-100, 0, -100}, Vector{-100, 0, 100}, Vector{100, 0, 100}, floor))
+	big := NewRadiantMaterial(NewConstantTexture(NewColor(255, 255, 255).Times(10)))
+	for _, x := range []float32{-50, 0, 50} {
+		scene.Add(NewTriangle(Vector{x - 5, 20, -5}, Vector{x + 5, 20, 5}, Vector{x - 5, 20, 5}, big))
+	}
+	small := NewRadiantMaterial(NewConstantTexture(NewColor(255, 200, 100)))
+	for i := 0; i < n; i++ {
+		p := Vector{random.Float32()*200 - 100, random.Float32() * 40, random.Float32()*200 - 100}
+		u, v := coordinateSystem(uniformSampleSphere(random))
+		scene.Add(NewTriangle(p, p.Add(u.Times(0.1)), p.Add(v.Times(0.1)), small))
+	}
+	scene.AddLights(NewSpotLight(Vector{0, 30, 0}, Vector{0, -1, 0}, NewColor(255, 255, 255), 1000, 0.5, 0.3))
+	scene.AddLights(NewDistantLight(Vector{1, -1, 0}, NewColor(255, 255, 255), 0.1))
+	scene.Precompute()
+	return scene
+}
+
+func TestLightSamplers(t *testing.T) {
+	for _, sampling := range []LightSampling{UniformLightSampling, PowerLightSampling, BVHLightSampling} {
+		random := rand.New(rand.NewSource(42))
+		scene := manyLightsScene(random, 500, sampling)
+		for i := 0; i < 20; i++ {
+			p := Vector{random.Float32()*200 - 100, 0, random.Float32()*200 - 100}
+			n := Vector{0, 1, 0}
+			var sum float32
+			for _, l := range scene.lights {
+				sum += scene.lightPMF(p, n, l)
+			}
+			// the light BVH skips lights that cannot reach p
+			if math.Abs(float64(sum-1)) > 1e-3 && (sampling != BVHLightSampling || sum > 1) {
+				t.Errorf("%d) pmfs at %v sum to %f", sampling, p, sum)
+			}
+			for j := 0; j < 100; j++ {
+				l, pmf := scene.sampleLight(random, p, n)
+				if l == nil {
+					continue
+				}
+				if want := scene.lightPMF(p, n, l); math.Abs(float64(pmf-want)) > 1e-4*float64(want) {
+					t.Errorf("%d) sampled light with pmf %f want %f", sampling, pmf, want)
+				}
+			}
+		}
+	}
+}
+
+// lights that emit nothing are left out of the light BVH, which can leave
+// it with nothing to choose from
+func TestLightSamplersWithoutPower(t *testing.T) {
+	for i, tt := range []struct {
+		sampling LightSampling
+		n        int
+	}{
+		{sampling: BVHLightSampling, n: 1},
+		{sampling: DefaultLightSampling, n: LIGHT_BVH_THRESHOLD + 1},
+	} {
+		var lights []Light
+		for j := 0; j < tt.n; j++ {
+			lights = append(lights, NewPointLight(Vector{float32(j), 10, 0}, NewColor(255, 255, 255), 0))
+		}
+		s := newLightSampler(tt.sampling, lights)
+		p, n := Vector{0, 0, 0}, Vector{0, 1, 0}
+		if l, pmf := s.sample(0.5, p, n); l != nil || pmf != 0 {
+			t.Errorf("%d) got light %v with pmf %f want none", i, l, pmf)
+		}
+		if pmf := s.pmf(p, n, lights[0]); pmf != 0 {
+			t.Errorf("%d) got pmf %f want 0", i, pmf)
+		}
+	}
+}
+
+// trails have a bit per level, so starting 60 levels down the 16 lights
+// have to fit in the 4 levels left
+func TestLightBVHDepth(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	s := &bvhLightSampler{trails: map[Light]uint64{}}
+	var indices []int
+	var bounds []lightBounds
+	for i := 0; i < 16; i++ {
+		p := Vector{random.Float32() * 100, random.Float32() * 100, random.Float32() * 100}
+		l := NewPointLight(p, NewColor(255, 255, 255), 1)
+		s.lights = append(s.lights, l)
+		indices = append(indices, i)
+		bounds = append(bounds, l.lightBounds())
+	}
+	s.build(indices, bounds, 0, 60)
+	seen := map[uint64]bool{}
+	for _, l := range s.lights {
+		trail := s.trails[l]
+		if seen[trail] {
+			t.Fatalf("lights share trail %b", trail)
+		}
+		seen[trail] = true
+	}
+}
+
+// direct light from all lights at points on the floor, ignoring
+// occlusion; reports the variance of a single sample estimate
+func benchmarkManyLights(b *testing.B, n int, sampling LightSampling) {
+	random := rand.New(rand.NewSource(42))
+	scene := manyLightsScene(random, n, sampling)
+	normal := Vector{0, 1, 0}
+	b.ResetTimer()
+	var sum, sum2 float64
+	for i := 0; i < b.N; i++ {
+		p := Vector{random.Float32()*160 - 80, 0, random.Float32()*160 - 80}
+		var estimate float64
+		if l, pmf := scene.sampleLight(random, p, normal); l != nil {
+			li, segment, pdf := l.SampleLi(random, p)
+			if cos := normal.Dot(segment.Normalize()); pdf > 0 && cos > 0 {
+				estimate = float64(li.Luminance() * cos / (pdf * pmf))
+			}
+		}
+		sum += estimate
+		sum2 += estimate * estimate
+	}
+	mean := sum / float64(b.N)
+	b.ReportMetric(sum2/float64(b.N)-mean*mean, "variance")
+}
+
+func BenchmarkManyLightsUniform(b *testing.B) {
+	benchmarkManyLights(b, 5000, UniformLightSampling)
+}
+
+func BenchmarkManyLightsPower(b *testing.B) {
+	benchmarkManyLights(b, 5000, PowerLightSampling)
+}
+
+func BenchmarkManyLightsBVH(b *testing.B) {
+	benchmarkManyLights(b, 5000, BVHLightSampling)
+}
@@ -12,11 +12,18 @@ import (
 type Material interface {
 	IsLight() bool
 	Sample(r *rand.Rand, normal Vector) Vector
+	// probability density (over solid angle) of Sample returning direction
+	PDF(normal, direction Vector) float32
 	GetColor(si *SurfaceInteraction) Color
 }
 
 type material struct {
 	texture Texture
+	// if set, the surface is cut out where the luminance of Opacity is
+	// below AlphaThreshold, or if that is 0, let through at random where
+	// it is less than 1. See NewImageAlphaTexture
+	Opacity        Texture
+	AlphaThreshold float32
 }
 
 func (material) IsLight() bool {
@@ -29,7 +36,11 @@ func (m material) GetColor(si *SurfaceInteraction) Color {
 
 // default sampling for all material right now is the same
 func (material) Sample(r *rand.Rand, normal Vector) Vector {
-	return randomInHemisphere(r, normal)
+	return cosineSampleHemisphere(r, normal)
+}
+
+func (material) PDF(normal, direction Vector) float32 {
+	return cosineHemispherePDF(normal, direction)
 }
 
 // this is actually slower than the very naive method before..
@@ -51,6 +62,27 @@ func randomInHemisphere(random *rand.Rand, normal Vector) Vector {
 	return Rotate(theta, rotationVector).Vector(v)
 }
 
+// cosine-weighted hemisphere sampling: pbrt 780
+// uses Malley's method: sample a unit disk uniformly and project up
+// pdf is cos(theta) / pi which cancels against the lambertian brdf
+func cosineSampleHemisphere(random *rand.Rand, normal Vector) Vector {
+	x, y := uniformSampleDisk(random)
+	var z float32
+	if det := 1 - x*x - y*y; det > 0 {
+		z = float32(math.Sqrt(float64(det)))
+	}
+	s, t := coordinateSystem(normal)
+	return s.Times(x).Add(t.Times(y)).Add(normal.Times(z))
+}
+
+func cosineHemispherePDF(normal, direction Vector) float32 {
+	cos := normal.Dot(direction)
+	if cos <= 0 {
+		return 0
+	}
+	return cos * INVPI
+}
+
 type SurfaceInteraction struct {
 	distance float32
 	ray      Ray
@@ -64,6 +96,10 @@ type SurfaceInteraction struct {
 	// for sharedobjects
 	UntransformedPoint  Vector
 	UntransformedNormal Vector
+	// innermost shared object the hit primitive is part of, if any
+	instance *SharedObject
+	// set once the hit has passed the opacity mask of its material
+	alphaTested bool
 }
 
 func NewSurfaceInteraction(o Object, d float32, n Vector, r Ray) *SurfaceInteraction {
@@ -80,6 +116,31 @@ func NewSurfaceInteraction(o Object, d float32, n Vector, r Ray) *SurfaceInterac
 	}
 }
 
+// differentials returns how the hit point moves in object space when the
+// ray moves one pixel along x and y, by intersecting the offset rays with
+// the tangent plane at the hit: pbrt 10.1.1
+func (si *SurfaceInteraction) differentials() (dpdx, dpdy Vector, ok bool) {
+	d := si.ray.Differential
+	if d == nil {
+		return Vector{}, Vector{}, false
+	}
+	p, n := si.UntransformedPoint, si.UntransformedNormal
+	offset := func(o, dir Vector) (Vector, bool) {
+		cos := n.Dot(dir)
+		if cos == 0 {
+			return Vector{}, false
+		}
+		t := n.Dot(VectorFromTo(o, p)) / cos
+		return VectorFromTo(p, o.Add(dir.Times(t))), true
+	}
+	dpdx, okx := offset(d.RxOrigin, d.RxDirection)
+	dpdy, oky := offset(d.RyOrigin, d.RyDirection)
+	if !okx || !oky {
+		return Vector{}, Vector{}, false
+	}
+	return dpdx, dpdy, true
+}
+
 func (si *SurfaceInteraction) GetNormal() Vector {
 	return si.normal
 }
@@ -102,6 +163,10 @@ func NewDiffuseMaterial(t Texture) *DiffuseMaterial {
 
 type RadiantMaterial struct {
 	material
+	// if set, used instead of the upsampled texture color in spectral mode
+	Emission Spectrum
+	// emit from both sides of the surface instead of only along its normal
+	TwoSided bool
 }
 
 func NewRadiantMaterial(t Texture) *RadiantMaterial {
@@ -112,6 +177,27 @@ func NewRadiantMaterial(t Texture) *RadiantMaterial {
 	}
 }
 
+// NewSpectralRadiantMaterial emits spectrum s times scale,
+// such as a measured light spectrum or a blackbody
+func NewSpectralRadiantMaterial(s Spectrum, scale float32) *RadiantMaterial {
+	emission := scaledSpectrum{s, scale}
+	return &RadiantMaterial{
+		material: material{
+			texture: NewConstantTexture(SpectrumToRGB(emission)),
+		},
+		Emission: emission,
+	}
+}
+
+type scaledSpectrum struct {
+	Spectrum
+	scale float32
+}
+
+func (s scaledSpectrum) Eval(lambda float32) float32 {
+	return s.scale * s.Spectrum.Eval(lambda)
+}
+
 func (*RadiantMaterial) IsLight() bool {
 	return true
 }
@@ -121,18 +207,172 @@ type ReflectiveMaterial struct {
 	Scene *Scene
 }
 
+// a perfect mirror, tinted by its texture
+func NewReflectiveMaterial(t Texture) *ReflectiveMaterial {
+	return &ReflectiveMaterial{
+		material: material{
+			texture: t,
+		},
+	}
+}
+
+// glass, water etc: perfectly smooth and both reflecting and refracting
+// light depending on the fresnel term. texture tints transmitted light
+type DielectricMaterial struct {
+	material
+	IOR float32
+	// index of refraction per wavelength, only used in spectral mode
+	Dispersion Spectrum
+}
+
+func NewDielectricMaterial(t Texture, ior float32) *DielectricMaterial {
+	return &DielectricMaterial{
+		material: material{
+			texture: t,
+		},
+		IOR: ior,
+	}
+}
+
+// NewDispersiveMaterial is a dielectric whose index of refraction varies
+// with wavelength, splitting light into colors in spectral mode.
+// RGB mode uses the index at the sodium d-line
+func NewDispersiveMaterial(t Texture, ior Spectrum) *DielectricMaterial {
+	return &DielectricMaterial{
+		material: material{
+			texture: t,
+		},
+		IOR:        ior.Eval(587.6),
+		Dispersion: ior,
+	}
+}
+
+func mirrorDirection(i, n Vector) Vector {
+	return i.Sub(n.Times(2 * i.Dot(n)))
+}
+
+// refract i through a surface with normal n facing the incoming side,
+// with eta the ratio of indices of refraction etaI / etaT.
+// returns false on total internal reflection: pbrt 531
+func refract(i, n Vector, eta float32) (Vector, bool) {
+	cosI := -n.Dot(i)
+	sin2T := eta * eta * (1 - cosI*cosI)
+	if sin2T >= 1 {
+		return Vector{}, false
+	}
+	cosT := float32(math.Sqrt(float64(1 - sin2T)))
+	return i.Times(eta).Add(n.Times(eta*cosI - cosT)), true
+}
+
+// fresnel reflectance for unpolarized light between dielectrics: pbrt 519
+func fresnelDielectric(cosI, etaI, etaT float32) float32 {
+	if cosI < 0 {
+		etaI, etaT = etaT, etaI
+		cosI = -cosI
+	}
+	sinT := etaI / etaT * float32(math.Sqrt(math.Max(0, float64(1-cosI*cosI))))
+	if sinT >= 1 {
+		return 1
+	}
+	cosT := float32(math.Sqrt(math.Max(0, float64(1-sinT*sinT))))
+	rParl := ((etaT * cosI) - (etaI * cosT)) / ((etaT * cosI) + (etaI * cosT))
+	rPerp := ((etaI * cosI) - (etaT * cosT)) / ((etaI * cosI) + (etaT * cosT))
+	return (rParl*rParl + rPerp*rPerp) / 2
+}
+
+// scatterSpecular handles the perfectly specular materials, returning the
+// scattered direction for a ray arriving in direction d and its tint.
+// returns false if the material at si is not specular
+func scatterSpecular(random *rand.Rand, si *SurfaceInteraction, d Vector) (Vector, Color, bool) {
+	switch mat := si.object.GetMaterial().(type) {
+	case *ReflectiveMaterial:
+		n := si.normal
+		if n.Dot(d) > 0 {
+			n = n.Times(-1)
+		}
+		return mirrorDirection(d, n).Normalize(), mat.GetColor(si), true
+	case *DielectricMaterial:
+		direction, refracted := scatterDielectric(random, si.normal, d, mat.IOR)
+		if refracted {
+			return direction, mat.GetColor(si), true
+		}
+		return direction, NewColor(255, 255, 255), true
+	}
+	return Vector{}, Color{}, false
+}
+
+// scatterDielectric either reflects or refracts direction d at a smooth
+// dielectric with the given index of refraction, choosing by the fresnel
+// term. returns true if the ray was refracted
+func scatterDielectric(random *rand.Rand, normal, d Vector, ior float32) (Vector, bool) {
+	n := normal
+	cosI := -n.Dot(d)
+	etaI, etaT := float32(1), ior
+	if cosI < 0 {
+		// leaving the object
+		n = n.Times(-1)
+		etaI, etaT = etaT, etaI
+	}
+	if random.Float32() < fresnelDielectric(cosI, 1, ior) {
+		return mirrorDirection(d, n).Normalize(), false
+	}
+	t, ok := refract(d, n, etaI/etaT)
+	if !ok {
+		return mirrorDirection(d, n).Normalize(), false
+	}
+	return t.Normalize(), true
+}
+
+// NormalMappingMaterial shades its wrapped material with the normal given by
+// NormalFunc, in the object space of the primitive hit
 type NormalMappingMaterial struct {
 	material
 	WrappedMaterial Material
 	NormalFunc      func(*SurfaceInteraction) Vector
 }
 
-// TODO: this is a bit of a hack, no? where should this normal mapping happen?
 func (m *NormalMappingMaterial) GetColor(si *SurfaceInteraction) Color {
-	si.normal = m.NormalFunc(si)
 	return m.WrappedMaterial.GetColor(si)
 }
 
+// the wrapped material is masked unless the wrapper is itself
+func (m *NormalMappingMaterial) mask() (Texture, float32) {
+	if m.Opacity != nil {
+		return m.Opacity, m.AlphaThreshold
+	}
+	return maskOf(m.WrappedMaterial)
+}
+
+// ShadingNormal returns the normal of NormalFunc in world space, turned to
+// the side of the geometric normal
+func (m *NormalMappingMaterial) ShadingNormal(si *SurfaceInteraction) Vector {
+	n := m.NormalFunc(si)
+	if si.instance != nil {
+		n = si.instance.ObjectToWorld.Normal(n)
+	}
+	n = n.Normalize()
+	if n.Dot(si.normal) < 0 {
+		return n.Times(-1)
+	}
+	return n
+}
+
+// applyShadingNormal replaces the geometric normal of si by the shading
+// normal of its material, if it has one. Tracers call this once for every
+// hit, before using the normal or evaluating the material
+func (si *SurfaceInteraction) applyShadingNormal() {
+	si.normal = shadingNormal(si)
+}
+
+// the normal used for shading, which differs from the geometric normal
+// for normal mapped materials
+func shadingNormal(si *SurfaceInteraction) Vector {
+	if mat, ok := si.object.GetMaterial().(*NormalMappingMaterial); ok {
+		return mat.ShadingNormal(si)
+	}
+	return si.normal
+}
+
 // only works for triangles in mesh
 func InterpolatedNormalMappingMaterial(mat Material) *NormalMappingMaterial {
 	return &NormalMappingMaterial{
@@ -150,6 +390,94 @@ func InterpolatedNormalMappingMaterial(mat Material) *NormalMappingMaterial {
 	}
 }
 
+// TangentSpaceNormalMappingMaterial reads normals from an RGB normal map,
+// such as an ImageTexture with TriangleMeshUVFunc, where red, green and blue
+// map to the tangent along u, the tangent along v and the normal, from -1
+// to 1. Triangle meshes with uvs take their tangents from ComputeTangents
+// if called, and from each triangle otherwise; other objects get an
+// arbitrary tangent frame
+func TangentSpaceNormalMappingMaterial(mat Material, normalMap Texture) *NormalMappingMaterial {
+	return &NormalMappingMaterial{
+		WrappedMaterial: mat,
+		NormalFunc: func(si *SurfaceInteraction) Vector {
+			n, dpdu, dpdv := tangentFrame(si)
+			if tr, ok := si.GetObject().(TriangleInMesh); ok && tr.Mesh.Tangents != nil {
+				dpdu = tr.interpolate(tr.Mesh.Tangents, si.UntransformedPoint)
+				dpdv = tr.interpolate(tr.Mesh.Bitangents, si.UntransformedPoint)
+			}
+			t := dpdu.Sub(n.Times(n.Dot(dpdu))).Normalize()
+			b := n.Cross(t)
+			if b.Dot(dpdv) < 0 {
+				b = b.Times(-1)
+			}
+			c := normalMap.GetColor(si)
+			return t.Times(2*c.r - 1).Add(b.Times(2*c.g - 1)).Add(n.Times(2*c.b - 1))
+		},
+	}
+}
+
+// step in u and v, or in object space without uvs, over which a bump map
+// is differentiated
+const BUMP_DELTA = 1e-3
+
+// BumpMappingMaterial shades as if the surface was displaced along its
+// normal by scale times the luminance of the height texture, from finite
+// differences of the height along u and v: pbrt 9.3
+func BumpMappingMaterial(mat Material, height Texture, scale float32) *NormalMappingMaterial {
+	return &NormalMappingMaterial{
+		WrappedMaterial: mat,
+		NormalFunc: func(si *SurfaceInteraction) Vector {
+			n, dpdu, dpdv := tangentFrame(si)
+			p := si.UntransformedPoint
+			h := bumpHeight(si, height, p)
+			du := (bumpHeight(si, height, p.Add(dpdu.Times(BUMP_DELTA))) - h) / BUMP_DELTA
+			dv := (bumpHeight(si, height, p.Add(dpdv.Times(BUMP_DELTA))) - h) / BUMP_DELTA
+			dpdu = dpdu.Add(n.Times(du * scale))
+			dpdv = dpdv.Add(n.Times(dv * scale))
+			bumped := dpdu.Cross(dpdv)
+			if bumped.Dot(n) < 0 {
+				bumped = bumped.Times(-1)
+			}
+			return bumped
+		},
+	}
+}
+
+// bumpHeight samples the height texture at p in object space, near si
+func bumpHeight(si *SurfaceInteraction, height Texture, p Vector) float32 {
+	return height.GetColor(si.movedTo(p)).Luminance()
+}
+
+// movedTo returns a copy of si at point p in object space nearby, to
+// sample textures around the hit
+func (si *SurfaceInteraction) movedTo(p Vector) *SurfaceInteraction {
+	moved := *si
+	moved.UntransformedPoint = p
+	moved.Point = p
+	if si.instance != nil {
+		moved.Point = si.instance.ObjectToWorld.Point(p)
+	}
+	return &moved
+}
+
+// tangentFrame returns the shading normal at si and the change of the
+// point along u and v, in object space. Only triangle meshes have uvs;
+// other objects get tangents of unit length in an arbitrary direction
+func tangentFrame(si *SurfaceInteraction) (n, dpdu, dpdv Vector) {
+	if tr, ok := si.GetObject().(TriangleInMesh); ok {
+		n = tr.shadingNormal(si.UntransformedPoint)
+		if tr.Mesh.UV != nil {
+			if dpdu, dpdv, ok := tr.uvDerivatives(); ok {
+				return n, dpdu, dpdv
+			}
+		}
+	} else {
+		n = si.UntransformedNormal.Normalize()
+	}
+	dpdu, dpdv = coordinateSystem(n)
+	return n, dpdu, dpdv
+}
+
 // used in whitted style raytracer to ignore light contribution when debugging
 type PosFuncMat struct {
 	material
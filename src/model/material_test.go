@@ -0,0 +1,133 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+// a texture that is a function of the hit, for testing
+type funcTexture func(si *SurfaceInteraction) Color
+
+func (f funcTexture) GetColor(si *SurfaceInteraction) Color {
+	return f(si)
+}
+
+func TestComputeTangents(t *testing.T) {
+	for i, tt := range []struct {
+		mirror        bool
+		wantTangent   Vector
+		wantBitangent Vector
+	}{
+		{wantTangent: Vector{1, 0, 0}, wantBitangent: Vector{0, 0, -1}},
+		{mirror: true, wantTangent: Vector{-1, 0, 0}, wantBitangent: Vector{0, 0, -1}},
+	} {
+		m := flatGrid(2)
+		if tt.mirror {
+			for v, uv := range m.UV {
+				m.UV[v] = Vector{1 - uv.X, uv.Y, 0}
+			}
+		}
+		m.ComputeTangents()
+		if len(m.Tangents) != 9 {
+			t.Errorf("%d): got %d tangents want 9", i, len(m.Tangents))
+		}
+		for v := range m.vertices {
+			if !compareVectors(m.Tangents[v], tt.wantTangent) {
+				t.Errorf("%d): got tangent %v want %v", i, m.Tangents[v], tt.wantTangent)
+			}
+			if !compareVectors(m.Bitangents[v], tt.wantBitangent) {
+				t.Errorf("%d): got bitangent %v want %v", i, m.Bitangents[v], tt.wantBitangent)
+			}
+		}
+	}
+}
+
+func TestNormalMapping(t *testing.T) {
+	diffuse := &DiffuseMaterial{}
+	sqrt2 := float32(math.Sqrt2) / 2
+	ramp := funcTexture(func(si *SurfaceInteraction) Color {
+		u := TriangleMeshUVFunc(si).X
+		return Color{u, u, u}
+	})
+	for i, tt := range []struct {
+		mat      *NormalMappingMaterial
+		tangents bool
+		toWorld  Transform
+		want     Vector
+	}{
+		{
+			mat:  TangentSpaceNormalMappingMaterial(diffuse, NewConstantTexture(Color{0.5, 0.5, 1})),
+			want: Vector{0, 1, 0},
+		},
+		{
+			mat:  TangentSpaceNormalMappingMaterial(diffuse, NewConstantTexture(Color{1, 0.5, 1})),
+			want: Vector{sqrt2, sqrt2, 0},
+		},
+		{
+			mat:      TangentSpaceNormalMappingMaterial(diffuse, NewConstantTexture(Color{0.5, 1, 1})),
+			tangents: true,
+			want:     Vector{0, sqrt2, -sqrt2},
+		},
+		{
+			// pointing into the surface is turned back out
+			mat:  TangentSpaceNormalMappingMaterial(diffuse, NewConstantTexture(Color{0.5, 0.5, 0})),
+			want: Vector{0, 1, 0},
+		},
+		{
+			mat:     TangentSpaceNormalMappingMaterial(diffuse, NewConstantTexture(Color{1, 0.5, 1})),
+			toWorld: RotateY(math.Pi / 2),
+			want:    Vector{0, sqrt2, sqrt2},
+		},
+		{
+			mat:  BumpMappingMaterial(diffuse, NewConstantTexture(Color{1, 1, 1}), 1),
+			want: Vector{0, 1, 0},
+		},
+		{
+			// rising along u tilts the normal back against u
+			mat:  BumpMappingMaterial(diffuse, ramp, 1),
+			want: Vector{-sqrt2, sqrt2, 0},
+		},
+		{
+			mat:  BumpMappingMaterial(diffuse, ramp, -1),
+			want: Vector{sqrt2, sqrt2, 0},
+		},
+	} {
+		m := flatGrid(2)
+		m.object = object{tt.mat}
+		if tt.tangents {
+			m.ComputeTangents()
+		}
+		var o Object = m
+		origin := Vector{0.3, 1, -0.3}
+		if tt.toWorld != (Transform{}) {
+			o = NewSharedObject(m, tt.toWorld)
+			origin = tt.toWorld.Point(origin)
+		}
+		ray := NewRay(origin, Vector{0, -1, 0})
+		si, ok := o.Intersect(ray)
+		if !ok {
+			t.Fatalf("%d): expected hit", i)
+		}
+		si.applyShadingNormal()
+		if !compareVectors(si.normal, tt.want) {
+			t.Errorf("%d): got %v want %v", i, si.normal, tt.want)
+		}
+	}
+}
+
+func TestNormalMappingSphere(t *testing.T) {
+	for i, mat := range []*NormalMappingMaterial{
+		TangentSpaceNormalMappingMaterial(&DiffuseMaterial{}, NewConstantTexture(Color{0.5, 0.5, 1})),
+		BumpMappingMaterial(&DiffuseMaterial{}, NewConstantTexture(Color{1, 1, 1}), 1),
+	} {
+		s := NewSphere(Vector{0, 0, 0}, 1, mat)
+		si, ok := s.Intersect(NewRay(Vector{0, 0, 5}, Vector{0, 0, -1}))
+		if !ok {
+			t.Fatalf("%d): expected hit", i)
+		}
+		si.applyShadingNormal()
+		if !compareVectors(si.normal, Vector{0, 0, 1}) {
+			t.Errorf("%d): got %v want %v", i, si.normal, Vector{0, 0, 1})
+		}
+	}
+}
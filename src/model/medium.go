@@ -0,0 +1,479 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Participating media: pbrt ch11 and ch15.2
+// A medium absorbs and scatters light travelling through it. Media are
+// either global (Scene.Medium) or bounded by a closed surface with a
+// MediumBoundaryMaterial. Only the volumetric path tracer takes them
+// into account.
+
+type Medium interface {
+	// Transmittance returns the fraction of light that travels
+	// distance tMax along ray through the medium unscattered
+	Transmittance(random *rand.Rand, ray Ray, tMax float32) Color
+	// Sample samples a distance t along ray at which light scatters.
+	// returns false if no scattering happens before tMax; either way
+	// the weight is the transmittance (times sigma_s if scattered)
+	// divided by the pdf of the sample
+	Sample(random *rand.Rand, ray Ray, tMax float32) (t float32, scattered bool, weight Color)
+	PhaseFunction() HenyeyGreenstein
+}
+
+// HenyeyGreenstein phase function with asymmetry parameter G in (-1, 1):
+// positive values scatter light forward, negative values backward
+// and zero is isotropic: pbrt 681
+type HenyeyGreenstein struct {
+	G float32
+}
+
+// P returns the phase function value for light travelling in direction d
+// being scattered into direction wi
+func (hg HenyeyGreenstein) P(d, wi Vector) float32 {
+	g := hg.G
+	denom := 1 + g*g - 2*g*d.Dot(wi)
+	return INVPI / 4 * (1 - g*g) / (denom * float32(math.Sqrt(float64(denom))))
+}
+
+// Sample samples wi proportional to the phase function, so the pdf
+// equals P(d, wi): pbrt 899
+func (hg HenyeyGreenstein) Sample(random *rand.Rand, d Vector) (Vector, float32) {
+	g := hg.G
+	u := random.Float32()
+	var cos float32
+	if g > -1e-3 && g < 1e-3 {
+		cos = 1 - 2*u
+	} else {
+		sqr := (1 - g*g) / (1 - g + 2*g*u)
+		cos = (1 + g*g - sqr*sqr) / (2 * g)
+	}
+	sin := float32(math.Sqrt(math.Max(0, float64(1-cos*cos))))
+	phi := 2 * math.Pi * random.Float64()
+	s, t := coordinateSystem(d)
+	x, y := sin*float32(math.Cos(phi)), sin*float32(math.Sin(phi))
+	wi := s.Times(x).Add(t.Times(y)).Add(d.Times(cos))
+	return wi, hg.P(d, wi)
+}
+
+// HomogeneousMedium has the same density everywhere: fog, murky water.
+// sigmaA and sigmaS are the absorption and scattering coefficients per
+// unit of distance
+type HomogeneousMedium struct {
+	sigmaA, sigmaS, sigmaT Color
+	phase                  HenyeyGreenstein
+}
+
+func NewHomogeneousMedium(sigmaA, sigmaS Color, g float32) *HomogeneousMedium {
+	return &HomogeneousMedium{
+		sigmaA: sigmaA,
+		sigmaS: sigmaS,
+		sigmaT: sigmaA.Add(sigmaS),
+		phase:  HenyeyGreenstein{G: g},
+	}
+}
+
+func (m *HomogeneousMedium) PhaseFunction() HenyeyGreenstein {
+	return m.phase
+}
+
+func (m *HomogeneousMedium) Transmittance(_ *rand.Rand, _ Ray, tMax float32) Color {
+	return colorExp(m.sigmaT.Times(-tMax))
+}
+
+// samples a distance using one randomly chosen channel's sigma_t,
+// weighting by the average pdf over all channels: pbrt 893
+func (m *HomogeneousMedium) Sample(random *rand.Rand, _ Ray, tMax float32) (float32, bool, Color) {
+	channels := [3]float32{m.sigmaT.r, m.sigmaT.g, m.sigmaT.b}
+	sigma := channels[random.Intn(3)]
+	t := tMax
+	if sigma > 0 {
+		t = float32(-math.Log(1-random.Float64())) / sigma
+	}
+	scattered := t < tMax
+	if !scattered {
+		t = tMax
+	}
+	tr := colorExp(m.sigmaT.Times(-t))
+	density := tr
+	if scattered {
+		density = m.sigmaT.Product(tr)
+	}
+	pdf := (density.r + density.g + density.b) / 3
+	if pdf == 0 {
+		return t, false, Color{}
+	}
+	if scattered {
+		return t, true, tr.Product(m.sigmaS).Times(1 / pdf)
+	}
+	return t, false, tr.Times(1 / pdf)
+}
+
+// HeterogeneousMedium has a density that varies over space, such as smoke
+// or clouds. sigmaA and sigmaS are the coefficients at density 1; density
+// is zero outside of bounds and never larger than maxDensity.
+// Sampling uses delta tracking and transmittance uses ratio tracking
+// against that maximum: pbrt 895
+type HeterogeneousMedium struct {
+	sigmaS     Color
+	sigmaT     float32
+	phase      HenyeyGreenstein
+	bounds     AABB
+	density    func(p Vector) float32
+	maxDensity float32
+}
+
+// NewHeterogeneousMedium panics if sigmaA + sigmaS differs per channel:
+// tracking requires a single majorant for all channels
+func NewHeterogeneousMedium(sigmaA, sigmaS Color, g float32, bounds AABB, density func(p Vector) float32, maxDensity float32) *HeterogeneousMedium {
+	sigmaT := sigmaA.Add(sigmaS)
+	if sigmaT.r != sigmaT.g || sigmaT.r != sigmaT.b {
+		panic("heterogeneous medium needs sigma_t equal in all channels")
+	}
+	if maxDensity <= 0 || sigmaT.r <= 0 {
+		panic("heterogeneous medium needs a positive max density and sigma_t")
+	}
+	return &HeterogeneousMedium{
+		sigmaS:     sigmaS,
+		sigmaT:     sigmaT.r,
+		phase:      HenyeyGreenstein{G: g},
+		bounds:     bounds,
+		density:    density,
+		maxDensity: maxDensity,
+	}
+}
+
+// NewGridMedium is a heterogeneous medium with its density read from grid
+func NewGridMedium(sigmaA, sigmaS Color, g float32, grid *DensityGrid) *HeterogeneousMedium {
+	return NewHeterogeneousMedium(sigmaA, sigmaS, g, grid.Bounds, grid.Density, grid.Max())
+}
+
+func (m *HeterogeneousMedium) PhaseFunction() HenyeyGreenstein {
+	return m.phase
+}
+
+func (m *HeterogeneousMedium) Transmittance(random *rand.Rand, ray Ray, tMax float32) Color {
+	tMin, tMax, ok := m.clip(ray, tMax)
+	if !ok {
+		return NewColor(255, 255, 255)
+	}
+	sigmaMaj := m.sigmaT * m.maxDensity
+	var tr float32 = 1
+	t := tMin
+	for {
+		t -= float32(math.Log(1-random.Float64())) / sigmaMaj
+		if t >= tMax {
+			break
+		}
+		tr *= 1 - m.density(PointFromRay(ray, t))/m.maxDensity
+		if tr < 0.1 {
+			// russian roulette on low transmittance
+			if random.Float32() < 0.5 {
+				return Color{}
+			}
+			tr *= 2
+		}
+	}
+	return Color{tr, tr, tr}
+}
+
+func (m *HeterogeneousMedium) Sample(random *rand.Rand, ray Ray, tMax float32) (float32, bool, Color) {
+	white := NewColor(255, 255, 255)
+	tMin, tEnd, ok := m.clip(ray, tMax)
+	if !ok {
+		return tMax, false, white
+	}
+	sigmaMaj := m.sigmaT * m.maxDensity
+	t := tMin
+	for {
+		t -= float32(math.Log(1-random.Float64())) / sigmaMaj
+		if t >= tEnd {
+			return tMax, false, white
+		}
+		if m.density(PointFromRay(ray, t))/m.maxDensity > random.Float32() {
+			return t, true, m.sigmaS.Times(1 / m.sigmaT)
+		}
+	}
+}
+
+// clip the range [0, tMax] along ray to the bounds of the medium
+func (m *HeterogeneousMedium) clip(ray Ray, tMax float32) (float32, float32, bool) {
+	t0, t1, ok := m.bounds.intersectRange(ray)
+	if !ok {
+		return 0, 0, false
+	}
+	if t1 > tMax {
+		t1 = tMax
+	}
+	return t0, t1, t0 < t1
+}
+
+// DensityGrid is a voxel grid of densities over Bounds, stored x first
+// then y then z. Lookups interpolate trilinearly between voxel centers
+type DensityGrid struct {
+	Bounds     AABB
+	nx, ny, nz int
+	values     []float32
+}
+
+func NewDensityGrid(bounds AABB, nx, ny, nz int, values []float32) *DensityGrid {
+	if len(values) != nx*ny*nz {
+		panic("density grid size does not match dimensions")
+	}
+	return &DensityGrid{
+		Bounds: bounds,
+		nx:     nx,
+		ny:     ny,
+		nz:     nz,
+		values: values,
+	}
+}
+
+func (g *DensityGrid) voxel(x, y, z int) float32 {
+	if x < 0 || x >= g.nx || y < 0 || y >= g.ny || z < 0 || z >= g.nz {
+		return 0
+	}
+	return g.values[(z*g.ny+y)*g.nx+x]
+}
+
+// Density returns the interpolated density at p; zero outside the grid
+func (g *DensityGrid) Density(p Vector) float32 {
+	o := g.Bounds.Offset(p)
+	if o.X < 0 || o.X > 1 || o.Y < 0 || o.Y > 1 || o.Z < 0 || o.Z > 1 {
+		return 0
+	}
+	x := o.X*float32(g.nx) - 0.5
+	y := o.Y*float32(g.ny) - 0.5
+	z := o.Z*float32(g.nz) - 0.5
+	fx, fy, fz := float32(math.Floor(float64(x))), float32(math.Floor(float64(y))), float32(math.Floor(float64(z)))
+	ix, iy, iz := int(fx), int(fy), int(fz)
+	dx, dy, dz := x-fx, y-fy, z-fz
+	lerp := func(t, a, b float32) float32 {
+		return (1-t)*a + t*b
+	}
+	d00 := lerp(dx, g.voxel(ix, iy, iz), g.voxel(ix+1, iy, iz))
+	d10 := lerp(dx, g.voxel(ix, iy+1, iz), g.voxel(ix+1, iy+1, iz))
+	d01 := lerp(dx, g.voxel(ix, iy, iz+1), g.voxel(ix+1, iy, iz+1))
+	d11 := lerp(dx, g.voxel(ix, iy+1, iz+1), g.voxel(ix+1, iy+1, iz+1))
+	return lerp(dz, lerp(dy, d00, d10), lerp(dy, d01, d11))
+}
+
+// Max returns the largest density in the grid
+func (g *DensityGrid) Max() float32 {
+	var max float32
+	for _, v := range g.values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// MediumBoundaryMaterial marks the surface of a closed object as the
+// boundary between two media. The surface itself is invisible to the
+// volumetric path tracer: rays pass through and continue in the medium
+// on the other side. A nil Outside means the scene's global medium
+type MediumBoundaryMaterial struct {
+	material
+	Inside, Outside Medium
+}
+
+func NewMediumBoundaryMaterial(inside, outside Medium) *MediumBoundaryMaterial {
+	return &MediumBoundaryMaterial{
+		material: material{
+			texture: NewConstantTexture(NewColor(255, 255, 255)),
+		},
+		Inside:  inside,
+		Outside: outside,
+	}
+}
+
+// medium on the other side of the boundary for a ray crossing it
+// in direction d
+func (m *MediumBoundaryMaterial) next(scene *Scene, normal, d Vector) Medium {
+	if normal.Dot(d) < 0 {
+		return m.Inside
+	}
+	if m.Outside == nil {
+		return scene.Medium
+	}
+	return m.Outside
+}
+
+func colorExp(c Color) Color {
+	return Color{
+		r: float32(math.Exp(float64(c.r))),
+		g: float32(math.Exp(float64(c.g))),
+		b: float32(math.Exp(float64(c.b))),
+	}
+}
+
+// transmittance along the segment from p to p+l through all media it
+// crosses, starting in medium. returns false if a surface blocks it
+func transmittance(random *rand.Rand, scene *Scene, medium Medium, p, l Vector) (Color, bool) {
+	tr := NewColor(255, 255, 255)
+	dist := l.Length()
+	for {
+		ray := NewRay(p, l)
+		si, ok := scene.AccelerationStructure.ClosestIntersection(ray, dist-ERROR_MARGIN)
+		segment := dist
+		if ok {
+			segment = si.distance
+		}
+		if medium != nil {
+			tr = tr.Product(medium.Transmittance(random, ray, segment))
+		}
+		if !ok {
+			return tr, true
+		}
+		boundary, isBoundary := si.object.GetMaterial().(*MediumBoundaryMaterial)
+		if !isBoundary {
+			return Color{}, false
+		}
+		medium = boundary.next(scene, si.normal, ray.Direction)
+		p = si.Point
+		dist -= si.distance
+	}
+}
+
+// sampleLightFromMedium samples direct light arriving at p from a random
+// light, attenuated by the media in between.
+// returns the radiance, the direction towards the light and the solid
+// angle pdf of the sample
+func sampleLightFromMedium(random *rand.Rand, scene *Scene, medium Medium, p Vector) (Color, Vector, float32, bool) {
+	if scene.chooseEnvironment(random) {
+		wi, le, pdf := scene.Environment.sample(random)
+		if pdf == 0 {
+			return Color{}, Vector{}, 0, false
+		}
+		tr, ok := transmittance(random, scene, medium, p, wi.Times(MAX_RAY_DISTANCE))
+		if !ok {
+			return Color{}, Vector{}, 0, false
+		}
+		return le.Product(tr), wi, pdf * scene.environmentPMF(), true
+	}
+	// there is no surface to take into account in a medium
+	light, pmf := scene.sampleLight(random, p, Vector{})
+	if light == nil {
+		return Color{}, Vector{}, 0, false
+	}
+	li, l, pdf := light.SampleLi(random, p)
+	if pdf == 0 {
+		return Color{}, Vector{}, 0, false
+	}
+	tr, ok := transmittance(random, scene, medium, p, l)
+	if !ok {
+		return Color{}, Vector{}, 0, false
+	}
+	return li.Product(tr), l.Normalize(), pdf * pmf, true
+}
+
+type volumetricPathTracer struct {
+	tracer
+}
+
+// NewVolumetricPathTracer is a path tracer with next event estimation that
+// scatters light in participating media. The camera is assumed to be in
+// the scene's global medium
+func NewVolumetricPathTracer(maxDepth int) Tracer {
+	return &volumetricPathTracer{newTracer(maxDepth)}
+}
+
+func (pt *volumetricPathTracer) GetRayColor(ray Ray, scene *Scene, depth int) Color {
+	color := NewColor(0, 0, 0)
+	throughput := NewColor(255, 255, 255)
+	medium := scene.Medium
+	// emitters hit directly or through specular bounces are not found by
+	// light sampling, so they count
+	countEmitted := true
+	for bounce := depth; bounce < pt.maxDepth; {
+		si, hit := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+		tMax := float32(MAX_RAY_DISTANCE)
+		if hit {
+			tMax = si.distance
+		}
+
+		if medium != nil {
+			t, scattered, weight := medium.Sample(pt.random, ray, tMax)
+			throughput = throughput.Product(weight)
+			if scattered {
+				p := PointFromRay(ray, t)
+				phase := medium.PhaseFunction()
+				if lightColor, wi, lightPDF, ok := sampleLightFromMedium(pt.random, scene, medium, p); ok {
+					direct := lightColor.Times(phase.P(ray.Direction, wi) / lightPDF)
+					color = color.Add(throughput.Product(direct))
+				}
+				// phase function sampling is perfect: weight p/pdf is 1
+				direction, _ := phase.Sample(pt.random, ray.Direction)
+				var ok bool
+				throughput, ok = russianRoulette(pt.random, throughput, bounce)
+				if !ok {
+					break
+				}
+				ray = NewRay(p, direction)
+				countEmitted = false
+				bounce++
+				continue
+			}
+		}
+		if !hit {
+			if scene.Environment != nil && countEmitted {
+				color = color.Add(throughput.Product(scene.Environment.Radiance(ray.Direction)))
+			}
+			break
+		}
+
+		// crossing into another medium does not count as a bounce
+		if boundary, ok := si.object.GetMaterial().(*MediumBoundaryMaterial); ok {
+			medium = boundary.next(scene, si.normal, ray.Direction)
+			ray = NewRay(si.Point, ray.Direction)
+			continue
+		}
+
+		si.as = scene.AccelerationStructure
+		si.depth = bounce
+		si.tracer = pt
+		si.applyShadingNormal()
+
+		if si.object.IsLight() {
+			if countEmitted {
+				color = color.Add(throughput.Product(emittedRadiance(si, ray.Direction.Times(-1))))
+			}
+			break
+		}
+		bounce++
+		if direction, tint, ok := scatterSpecular(pt.random, si, ray.Direction); ok {
+			throughput = throughput.Product(tint)
+			ray = NewRay(si.Point, direction)
+			countEmitted = true
+			continue
+		}
+		brdf := si.object.GetColor(si).Times(INVPI)
+
+		// direct light sampling, through media
+		if lightColor, wi, lightPDF, ok := sampleLightFromMedium(pt.random, scene, medium, si.Point); ok {
+			if cos := si.normal.Dot(wi); cos > 0 {
+				direct := lightColor.Product(brdf).Times(cos / lightPDF)
+				color = color.Add(throughput.Product(direct))
+			}
+		}
+
+		direction := si.object.SampleDirection(pt.random, si.normal)
+		pdf := si.object.GetMaterial().PDF(si.normal, direction)
+		if pdf == 0 {
+			break
+		}
+		cos := si.normal.Dot(direction)
+		throughput = throughput.Product(brdf.Times(cos / pdf))
+		var ok bool
+		throughput, ok = russianRoulette(pt.random, throughput, bounce-1)
+		if !ok {
+			break
+		}
+		ray = NewRay(si.Point, direction)
+		countEmitted = false
+	}
+	return color
+}
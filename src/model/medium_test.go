@@ -0,0 +1,79 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHenyeyGreensteinSample(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	d := Vector{0, 0, 1}
+	for i, g := range []float32{0, 0.5, -0.7} {
+		hg := HenyeyGreenstein{G: g}
+		n := 100000
+		var meanCos float64
+		for j := 0; j < n; j++ {
+			wi, pdf := hg.Sample(random, d)
+			if p := hg.P(d, wi); math.Abs(float64(p-pdf)) > 1e-3*float64(p) {
+				t.Fatalf("%d) pdf %f does not match phase function %f", i, pdf, p)
+			}
+			meanCos += float64(d.Dot(wi))
+		}
+		// the mean cosine of henyey-greenstein is g
+		if got := meanCos / float64(n); math.Abs(got-float64(g)) > 0.01 {
+			t.Errorf("%d) got mean cosine %f want %f", i, got, g)
+		}
+	}
+}
+
+func TestMediumTransmittance(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	sigmaA := NewColor(255, 255, 255).Times(0.1)
+	sigmaS := NewColor(255, 255, 255).Times(0.2)
+	bounds := NewAABB(Vector{-10, -10, -10}, Vector{10, 10, 10})
+	homogeneous := NewHomogeneousMedium(sigmaA.Times(0.5), sigmaS.Times(0.5), 0)
+	heterogeneous := NewHeterogeneousMedium(sigmaA, sigmaS, 0, bounds, func(Vector) float32 { return 0.5 }, 1)
+	for i, tt := range []struct {
+		ray  Ray
+		tMax float32
+		want float32
+	}{
+		{ray: NewRay(Vector{0, 0, 0}, Vector{1, 0, 0}), tMax: 5, want: float32(math.Exp(-0.15 * 5))},
+		// the medium ends at the bounds
+		{ray: NewRay(Vector{0, 0, 0}, Vector{1, 0, 0}), tMax: 100, want: float32(math.Exp(-0.15 * 10))},
+		{ray: NewRay(Vector{20, 0, 0}, Vector{0, 1, 0}), tMax: 100, want: 1},
+	} {
+		n := 20000
+		var sum float32
+		for j := 0; j < n; j++ {
+			sum += heterogeneous.Transmittance(random, tt.ray, tt.tMax).r
+		}
+		if got := sum / float32(n); math.Abs(float64(got-tt.want)) > 0.01 {
+			t.Errorf("%d) got heterogeneous transmittance %f want %f", i, got, tt.want)
+		}
+	}
+	if got, want := homogeneous.Transmittance(random, Ray{}, 5).g, float32(math.Exp(-0.15*5)); math.Abs(float64(got-want)) > 1e-5 {
+		t.Errorf("got homogeneous transmittance %f want %f", got, want)
+	}
+}
+
+func TestDensityGrid(t *testing.T) {
+	// 2x1x1 grid over [0,2]x[0,1]x[0,1] with voxel centers at x=0.5 and x=1.5
+	grid := NewDensityGrid(NewAABB(Vector{0, 0, 0}, Vector{2, 1, 1}), 2, 1, 1, []float32{1, 3})
+	for i, tt := range []struct {
+		p    Vector
+		want float32
+	}{
+		{p: Vector{1, 0.5, 0.5}, want: 2},
+		{p: Vector{1.25, 0.5, 0.5}, want: 2.5},
+		{p: Vector{3, 0.5, 0.5}, want: 0},
+	} {
+		if got := grid.Density(tt.p); math.Abs(float64(got-tt.want)) > 1e-5 {
+			t.Errorf("%d) got %f want %f", i, got, tt.want)
+		}
+	}
+	if got := grid.Max(); got != 3 {
+		t.Errorf("got max %f want 3", got)
+	}
+}
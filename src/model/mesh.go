@@ -24,6 +24,9 @@ type TriangleMesh struct {
 	// TODO: 2d vector instead of Vector?
 	// u and v values associated to vertices, if any
 	UV map[int64]Vector
+	// tangent frame along u and v at vertices, see ComputeTangents
+	Tangents   map[int64]Vector
+	Bitangents map[int64]Vector
 }
 
 // NOTE: the mesh is the object inheriting material, not the triangle
@@ -198,3 +201,94 @@ func (t TriangleInMesh) Barycentric(p Vector) (float32, float32, float32) {
 	p0, p1, p2 := t.Points()
 	return barycentric(p0, p1, p2, p)
 }
+
+func (t TriangleInMesh) Sample(random *rand.Rand) Vector {
+	p0, p1, p2 := t.Points()
+	return NewTriangle(p0, p1, p2, nil).Sample(random)
+}
+
+func (t TriangleInMesh) SurfaceArea() float32 {
+	p0, p1, p2 := t.Points()
+	return triangleSurfaceArea(p0, p1, p2)
+}
+
+func (m *TriangleMesh) faces() []Face {
+	var faces []Face
+	for _, o := range m.as.GetObjects() {
+		t := o.(TriangleInMesh)
+		faces = append(faces, NewFace(t.p0, t.p1, t.p2))
+	}
+	return faces
+}
+
+// ComputeTangents sets Tangents and Bitangents to the directions in which
+// u and v increase at every vertex, perpendicular to the vertex normal and
+// averaged over the triangles around it, for tangent space normal mapping.
+// See Lengyel, Computing Tangent Space Basis Vectors for an Arbitrary Mesh
+func (m *TriangleMesh) ComputeTangents() {
+	if m.UV == nil {
+		panic("tangents need uvs")
+	}
+	normals := m.Normals
+	if normals == nil {
+		normals = vertexNormals(m.vertices, m.faces())
+	}
+	dpdus, dpdvs := map[int64]Vector{}, map[int64]Vector{}
+	for _, o := range m.as.GetObjects() {
+		t := o.(TriangleInMesh)
+		dpdu, dpdv, ok := t.uvDerivatives()
+		if !ok {
+			continue
+		}
+		for _, v := range []int64{t.p0, t.p1, t.p2} {
+			dpdus[v] = dpdus[v].Add(dpdu)
+			dpdvs[v] = dpdvs[v].Add(dpdv)
+		}
+	}
+	m.Tangents, m.Bitangents = map[int64]Vector{}, map[int64]Vector{}
+	for v, dpdu := range dpdus {
+		n := normals[v].Normalize()
+		t := dpdu.Sub(n.Times(n.Dot(dpdu)))
+		if t.Length() < 1e-6 {
+			t, _ = coordinateSystem(n)
+		}
+		t = t.Normalize()
+		// keep the handedness of mirrored uvs
+		b := n.Cross(t)
+		if b.Dot(dpdvs[v]) < 0 {
+			b = b.Times(-1)
+		}
+		m.Tangents[v], m.Bitangents[v] = t, b
+	}
+}
+
+// uvDerivatives returns the change of the point along u and v over the
+// triangle, which does not exist if its uvs are degenerate
+func (t TriangleInMesh) uvDerivatives() (dpdu, dpdv Vector, ok bool) {
+	p0, p1, p2 := t.Points()
+	uv0, uv1, uv2 := t.Mesh.UV[t.p0], t.Mesh.UV[t.p1], t.Mesh.UV[t.p2]
+	du1, du2 := uv1.Sub(uv0), uv2.Sub(uv0)
+	det := du1.X*du2.Y - du1.Y*du2.X
+	if absf(det) < 1e-12 {
+		return Vector{}, Vector{}, false
+	}
+	dp1, dp2 := VectorFromTo(p0, p1), VectorFromTo(p0, p2)
+	dpdu = dp1.Times(du2.Y).Sub(dp2.Times(du1.Y)).Times(1 / det)
+	dpdv = dp2.Times(du1.X).Sub(dp1.Times(du2.X)).Times(1 / det)
+	return dpdu, dpdv, true
+}
+
+// interpolate the values of a vertex map at p
+func (t TriangleInMesh) interpolate(values map[int64]Vector, p Vector) Vector {
+	l0, l1, l2 := t.Barycentric(p)
+	return values[t.p0].Times(l0).Add(values[t.p1].Times(l1)).Add(values[t.p2].Times(l2))
+}
+
+// shadingNormal is the interpolated vertex normal at p if the mesh has
+// normals, and the normal of the triangle otherwise
+func (t TriangleInMesh) shadingNormal(p Vector) Vector {
+	if t.Mesh.Normals == nil {
+		return t.SurfaceNormal(p)
+	}
+	return t.interpolate(t.Mesh.Normals, p).Normalize()
+}
@@ -0,0 +1,242 @@
+package model
+
+import (
+	"image"
+	"math"
+)
+
+// WrapMode decides what image textures show outside of uvs 0 to 1
+type WrapMode int
+
+const (
+	// tile the image
+	WrapRepeat WrapMode = iota
+	// stretch the pixels at the border
+	WrapClamp
+	// tile the image, mirroring every other copy
+	WrapMirror
+	// black outside of the image
+	WrapBlack
+)
+
+// FilterMode decides how image textures average the pixels in the
+// footprint of a ray
+type FilterMode int
+
+const (
+	// the single closest pixel
+	FilterNearest FilterMode = iota
+	// the four closest pixels, ignoring the footprint
+	FilterBilinear
+	// bilinear lookups in the two MIP levels closest to the width of
+	// the footprint
+	FilterTrilinear
+	// an elliptically weighted average over the footprint, which stays
+	// sharp along the short axis of footprints seen at grazing angles
+	FilterEWA
+)
+
+// number of entries of the table of gaussian weights of the EWA filter
+const EWA_LUT_SIZE = 128
+
+var ewaWeights = func() [EWA_LUT_SIZE]float32 {
+	var w [EWA_LUT_SIZE]float32
+	for i := range w {
+		const alpha = 2
+		r2 := float64(i) / (EWA_LUT_SIZE - 1)
+		w[i] = float32(math.Exp(-alpha*r2) - math.Exp(-alpha))
+	}
+	return w
+}()
+
+// mipmap is an image converted to floats and box filtered into levels of
+// half the resolution each, down to a single pixel: pbrt 10.4.3
+type mipmap struct {
+	levels []mipLevel
+}
+
+type mipLevel struct {
+	w, h   int
+	texels []Color
+}
+
+func newMipmap(img image.Image, pixelFunc func(r, g, b, a uint32) Color) *mipmap {
+	b := img.Bounds()
+	level := mipLevel{w: b.Dx(), h: b.Dy()}
+	level.texels = make([]Color, level.w*level.h)
+	for y := 0; y < level.h; y++ {
+		for x := 0; x < level.w; x++ {
+			level.texels[y*level.w+x] = pixelFunc(img.At(b.Min.X+x, b.Min.Y+y).RGBA())
+		}
+	}
+	m := &mipmap{levels: []mipLevel{level}}
+	for level.w > 1 || level.h > 1 {
+		level = level.downsample()
+		m.levels = append(m.levels, level)
+	}
+	return m
+}
+
+// downsample averages blocks of two by two texels, repeating the last row
+// or column of odd sized levels
+func (l mipLevel) downsample() mipLevel {
+	next := mipLevel{w: maxInt(1, (l.w+1)/2), h: maxInt(1, (l.h+1)/2)}
+	next.texels = make([]Color, next.w*next.h)
+	for y := 0; y < next.h; y++ {
+		for x := 0; x < next.w; x++ {
+			var sum Color
+			for _, d := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				sum = sum.Add(l.texel(2*x+d[0], 2*y+d[1], WrapClamp))
+			}
+			next.texels[y*next.w+x] = sum.Times(0.25)
+		}
+	}
+	return next
+}
+
+func wrapIndex(i, n int, wrap WrapMode) (int, bool) {
+	switch wrap {
+	case WrapRepeat:
+		i %= n
+		if i < 0 {
+			i += n
+		}
+	case WrapClamp:
+		i = clampInt(i, 0, n-1)
+	case WrapMirror:
+		i %= 2 * n
+		if i < 0 {
+			i += 2 * n
+		}
+		if i >= n {
+			i = 2*n - 1 - i
+		}
+	case WrapBlack:
+		if i < 0 || i >= n {
+			return 0, false
+		}
+	}
+	return i, true
+}
+
+func (l mipLevel) texel(x, y int, wrap WrapMode) Color {
+	x, okx := wrapIndex(x, l.w, wrap)
+	y, oky := wrapIndex(y, l.h, wrap)
+	if !okx || !oky {
+		return BLACK
+	}
+	return l.texels[y*l.w+x]
+}
+
+// size of the finest level in texels, along its longest side
+func (m *mipmap) size() float32 {
+	return float32(maxInt(m.levels[0].w, m.levels[0].h))
+}
+
+// nearest returns the texel at s, t, with 0, 0 the top left of the image
+func (m *mipmap) nearest(s, t float32, wrap WrapMode) Color {
+	l := m.levels[0]
+	x := int(math.Floor(float64(s * float32(l.w))))
+	y := int(math.Floor(float64(t * float32(l.h))))
+	return l.texel(x, y, wrap)
+}
+
+func (m *mipmap) bilinear(level int, s, t float32, wrap WrapMode) Color {
+	l := m.levels[clampInt(level, 0, len(m.levels)-1)]
+	x, y := s*float32(l.w)-0.5, t*float32(l.h)-0.5
+	x0, y0 := float32(math.Floor(float64(x))), float32(math.Floor(float64(y)))
+	dx, dy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+	return l.texel(ix, iy, wrap).Times((1 - dx) * (1 - dy)).
+		Add(l.texel(ix+1, iy, wrap).Times(dx * (1 - dy))).
+		Add(l.texel(ix, iy+1, wrap).Times((1 - dx) * dy)).
+		Add(l.texel(ix+1, iy+1, wrap).Times(dx * dy))
+}
+
+// trilinear filters over a square footprint as wide as the largest of the
+// differentials of s and t along x and y on the film: pbrt 10.4.4
+func (m *mipmap) trilinear(s, t float32, dst0, dst1 Vector, wrap WrapMode) Color {
+	width := 2 * maxf(maxf(absf(dst0.X), absf(dst0.Y)), maxf(absf(dst1.X), absf(dst1.Y)))
+	return m.lerpLevels(width, func(level int) Color {
+		return m.bilinear(level, s, t, wrap)
+	})
+}
+
+// lerpLevels blends lookups in the two levels whose texels are closest to
+// width in size, where level 0 has texels 1/size wide
+func (m *mipmap) lerpLevels(width float32, lookup func(level int) Color) Color {
+	n := len(m.levels)
+	level := float32(math.Log2(float64(maxf(width*m.size(), 1e-8))))
+	if level <= 0 {
+		return lookup(0)
+	}
+	if level >= float32(n-1) {
+		return lookup(n - 1)
+	}
+	i := int(level)
+	d := level - float32(i)
+	return lookup(i).Times(1 - d).Add(lookup(i + 1).Times(d))
+}
+
+// ewa filters over the ellipse with axes dst0 and dst1, made rounder if
+// its axes differ by more than maxAnisotropy so that it covers a bounded
+// number of texels in the level matching its minor axis: pbrt 10.4.5
+func (m *mipmap) ewa(s, t float32, dst0, dst1 Vector, maxAnisotropy float32, wrap WrapMode) Color {
+	if dst0.Length() < dst1.Length() {
+		dst0, dst1 = dst1, dst0
+	}
+	major, minor := dst0.Length(), dst1.Length()
+	if minor*maxAnisotropy < major && minor > 0 {
+		scale := major / (minor * maxAnisotropy)
+		dst1 = dst1.Times(scale)
+		minor *= scale
+	}
+	if minor == 0 {
+		return m.bilinear(0, s, t, wrap)
+	}
+	return m.lerpLevels(minor, func(level int) Color {
+		return m.ewaLevel(level, s, t, dst0, dst1, wrap)
+	})
+}
+
+func (m *mipmap) ewaLevel(level int, s, t float32, dst0, dst1 Vector, wrap WrapMode) Color {
+	l := m.levels[level]
+	w, h := float32(l.w), float32(l.h)
+	x, y := s*w-0.5, t*h-0.5
+	dst0 = Vector{dst0.X * w, dst0.Y * h, 0}
+	dst1 = Vector{dst1.X * w, dst1.Y * h, 0}
+	// coefficients of the implicit ellipse a s^2 + b s t + c t^2 = 1,
+	// grown by a texel so that it covers at least one
+	a := dst0.Y*dst0.Y + dst1.Y*dst1.Y + 1
+	b := -2 * (dst0.X*dst0.Y + dst1.X*dst1.Y)
+	c := dst0.X*dst0.X + dst1.X*dst1.X + 1
+	invF := 1 / (a*c - b*b*0.25)
+	a, b, c = a*invF, b*invF, c*invF
+	det := -b*b + 4*a*c
+	invDet := 1 / det
+	uSqrt := float32(math.Sqrt(float64(det * c)))
+	vSqrt := float32(math.Sqrt(float64(a * det)))
+	s0 := int(math.Ceil(float64(x - 2*invDet*uSqrt)))
+	s1 := int(math.Floor(float64(x + 2*invDet*uSqrt)))
+	t0 := int(math.Ceil(float64(y - 2*invDet*vSqrt)))
+	t1 := int(math.Floor(float64(y + 2*invDet*vSqrt)))
+	var sum Color
+	var sumWeights float32
+	for it := t0; it <= t1; it++ {
+		tt := float32(it) - y
+		for is := s0; is <= s1; is++ {
+			ss := float32(is) - x
+			r2 := a*ss*ss + b*ss*tt + c*tt*tt
+			if r2 >= 1 {
+				continue
+			}
+			weight := ewaWeights[minInt(int(r2*EWA_LUT_SIZE), EWA_LUT_SIZE-1)]
+			sum = sum.Add(l.texel(is, it, wrap).Times(weight))
+			sumWeights += weight
+		}
+	}
+	if sumWeights == 0 {
+		return m.bilinear(level, s, t, wrap)
+	}
+	return sum.Times(1 / sumWeights)
+}
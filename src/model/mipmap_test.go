@@ -0,0 +1,156 @@
+package model
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestWrapIndex(t *testing.T) {
+	for i, tt := range []struct {
+		index  int
+		wrap   WrapMode
+		want   int
+		wantOK bool
+	}{
+		{index: 2, wrap: WrapRepeat, want: 2, wantOK: true},
+		{index: 5, wrap: WrapRepeat, want: 1, wantOK: true},
+		{index: -1, wrap: WrapRepeat, want: 3, wantOK: true},
+		{index: -1, wrap: WrapClamp, want: 0, wantOK: true},
+		{index: 9, wrap: WrapClamp, want: 3, wantOK: true},
+		{index: 4, wrap: WrapMirror, want: 3, wantOK: true},
+		{index: 9, wrap: WrapMirror, want: 1, wantOK: true},
+		{index: -1, wrap: WrapMirror, want: 0, wantOK: true},
+		{index: -1, wrap: WrapBlack, wantOK: false},
+		{index: 4, wrap: WrapBlack, wantOK: false},
+	} {
+		got, ok := wrapIndex(tt.index, 4, tt.wrap)
+		if ok != tt.wantOK || (ok && got != tt.want) {
+			t.Errorf("%d) got %d, %t want %d, %t", i, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// stripes returns an image of n by n pixels of alternating black and
+// white rows, or columns
+func stripes(n int, rows bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, n, n))
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			i := x
+			if rows {
+				i = y
+			}
+			if i%2 == 0 {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	return img
+}
+
+func newTestMipmap(img image.Image) *mipmap {
+	return newMipmap(img, func(r, g, b, _ uint32) Color {
+		return Color{float32(r) / 65535, float32(g) / 65535, float32(b) / 65535}
+	})
+}
+
+func TestMipmapLevels(t *testing.T) {
+	m := newTestMipmap(stripes(5, false))
+	var sizes [][2]int
+	for _, l := range m.levels {
+		sizes = append(sizes, [2]int{l.w, l.h})
+	}
+	want := [][2]int{{5, 5}, {3, 3}, {2, 2}, {1, 1}}
+	if len(sizes) != len(want) {
+		t.Fatalf("got levels %v want %v", sizes, want)
+	}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Errorf("got levels %v want %v", sizes, want)
+		}
+	}
+	// columns 0, 1 average to gray, 2, 3 too, and 4 is repeated
+	if got := m.levels[1].texel(0, 0, WrapClamp); !compareFloat32(got.r, 0.5) {
+		t.Errorf("got %v want gray", got)
+	}
+	if got := m.levels[1].texel(2, 0, WrapClamp); !compareFloat32(got.r, 1) {
+		t.Errorf("got %v want white", got)
+	}
+}
+
+func TestMipmapFilters(t *testing.T) {
+	m := newTestMipmap(stripes(64, true))
+	// a footprint of 16 texels along s and a tenth of one along t
+	wide, thin := Vector{0.25, 0, 0}, Vector{0, 1.0 / 640, 0}
+	// the center of the first row, which is white
+	s, st := float32(0.5), float32(0.5/64)
+	for i, tt := range []struct {
+		name string
+		got  Color
+		want float32
+	}{
+		{name: "nearest", got: m.nearest(s, st, WrapRepeat), want: 1},
+		{name: "bilinear", got: m.bilinear(0, s, st, WrapRepeat), want: 1},
+		{name: "bilinear between rows", got: m.bilinear(0, s, 1.0/64, WrapRepeat), want: 0.5},
+		{name: "bilinear wrapped", got: m.bilinear(0, s, 0, WrapRepeat), want: 0.5},
+		{name: "bilinear black", got: m.bilinear(0, s, 0, WrapBlack), want: 0.5},
+		{name: "trilinear blurs", got: m.trilinear(s, st, wide, thin, WrapRepeat), want: 0.5},
+		{name: "trilinear small", got: m.trilinear(s, st, thin, thin, WrapRepeat), want: 1},
+		{name: "ewa stays sharp", got: m.ewa(s, st, wide, thin, 64, WrapRepeat), want: 1},
+		{name: "ewa anisotropy bounded", got: m.ewa(s, st, wide, thin, 1, WrapRepeat), want: 0.5},
+	} {
+		if absf(tt.got.r-tt.want) > 0.05 {
+			t.Errorf("%d) %s: got %v want %f", i, tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestImageTextureDifferentials(t *testing.T) {
+	m := flatGrid(2)
+	ray := NewRay(Vector{0.3, 1, -0.3}, Vector{0, -1, 0})
+	ray.Differential = &RayDifferential{
+		RxOrigin:    Vector{0.31, 1, -0.3},
+		RyOrigin:    Vector{0.3, 1, -0.32},
+		RxDirection: ray.Direction,
+		RyDirection: ray.Direction,
+	}
+	for i, tt := range []struct {
+		toWorld          Transform
+		wantDx, wantDy   Vector
+		wantUVx, wantUVy Vector
+	}{
+		{
+			wantDx:  Vector{0.01, 0, 0},
+			wantDy:  Vector{0, 0, -0.02},
+			wantUVx: Vector{0.01, 0, 0},
+			wantUVy: Vector{0, 0.02, 0},
+		},
+		{
+			// twice as large, so the same footprint covers half the uvs
+			toWorld: Scale(2, 2, 2),
+			wantDx:  Vector{0.005, 0, 0},
+			wantDy:  Vector{0, 0, -0.01},
+			wantUVx: Vector{0.005, 0, 0},
+			wantUVy: Vector{0, 0.01, 0},
+		},
+	} {
+		var o Object = m
+		if tt.toWorld != (Transform{}) {
+			o = NewSharedObject(m, tt.toWorld)
+		}
+		si, ok := o.Intersect(ray)
+		if !ok {
+			t.Fatalf("%d) expected hit", i)
+		}
+		dpdx, dpdy, ok := si.differentials()
+		if !ok || !compareVectors(dpdx, tt.wantDx) || !compareVectors(dpdy, tt.wantDy) {
+			t.Errorf("%d) got %v %v want %v %v", i, dpdx, dpdy, tt.wantDx, tt.wantDy)
+		}
+		uv := TriangleMeshUVFunc(si)
+		duvdx, duvdy, ok := uvDifferentials(si, TriangleMeshUVFunc, uv)
+		if !ok || !compareVectors(duvdx, tt.wantUVx) || !compareVectors(duvdy, tt.wantUVy) {
+			t.Errorf("%d) got %v %v want %v %v", i, duvdx, duvdy, tt.wantUVx, tt.wantUVy)
+		}
+	}
+}
@@ -155,10 +155,37 @@ func (so *SharedObject) Intersect(ray Ray) (*SurfaceInteraction, bool) {
 	}
 	// transform surface interaction info back to world space
 	si.Point = so.ObjectToWorld.Point(si.UntransformedPoint)
-	si.normal = so.ObjectToWorld.Normal(si.UntransformedNormal)
+	si.normal = so.ObjectToWorld.Normal(si.UntransformedNormal).Normalize()
+	// the object space ray is normalized, so distances differ if scaled
+	si.distance = VectorFromTo(ray.Origin, si.Point).Length()
+	if si.instance == nil {
+		si.instance = so
+	}
 	return si, true
 }
 
+// Intervals of a shared solid are transformed like its hits in Intersect
+func (so *SharedObject) Intervals(ray Ray) []Interval {
+	solid, ok := so.Object.(Solid)
+	if !ok {
+		panic("shared object is not a solid!")
+	}
+	r := so.WorldToObject.Ray(ray)
+	intervals := solid.Intervals(r)
+	for _, i := range intervals {
+		for _, si := range []*SurfaceInteraction{i.In, i.Out} {
+			si.Point = so.ObjectToWorld.Point(si.UntransformedPoint)
+			si.normal = so.ObjectToWorld.Normal(si.UntransformedNormal).Normalize()
+			// signed, as intervals can start behind the ray
+			si.distance = VectorFromTo(ray.Origin, si.Point).Dot(ray.Direction)
+			if si.instance == nil {
+				si.instance = so
+			}
+		}
+	}
+	return intervals
+}
+
 func (so *SharedObject) SurfaceNormal(Vector) Vector {
 	panic("Dont call this function!")
 	return Vector{}
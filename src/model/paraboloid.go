@@ -0,0 +1,59 @@
+package model
+
+// A Paraboloid z = ZMax (x^2 + y^2) / Radius^2 with its vertex at the
+// origin, cut off between ZMin and ZMax and swept up to PhiMax radians
+// around the z axis: pbrt 150
+type Paraboloid struct {
+	shape
+	Radius     float32
+	ZMin, ZMax float32
+	PhiMax     float64
+}
+
+func NewParaboloid(toWorld Transform, radius, zMin, zMax float32, phiMax float64, m Material) Paraboloid {
+	if zMin > zMax {
+		zMin, zMax = zMax, zMin
+	}
+	return Paraboloid{
+		shape:  newShape(toWorld, m),
+		Radius: radius,
+		ZMin:   zMin,
+		ZMax:   zMax,
+		PhiMax: clampPhiMax(phiMax),
+	}
+}
+
+func (p Paraboloid) Bound(t Transform) AABB {
+	return p.bound(t, Vector{-p.Radius, -p.Radius, p.ZMin}, Vector{p.Radius, p.Radius, p.ZMax})
+}
+
+func (p Paraboloid) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	l := p.worldToObject.Ray(r)
+	ox, oy, oz := float64(l.Origin.X), float64(l.Origin.Y), float64(l.Origin.Z)
+	dx, dy, dz := float64(l.Direction.X), float64(l.Direction.Y), float64(l.Direction.Z)
+	k := float64(p.ZMax / (p.Radius * p.Radius))
+	a := k * (dx*dx + dy*dy)
+	b := 2*k*(dx*ox+dy*oy) - dz
+	c := k*(ox*ox+oy*oy) - oz
+	return p.hit(p, r, l, quadratic(a, b, c), p.inside, p.normal)
+}
+
+func (p Paraboloid) inside(q Vector) bool {
+	return q.Z >= p.ZMin && q.Z <= p.ZMax && phi(q) <= p.PhiMax
+}
+
+// the gradient of k (x^2 + y^2) - z, pointing away from the axis
+func (p Paraboloid) normal(q Vector) Vector {
+	k := p.ZMax / (p.Radius * p.Radius)
+	return Vector{2 * k * q.X, 2 * k * q.Y, -1}
+}
+
+func (p Paraboloid) SurfaceNormal(q Vector) Vector {
+	return p.surfaceNormal(q, p.normal)
+}
+
+// u goes around the axis, v from ZMin to ZMax
+func (p Paraboloid) UV(q Vector) Vector {
+	o := p.worldToObject.Point(q)
+	return Vector{float32(phi(o) / p.PhiMax), (o.Z - p.ZMin) / (p.ZMax - p.ZMin), 0}
+}
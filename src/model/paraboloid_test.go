@@ -0,0 +1,76 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParaboloidIntersect(t *testing.T) {
+	for i, tt := range []struct {
+		p         Paraboloid
+		r         Ray
+		want      float32
+		wantTruth bool
+	}{
+		{
+			p:         NewParaboloid(ScaleUniform(1), 1, 0, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{0, 0, 5}, Vector{0, 0, -1}),
+			want:      5.0,
+			wantTruth: true,
+		},
+		{
+			p:         NewParaboloid(ScaleUniform(1), 1, 0, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 0.25}, Vector{-1, 0, 0}),
+			want:      4.5,
+			wantTruth: true,
+		},
+		{
+			// the vertex is cut off below ZMin
+			p:         NewParaboloid(ScaleUniform(1), 1, 0.5, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 0.25}, Vector{-1, 0, 0}),
+			wantTruth: false,
+		},
+		{
+			// the open top is not part of the surface
+			p:         NewParaboloid(ScaleUniform(1), 1, 0.5, 1, 2*math.Pi, nil),
+			r:         NewRay(Vector{0, 0, 5}, Vector{0, 0, -1}),
+			wantTruth: false,
+		},
+	} {
+		got, found := tt.p.Intersect(tt.r)
+		if !found && tt.wantTruth == false {
+			continue
+		}
+		if (!found && tt.wantTruth == true) || (found && tt.wantTruth == false) {
+			t.Errorf("%d) incorrect bool value; want %v", i, tt.wantTruth)
+			continue
+		}
+		if !compareFloat32(got.distance, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got.distance, tt.want)
+		}
+	}
+}
+
+func TestParaboloidSurfaceNormal(t *testing.T) {
+	for i, tt := range []struct {
+		p    Paraboloid
+		v    Vector
+		want Vector
+	}{
+		{
+			p:    NewParaboloid(ScaleUniform(1), 1, 0, 1, 2*math.Pi, nil),
+			v:    Vector{0, 0, 0},
+			want: Vector{0, 0, -1},
+		},
+		{
+			p:    NewParaboloid(ScaleUniform(1), 1, 0, 1, 2*math.Pi, nil),
+			v:    Vector{0.5, 0, 0.25},
+			want: Vector{0.70710678, 0, -0.70710678},
+		},
+	} {
+		got := tt.p.SurfaceNormal(tt.v)
+		if !compareVectors(got, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Photon mapping: Jensen, pbrt ch16.2
+// Photons are emitted from the scene's emitters and followed through the
+// scene; every time one lands on a diffuse surface after at least one bounce
+// it is stored. The indirect light at a diffuse point is then estimated
+// from the density of photons around it. Because photons are followed
+// through specular materials, this includes caustics.
+
+// alpha in the progressive photon mapping radius reduction: the fraction
+// of photons kept each pass
+const PROGRESSIVE_ALPHA = 0.7
+
+type photon struct {
+	point Vector
+	// direction the photon was travelling in when it landed
+	direction Vector
+	power     Color
+	// split axis for this photon's node in the kd-tree
+	axis Dimension
+}
+
+// A PhotonMap stores photons in a left-balanced kd-tree
+// the node for range [lo, hi) is the photon at index (lo+hi)/2
+type PhotonMap struct {
+	photons []photon
+}
+
+// NewPhotonMap emits n photons into the scene, following each for at most
+// maxDepth bounces or until russian roulette absorbs it
+func NewPhotonMap(scene *Scene, n, maxDepth int) *PhotonMap {
+	if maxDepth <= 0 {
+		maxDepth = DEFAULT_MAX_RAY_DEPTH
+	}
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	photons := []photon{}
+	for i := 0; i < n; i++ {
+		photons = tracePhoton(random, scene, n, maxDepth, photons)
+	}
+	buildKDTree(photons)
+	return &PhotonMap{photons: photons}
+}
+
+func tracePhoton(random *rand.Rand, scene *Scene, n, maxDepth int, photons []photon) []photon {
+	light, pmf := scene.emissionLight(random)
+	ray, normal, le, pdfPos, pdfDir := light.SampleLe(random)
+	if pmf == 0 || pdfPos == 0 || pdfDir == 0 {
+		return photons
+	}
+	cos := float32(1)
+	if normal != (Vector{}) {
+		// two-sided emitters also emit against their normal
+		cos = float32(math.Abs(float64(normal.Dot(ray.Direction))))
+	}
+	power := le.Times(cos / (pmf * pdfPos * pdfDir * float32(n)))
+
+	for depth := 0; depth < maxDepth; depth++ {
+		si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+		if !ok || si.object.IsLight() {
+			break
+		}
+		si.applyShadingNormal()
+		if direction, tint, ok := scatterSpecular(random, si, ray.Direction); ok {
+			power = power.Product(tint)
+			ray = NewRay(si.Point, direction)
+			continue
+		}
+		if si.normal.Dot(ray.Direction) >= 0 {
+			// diffuse surfaces are one-sided
+			break
+		}
+		// direct light is handled by light sampling instead
+		if depth > 0 {
+			photons = append(photons, photon{
+				point:     si.Point,
+				direction: ray.Direction,
+				power:     power,
+			})
+		}
+		// russian roulette on the albedo keeps photon power constant
+		albedo := si.object.GetColor(si)
+		survive := albedo.MaxComponent()
+		if survive > 1 {
+			survive = 1
+		}
+		if random.Float32() >= survive {
+			break
+		}
+		power = power.Product(albedo.Times(1 / survive))
+		ray = NewRay(si.Point, si.object.SampleDirection(random, si.normal))
+	}
+	return photons
+}
+
+type byPhotonDim struct {
+	dim     Dimension
+	photons []photon
+}
+
+func (s byPhotonDim) Len() int {
+	return len(s.photons)
+}
+func (s byPhotonDim) Swap(i, j int) {
+	s.photons[i], s.photons[j] = s.photons[j], s.photons[i]
+}
+func (s byPhotonDim) Less(i, j int) bool {
+	return s.photons[i].point.Get(s.dim) < s.photons[j].point.Get(s.dim)
+}
+
+// buildKDTree reorders photons in place such that each range is split
+// at its median along the dimension of largest extent
+// TODO: same as SplitEqualCounts, a partial sort would be O(n)
+func buildKDTree(photons []photon) {
+	if len(photons) <= 1 {
+		return
+	}
+	bounds := NewAABB(photons[0].point, photons[1].point)
+	for _, p := range photons[2:] {
+		bounds = bounds.AddPoint(p.point)
+	}
+	dim := bounds.MaximumExtent()
+	sort.Sort(byPhotonDim{dim: dim, photons: photons})
+	mid := len(photons) / 2
+	photons[mid].axis = dim
+	buildKDTree(photons[:mid])
+	buildKDTree(photons[mid+1:])
+}
+
+// lookup calls f for every photon within radius of p
+func (pm *PhotonMap) lookup(p Vector, radius float32, f func(photon)) {
+	lookupKDTree(pm.photons, p, radius*radius, f)
+}
+
+func lookupKDTree(photons []photon, p Vector, radius2 float32, f func(photon)) {
+	if len(photons) == 0 {
+		return
+	}
+	mid := len(photons) / 2
+	node := photons[mid]
+	if d := VectorFromTo(node.point, p); d.Dot(d) <= radius2 {
+		f(node)
+	}
+	if len(photons) == 1 {
+		return
+	}
+	delta := p.Get(node.axis) - node.point.Get(node.axis)
+	if delta <= 0 || delta*delta < radius2 {
+		lookupKDTree(photons[:mid], p, radius2, f)
+	}
+	if delta >= 0 || delta*delta < radius2 {
+		lookupKDTree(photons[mid+1:], p, radius2, f)
+	}
+}
+
+// estimate the reflected radiance at a diffuse surface from the photon
+// density within radius of si
+func (pm *PhotonMap) estimate(si *SurfaceInteraction, radius float32) Color {
+	flux := NewColor(0, 0, 0)
+	pm.lookup(si.Point, radius, func(ph photon) {
+		// only count photons arriving at the same side of the surface
+		if si.normal.Dot(ph.direction) < 0 {
+			flux = flux.Add(ph.power)
+		}
+	})
+	brdf := si.object.GetColor(si).Times(INVPI)
+	return flux.Product(brdf).Times(1 / (math.Pi * radius * radius))
+}
+
+// ProgressiveRadius returns the photon lookup radius for the next pass in
+// progressive photon mapping, given the radius used in pass i (1-indexed):
+// Knaus and Zwicker 2011. Averaging the passes converges to the right answer
+func ProgressiveRadius(radius float32, i int) float32 {
+	r2 := radius * radius * (float32(i) + PROGRESSIVE_ALPHA) / float32(i+1)
+	return float32(math.Sqrt(float64(r2)))
+}
+
+type photonMappingTracer struct {
+	tracer
+	photons *PhotonMap
+	radius  float32
+}
+
+// NewPhotonMappingTracer follows camera rays through specular materials and
+// uses direct light sampling plus the photon map at the first diffuse hit
+func NewPhotonMappingTracer(maxDepth int, photons *PhotonMap, radius float32) Tracer {
+	return &photonMappingTracer{
+		tracer:  newTracer(maxDepth),
+		photons: photons,
+		radius:  radius,
+	}
+}
+
+func (pt *photonMappingTracer) GetRayColor(ray Ray, scene *Scene, depth int) Color {
+	throughput := NewColor(255, 255, 255)
+	for ; depth < pt.maxDepth; depth++ {
+		si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+		if !ok {
+			break
+		}
+		si.as = scene.AccelerationStructure
+		si.depth = depth
+		si.tracer = pt
+		si.applyShadingNormal()
+
+		// only reached directly or through a chain of specular bounces,
+		// which light sampling cannot account for
+		if si.object.IsLight() {
+			return throughput.Product(emittedRadiance(si, ray.Direction.Times(-1)))
+		}
+		if direction, tint, ok := scatterSpecular(pt.random, si, ray.Direction); ok {
+			throughput = throughput.Product(tint)
+			ray = NewRay(si.Point, direction)
+			continue
+		}
+		if si.normal.Dot(ray.Direction) >= 0 {
+			break
+		}
+		color := pt.photons.estimate(si, pt.radius)
+		if _, lightColor, wi, lightPDF, ok := sampleDirectLight(pt.random, scene, si); ok {
+			brdf := si.object.GetColor(si).Times(INVPI)
+			direct := lightColor.Product(brdf).Times(si.normal.Dot(wi) / lightPDF)
+			color = color.Add(direct)
+		}
+		return throughput.Product(color)
+	}
+	return BLACK
+}
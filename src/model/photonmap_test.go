@@ -0,0 +1,55 @@
+package model
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestPhotonMapLookup(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	photons := make([]photon, 1000)
+	for i := range photons {
+		p := Vector{random.Float32(), random.Float32(), random.Float32()}
+		photons[i] = photon{point: p.Times(10)}
+	}
+	unsorted := make([]photon, len(photons))
+	copy(unsorted, photons)
+	pm := &PhotonMap{photons: photons}
+	buildKDTree(pm.photons)
+
+	for i, tt := range []struct {
+		p      Vector
+		radius float32
+	}{
+		{p: Vector{5, 5, 5}, radius: 1},
+		{p: Vector{0, 0, 0}, radius: 2.5},
+		{p: Vector{9, 1, 4}, radius: 0.5},
+		{p: Vector{20, 20, 20}, radius: 1},
+	} {
+		want := 0
+		for _, ph := range unsorted {
+			d := VectorFromTo(ph.point, tt.p)
+			if d.Dot(d) <= tt.radius*tt.radius {
+				want++
+			}
+		}
+		got := 0
+		pm.lookup(tt.p, tt.radius, func(photon) {
+			got++
+		})
+		if got != want {
+			t.Errorf("%d) got %d photons want %d", i, got, want)
+		}
+	}
+}
+
+func TestProgressiveRadius(t *testing.T) {
+	radius := float32(1)
+	for i := 1; i <= 100; i++ {
+		next := ProgressiveRadius(radius, i)
+		if next >= radius || next <= 0 {
+			t.Fatalf("%d) radius should shrink: got %v after %v", i, next, radius)
+		}
+		radius = next
+	}
+}
@@ -1,15 +1,37 @@
 package model
 
-import "math/rand"
+import (
+	"math/rand"
+)
 
 type Scene struct {
 	Objects []Object
-	// TODO: consolidate these two
-	Lights   []Light
-	Emitters []Triangle
+	// lights added to the scene, such as point and distant lights.
+	// Objects with a RadiantMaterial are found and lit by Precompute
+	Lights []Light
+	// medium filling the scene outside of any medium boundary, can be nil
+	Medium Medium
+	// light arriving from infinitely far away, can be nil
+	Environment Environment
+	// how direct light sampling chooses between lights
+	LightSampling LightSampling
 
 	Camera                Camera
 	AccelerationStructure AccelerationStructure
+
+	// Lights plus an area light for every emitter among the objects
+	lights []Light
+	// area lights by the primitive and instance they were found in
+	areaLights map[areaLightKey]*AreaLight
+	// chooses lights for direct light sampling
+	lightSampler lightSampler
+	// chooses lights by power to start light subpaths and photons from
+	emissionSampler *powerLightSampler
+}
+
+type areaLightKey struct {
+	object   Object
+	instance *SharedObject
 }
 
 func NewScene(camera Camera) *Scene {
@@ -29,15 +51,115 @@ func (s *Scene) AddLights(l ...Light) {
 }
 
 func (s *Scene) Precompute() {
-	// TODO: loop over all objects and add emitters to emmiters list
 	s.AccelerationStructure = NewBVH(s.Objects, SplitSurfaceAreaHeuristic)
+	var bounds AABB
+	if len(s.Objects) > 0 {
+		bounds = ObjectsBound(s.Objects, identity)
+	}
+	s.lights = make([]Light, 0, len(s.Lights))
+	for _, l := range s.Lights {
+		if p, ok := l.(preprocessor); ok {
+			l = p.preprocess(bounds)
+		}
+		s.lights = append(s.lights, l)
+	}
+	s.areaLights = map[areaLightKey]*AreaLight{}
+	// only used to estimate the power of area lights
+	random := rand.New(rand.NewSource(0))
+	for _, o := range s.Objects {
+		s.addAreaLights(random, o, nil, identity)
+	}
+	s.lightSampler = newLightSampler(s.LightSampling, s.lights)
+	s.emissionSampler = newPowerLightSampler(s.lights)
+}
+
+// addAreaLights walks object o, which is placed in the world by toWorld
+// as part of instance, and adds an area light for every emitter in it
+func (s *Scene) addAreaLights(random *rand.Rand, o Object, instance *SharedObject, toWorld Transform) {
+	switch t := o.(type) {
+	case *ComplexObject:
+		for _, c := range t.Objects() {
+			s.addAreaLights(random, c, instance, toWorld)
+		}
+	case *TriangleMesh:
+		for _, c := range t.as.GetObjects() {
+			s.addAreaLights(random, c, instance, toWorld)
+		}
+	case *SharedObject:
+		// hits only record the innermost instance, so copies of a nested
+		// instance share one area light for multiple importance sampling
+		s.addAreaLights(random, t.Object, t, toWorld.Mul(t.ObjectToWorld))
+	default:
+		e, ok := o.(Emitter)
+		if !ok || !o.IsLight() {
+			return
+		}
+		light := newAreaLight(random, e, toWorld)
+		s.lights = append(s.lights, light)
+		s.areaLights[areaLightKey{o, instance}] = light
+	}
+}
+
+// areaLight returns the area light that the surface hit by si is part of
+func (s *Scene) areaLight(si *SurfaceInteraction) (*AreaLight, bool) {
+	if !si.object.IsLight() {
+		return nil, false
+	}
+	light, ok := s.areaLights[areaLightKey{si.object, si.instance}]
+	return light, ok
+}
+
+// number of lights to choose from in direct light sampling
+func (s *Scene) lightCount() int {
+	if s.Environment != nil {
+		return len(s.lights) + 1
+	}
+	return len(s.lights)
+}
+
+// chooseEnvironment decides whether direct light sampling samples the
+// environment instead of one of the lights; each is equally likely
+func (s *Scene) chooseEnvironment(random *rand.Rand) bool {
+	if s.Environment == nil {
+		return false
+	}
+	return random.Intn(s.lightCount()) == len(s.lights)
+}
+
+// sampleLight chooses a light for direct light sampling at p with
+// surface normal n, after chooseEnvironment decided against the
+// environment. It returns the light and the probability of having chosen
+// it, or nil if no light is expected to reach p
+func (s *Scene) sampleLight(random *rand.Rand, p, n Vector) (Light, float32) {
+	if len(s.lights) == 0 {
+		panic("no light in scene!")
+	}
+	l, pmf := s.lightSampler.sample(random.Float32(), p, n)
+	return l, pmf * s.lightsPMF()
+}
+
+// lightPMF is the probability of sampleLight choosing l at p
+func (s *Scene) lightPMF(p, n Vector, l Light) float32 {
+	return s.lightSampler.pmf(p, n, l) * s.lightsPMF()
+}
+
+// probability of choosing one of the lights over the environment
+func (s *Scene) lightsPMF() float32 {
+	return float32(len(s.lights)) / float32(s.lightCount())
+}
+
+// probability of choosing the environment in direct light sampling
+func (s *Scene) environmentPMF() float32 {
+	return 1 / float32(s.lightCount())
 }
 
-func (s *Scene) randomEmitter(random *rand.Rand) Triangle {
-	if len(s.Emitters) == 0 {
+// emissionLight chooses a light proportional to power to start a light
+// subpath or photon from, and returns the probability of choosing it
+func (s *Scene) emissionLight(random *rand.Rand) (Light, float32) {
+	if len(s.lights) == 0 {
 		panic("no light in scene!")
 	}
-	return s.Emitters[random.Intn(len(s.Emitters))]
+	return s.emissionSampler.sample(random.Float32(), Vector{}, Vector{})
 }
 
 func SetBackgroundColor(c Color) {
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPrecomputeFindsAreaLights(t *testing.T) {
+	radiant := NewRadiantMaterial(NewConstantTexture(NewColor(255, 255, 255)))
+	diffuse := NewDiffuseMaterial(NewConstantTexture(NewColor(255, 255, 255)))
+	// unit right triangle facing down, area 0.5
+	tri := NewTriangle(Vector{0, 0, 0}, Vector{1, 0, 0}, Vector{0, 0, 1}, radiant)
+	mesh := NewTriangleMesh([]Vector{{0, 0, 0}, {0, 0, 1}, {1, 0, 0}, {1, 0, 1}}, []Face{{0, 1, 2}, {2, 1, 3}}, radiant)
+	instanced := NewTriangleComplexObject([]Triangle{tri})
+
+	camera := NewPerspectiveCamera(1, 1, 1)
+	scene := NewScene(camera)
+	scene.Add(
+		tri,
+		NewSphere(Vector{0, 5, 10}, 1, diffuse),
+		NewComplexObject([]Object{NewSphere(Vector{5, 5, 5}, 1, radiant), NewSphere(Vector{-5, 5, 5}, 1, diffuse)}),
+		mesh,
+		NewSharedObject(instanced, Translate(Vector{0, 10, 0}).Mul(ScaleUniform(2))),
+	)
+	scene.AddLights(NewPointLight(Vector{0, 20, 0}, NewColor(255, 255, 255), 1))
+	scene.Precompute()
+
+	// the point light, the triangle, the sphere, two mesh triangles and the instance
+	if len(scene.lights) != 6 || len(scene.areaLights) != 5 {
+		t.Fatalf("got %d lights and %d area lights", len(scene.lights), len(scene.areaLights))
+	}
+	var area float32
+	for _, l := range scene.lights[1:] {
+		area += l.(*AreaLight).area
+	}
+	if want := 0.5 + 4*math.Pi + 1 + 2; math.Abs(float64(area)-want) > 1e-4 {
+		t.Errorf("got total area %f want %f", area, want)
+	}
+	// a hit on the instance finds its area light, placed in world space
+	si, ok := scene.AccelerationStructure.ClosestIntersection(NewRay(Vector{0.5, 0, 0.5}, Vector{0, 1, 0}), MAX_RAY_DISTANCE)
+	if !ok {
+		t.Fatal("instance not hit")
+	}
+	if si.distance != 10 {
+		t.Errorf("got world space distance %f want 10", si.distance)
+	}
+	light, ok := scene.areaLight(si)
+	if !ok || light.area != 2 {
+		t.Fatalf("got area light %v", light)
+	}
+	_, segment, pdf := light.SampleLi(rand.New(rand.NewSource(42)), Vector{0.5, 0, 0.5})
+	if math.Abs(float64(segment.Y-10)) > 1e-4 || pdf == 0 {
+		t.Errorf("got segment %v with pdf %f towards the instance", segment, pdf)
+	}
+}
@@ -0,0 +1,280 @@
+package model
+
+import "math"
+
+// default precision of sphere tracing an SDFObject
+const (
+	SDF_EPSILON   = 1e-3
+	SDF_MAX_STEPS = 256
+)
+
+// An SDF is a signed distance function: it returns the distance from p to
+// the closest surface, negative inside. Sphere tracing only needs a lower
+// bound on that distance, so combinations such as smooth unions are fine
+type SDF func(p Vector) float32
+
+// An SDFObject is the surface where Distance is zero, found by sphere
+// tracing rays through Bounds, which has to contain the whole surface.
+// A hit is found within Epsilon of the surface, in at most MaxSteps steps
+type SDFObject struct {
+	object
+	Distance SDF
+	Bounds   AABB
+	Epsilon  float32
+	MaxSteps int
+}
+
+func NewSDFObject(f SDF, bounds AABB, m Material) *SDFObject {
+	return &SDFObject{
+		object:   object{m},
+		Distance: f,
+		Bounds:   bounds,
+		Epsilon:  SDF_EPSILON,
+		MaxSteps: SDF_MAX_STEPS,
+	}
+}
+
+func (s *SDFObject) Bound(t Transform) AABB {
+	return s.Bounds.Transform(t)
+}
+
+// Intersect marches along the ray by the distance to the closest surface,
+// which can never overshoot it: Hart, Sphere tracing, 1996
+func (s *SDFObject) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	t, tMax, ok := s.Bounds.intersectRange(r)
+	if !ok {
+		return nil, false
+	}
+	// rays leaving the surface start within epsilon of it, so they
+	// first have to get away before anything counts as a hit
+	escaped := absf(s.Distance(r.Origin)) >= s.Epsilon
+	for i := 0; i < s.MaxSteps && t <= tMax; i++ {
+		d := absf(s.Distance(PointFromRay(r, t)))
+		if d >= s.Epsilon {
+			escaped = true
+		} else if escaped && t > ERROR_MARGIN {
+			n := s.SurfaceNormal(PointFromRay(r, t))
+			return NewSurfaceInteraction(s, t, n, r), true
+		}
+		t += maxf(d, s.Epsilon)
+	}
+	return nil, false
+}
+
+// the gradient of the distance by central differences
+func (s *SDFObject) SurfaceNormal(p Vector) Vector {
+	h := s.Epsilon
+	return Vector{
+		s.Distance(Vector{p.X + h, p.Y, p.Z}) - s.Distance(Vector{p.X - h, p.Y, p.Z}),
+		s.Distance(Vector{p.X, p.Y + h, p.Z}) - s.Distance(Vector{p.X, p.Y - h, p.Z}),
+		s.Distance(Vector{p.X, p.Y, p.Z + h}) - s.Distance(Vector{p.X, p.Y, p.Z - h}),
+	}.Normalize()
+}
+
+// Most distance functions below are from Inigo Quilez,
+// iquilezles.org/articles/distfunctions
+
+// SphereSDF is a sphere of radius r around the origin
+func SphereSDF(r float32) SDF {
+	return func(p Vector) float32 {
+		return p.Length() - r
+	}
+}
+
+// BoxSDF is a box around the origin, with half its size in each dimension
+// given by b
+func BoxSDF(b Vector) SDF {
+	return func(p Vector) float32 {
+		q := Vector{absf(p.X) - b.X, absf(p.Y) - b.Y, absf(p.Z) - b.Z}
+		outside := VectorMax(q, Vector{}).Length()
+		inside := minf(maxf(q.X, maxf(q.Y, q.Z)), 0)
+		return outside + inside
+	}
+}
+
+// RoundBoxSDF is a BoxSDF with its edges rounded off by radius r
+func RoundBoxSDF(b Vector, r float32) SDF {
+	return BoxSDF(Vector{b.X - r, b.Y - r, b.Z - r}).Round(r)
+}
+
+// TorusSDF is a torus around the y axis, with a tube of minor radius
+// circling the origin at major radius
+func TorusSDF(major, minor float32) SDF {
+	return func(p Vector) float32 {
+		xz := float32(math.Sqrt(float64(p.X*p.X+p.Z*p.Z))) - major
+		return float32(math.Sqrt(float64(xz*xz+p.Y*p.Y))) - minor
+	}
+}
+
+// CapsuleSDF is a line segment from a to b, thickened by radius r
+func CapsuleSDF(a, b Vector, r float32) SDF {
+	ab := VectorFromTo(a, b)
+	return func(p Vector) float32 {
+		ap := VectorFromTo(a, p)
+		h := clampf(ap.Dot(ab)/ab.Dot(ab), 0, 1)
+		return ap.Sub(ab.Times(h)).Length() - r
+	}
+}
+
+// PlaneSDF is the half space below the plane through the origin with
+// normal n
+func PlaneSDF(n Vector) SDF {
+	n = n.Normalize()
+	return func(p Vector) float32 {
+		return p.Dot(n)
+	}
+}
+
+// MandelbulbSDF estimates the distance to the Mandelbulb fractal of the
+// given power, which fits in a sphere of radius 1.2 around the origin.
+// More iterations add detail; Hart's distance estimator as explained by
+// Christensen, blog.hvidtfeldts.net
+func MandelbulbSDF(power float64, iterations int) SDF {
+	return func(p Vector) float32 {
+		c := vector64(p)
+		z := c
+		dr, r := 1.0, 0.0
+		for i := 0; i < iterations; i++ {
+			r = math.Sqrt(dot64(z, z))
+			if r > 2 {
+				break
+			}
+			if r == 0 {
+				return -1
+			}
+			theta := math.Acos(z[2]/r) * power
+			phi := math.Atan2(z[1], z[0]) * power
+			dr = math.Pow(r, power-1)*power*dr + 1
+			zr := math.Pow(r, power)
+			z = [3]float64{
+				zr*math.Sin(theta)*math.Cos(phi) + c[0],
+				zr*math.Sin(theta)*math.Sin(phi) + c[1],
+				zr*math.Cos(theta) + c[2],
+			}
+		}
+		if r == 0 {
+			return -1
+		}
+		return float32(0.5 * math.Log(r) * r / dr)
+	}
+}
+
+// Union is the surface of either solid
+func (f SDF) Union(g SDF) SDF {
+	return func(p Vector) float32 {
+		return minf(f(p), g(p))
+	}
+}
+
+// Subtract cuts g out of f
+func (f SDF) Subtract(g SDF) SDF {
+	return func(p Vector) float32 {
+		return maxf(f(p), -g(p))
+	}
+}
+
+// Intersect is the surface of what lies inside both solids
+func (f SDF) Intersect(g SDF) SDF {
+	return func(p Vector) float32 {
+		return maxf(f(p), g(p))
+	}
+}
+
+// SmoothUnion blends the solids together where they are closer than k
+func (f SDF) SmoothUnion(g SDF, k float32) SDF {
+	return func(p Vector) float32 {
+		a, b := f(p), g(p)
+		h := clampf(0.5+0.5*(b-a)/k, 0, 1)
+		return mixf(b, a, h) - k*h*(1-h)
+	}
+}
+
+// SmoothSubtract cuts g out of f, rounding the cut by k
+func (f SDF) SmoothSubtract(g SDF, k float32) SDF {
+	return func(p Vector) float32 {
+		a, b := f(p), g(p)
+		h := clampf(0.5-0.5*(a+b)/k, 0, 1)
+		return mixf(a, -b, h) + k*h*(1-h)
+	}
+}
+
+// SmoothIntersect intersects the solids, rounding their edges by k
+func (f SDF) SmoothIntersect(g SDF, k float32) SDF {
+	return func(p Vector) float32 {
+		a, b := f(p), g(p)
+		h := clampf(0.5-0.5*(b-a)/k, 0, 1)
+		return mixf(b, a, h) + k*h*(1-h)
+	}
+}
+
+// Round inflates the surface by r, rounding its edges
+func (f SDF) Round(r float32) SDF {
+	return func(p Vector) float32 {
+		return f(p) - r
+	}
+}
+
+// Translate moves the surface by delta
+func (f SDF) Translate(delta Vector) SDF {
+	return func(p Vector) float32 {
+		return f(p.Sub(delta))
+	}
+}
+
+// Rotate applies a rotation; other transforms would distort distances
+func (f SDF) Rotate(rotation Transform) SDF {
+	inv := rotation.Inverse()
+	return func(p Vector) float32 {
+		return f(inv.Vector(p))
+	}
+}
+
+// Scale grows the surface uniformly around the origin by s
+func (f SDF) Scale(s float32) SDF {
+	return func(p Vector) float32 {
+		return f(p.Times(1/s)) * s
+	}
+}
+
+// Repeat repeats the surface infinitely in a grid with the given period;
+// dimensions with period zero are not repeated. Only surfaces that fit
+// in a single cell around the origin give correct distances. Bound the
+// SDFObject to limit the number of copies
+func (f SDF) Repeat(period Vector) SDF {
+	repeat := func(x, c float32) float32 {
+		if c == 0 {
+			return x
+		}
+		return x - c*float32(math.Floor(float64(x/c)+0.5))
+	}
+	return func(p Vector) float32 {
+		return f(Vector{repeat(p.X, period.X), repeat(p.Y, period.Y), repeat(p.Z, period.Z)})
+	}
+}
+
+func absf(x float32) float32 {
+	return float32(math.Abs(float64(x)))
+}
+
+func minf(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxf(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func clampf(x, lo, hi float32) float32 {
+	return minf(maxf(x, lo), hi)
+}
+
+// linear interpolation from a to b
+func mixf(a, b, t float32) float32 {
+	return a + (b-a)*t
+}
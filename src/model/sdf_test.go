@@ -0,0 +1,133 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSDFs(t *testing.T) {
+	for i, tt := range []struct {
+		f    SDF
+		p    Vector
+		want float32
+	}{
+		{f: SphereSDF(2), p: Vector{0, 3, 0}, want: 1},
+		{f: SphereSDF(2), p: Vector{0, 0, 0}, want: -2},
+		{f: BoxSDF(Vector{1, 2, 3}), p: Vector{3, 0, 0}, want: 2},
+		{f: BoxSDF(Vector{1, 2, 3}), p: Vector{2, 3, 0}, want: float32(math.Sqrt2)},
+		{f: BoxSDF(Vector{1, 2, 3}), p: Vector{0, 0, 0}, want: -1},
+		{f: RoundBoxSDF(Vector{1, 1, 1}, 0.5), p: Vector{2, 0, 0}, want: 1},
+		{f: RoundBoxSDF(Vector{1, 1, 1}, 0.5), p: Vector{2, 2, 0}, want: 1.5*float32(math.Sqrt2) - 0.5},
+		{f: TorusSDF(2, 0.5), p: Vector{2, 1, 0}, want: 0.5},
+		{f: TorusSDF(2, 0.5), p: Vector{0, 0, 0}, want: 1.5},
+		{f: CapsuleSDF(Vector{0, 0, 0}, Vector{0, 2, 0}, 0.5), p: Vector{1, 1, 0}, want: 0.5},
+		{f: CapsuleSDF(Vector{0, 0, 0}, Vector{0, 2, 0}, 0.5), p: Vector{0, 4, 0}, want: 1.5},
+		{f: PlaneSDF(Vector{0, 2, 0}), p: Vector{5, 3, 1}, want: 3},
+		{f: SphereSDF(1).Union(SphereSDF(1).Translate(Vector{3, 0, 0})), p: Vector{1.5, 0, 0}, want: 0.5},
+		{f: SphereSDF(2).Subtract(SphereSDF(1)), p: Vector{0, 0, 0}, want: 1},
+		{f: SphereSDF(2).Intersect(SphereSDF(2).Translate(Vector{3, 0, 0})), p: Vector{0, 0, 0}, want: 1},
+		// the blend fills the gap between the spheres
+		{f: SphereSDF(1).SmoothUnion(SphereSDF(1).Translate(Vector{3, 0, 0}), 1), p: Vector{1.5, 0, 0}, want: 0.25},
+		{f: SphereSDF(1).SmoothUnion(SphereSDF(1).Translate(Vector{30, 0, 0}), 1), p: Vector{0, 0, 0}, want: -1},
+		{f: SphereSDF(2).SmoothSubtract(SphereSDF(1), 0.5), p: Vector{0, 0, 0}, want: 1},
+		{f: SphereSDF(2).SmoothIntersect(SphereSDF(2).Translate(Vector{3, 0, 0}), 0.5), p: Vector{1.5, 0, 0}, want: -0.375},
+		{f: BoxSDF(Vector{1, 2, 3}).Rotate(RotateZ(math.Pi / 2)), p: Vector{3, 0, 0}, want: 1},
+		{f: SphereSDF(1).Scale(2), p: Vector{0, 3, 0}, want: 1},
+		{f: SphereSDF(1).Repeat(Vector{10, 0, 0}), p: Vector{31.5, 0, 0}, want: 0.5},
+		{f: SphereSDF(1).Repeat(Vector{10, 0, 0}), p: Vector{0, 11.5, 0}, want: 10.5},
+		{f: MandelbulbSDF(8, 10), p: Vector{0, 0, 0}, want: -1},
+	} {
+		if got := tt.f(tt.p); !compareFloat32(got, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestSDFObjectIntersect(t *testing.T) {
+	bounds := NewAABB(Vector{-2, -2, -2}, Vector{2, 2, 2})
+	for i, tt := range []struct {
+		s          *SDFObject
+		r          Ray
+		want       float32
+		wantNormal Vector
+		wantTruth  bool
+	}{
+		{
+			s:          NewSDFObject(SphereSDF(1), bounds, nil),
+			r:          NewRay(Vector{0, 0, 5}, Vector{0, 0, -1}),
+			want:       4,
+			wantNormal: Vector{0, 0, 1},
+			wantTruth:  true,
+		},
+		{
+			s:          NewSDFObject(SphereSDF(1), bounds, nil),
+			r:          NewRay(Vector{0, 0, 0}, Vector{1, 0, 0}),
+			want:       1,
+			wantNormal: Vector{1, 0, 0},
+			wantTruth:  true,
+		},
+		{
+			// a ray leaving the surface finds its other side
+			s:          NewSDFObject(SphereSDF(1), bounds, nil),
+			r:          NewRay(Vector{0, 0, 1}, Vector{0, 0, -1}),
+			want:       2,
+			wantNormal: Vector{0, 0, -1},
+			wantTruth:  true,
+		},
+		{
+			s:         NewSDFObject(SphereSDF(1), bounds, nil),
+			r:         NewRay(Vector{0, 0, 1}, Vector{0, 0, 1}),
+			wantTruth: false,
+		},
+		{
+			s:         NewSDFObject(SphereSDF(1), bounds, nil),
+			r:         NewRay(Vector{0, 1.5, 5}, Vector{0, 0, -1}),
+			wantTruth: false,
+		},
+		{
+			// through the hole of the torus
+			s:         NewSDFObject(TorusSDF(1, 0.5), bounds, nil),
+			r:         NewRay(Vector{0, 5, 0}, Vector{0, -1, 0}),
+			wantTruth: false,
+		},
+		{
+			s:          NewSDFObject(RoundBoxSDF(Vector{1, 1, 1}, 0.2), bounds, nil),
+			r:          NewRay(Vector{0.5, 5, 0.5}, Vector{0, -1, 0}),
+			want:       4,
+			wantNormal: Vector{0, 1, 0},
+			wantTruth:  true,
+		},
+	} {
+		got, found := tt.s.Intersect(tt.r)
+		if !found && tt.wantTruth == false {
+			continue
+		}
+		if (!found && tt.wantTruth == true) || (found && tt.wantTruth == false) {
+			t.Errorf("%d) incorrect bool value; want %v", i, tt.wantTruth)
+			continue
+		}
+		if math.Abs(float64(got.distance-tt.want)) > 2*SDF_EPSILON {
+			t.Errorf("%d) got %v want %v", i, got.distance, tt.want)
+		}
+		if !compareVectors(got.normal, tt.wantNormal) {
+			t.Errorf("%d) got normal %v want %v", i, got.normal, tt.wantNormal)
+		}
+	}
+}
+
+func TestSDFObjectInBVH(t *testing.T) {
+	var objects []Object
+	for i := 0; i < 10; i++ {
+		c := Vector{float32(3 * i), 0, 0}
+		f := SphereSDF(1).Translate(c)
+		objects = append(objects, NewSDFObject(f, NewAABB(c.Sub(Vector{1, 1, 1}), c.Add(Vector{1, 1, 1})), nil))
+	}
+	bvh := NewBVH(objects, SplitSurfaceAreaHeuristic)
+	si, ok := bvh.ClosestIntersection(NewRay(Vector{12, 0, 10}, Vector{0, 0, -1}), MAX_RAY_DISTANCE)
+	if !ok || math.Abs(float64(si.distance-9)) > 2*SDF_EPSILON {
+		t.Fatalf("got hit %v want distance 9", si)
+	}
+	if got := si.GetObject().Bound(ScaleUniform(1)).Centroid(); !compareVectors(got, Vector{12, 0, 0}) {
+		t.Errorf("hit object at %v want the one at x=12", got)
+	}
+}
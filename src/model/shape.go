@@ -0,0 +1,113 @@
+package model
+
+import "math"
+
+// shape is embedded by the analytic shapes such as Cylinder and Torus.
+// Like in pbrt they are defined in their own space around the z axis and
+// placed in the scene by a transform
+type shape struct {
+	object
+	objectToWorld Transform
+	worldToObject Transform
+}
+
+func newShape(toWorld Transform, m Material) shape {
+	return shape{
+		object:        object{m},
+		objectToWorld: toWorld,
+		worldToObject: toWorld.Inverse(),
+	}
+}
+
+// bound transforms the shape's bounds in object space
+func (s shape) bound(t Transform, min, max Vector) AABB {
+	return NewAABB(min, max).Transform(t.Mul(s.objectToWorld))
+}
+
+// hit returns the first of the object space distances ts along the
+// transformed ray that lies on the partial shape
+func (s shape) hit(o Object, r, local Ray, ts []float64, inside func(p Vector) bool, normal func(p Vector) Vector) (*SurfaceInteraction, bool) {
+	for _, t := range ts {
+		if t <= 0 {
+			continue
+		}
+		p := PointFromRay(local, float32(t))
+		if !inside(p) {
+			continue
+		}
+		// the object space ray is normalized, so distances differ if scaled
+		d := VectorFromTo(r.Origin, s.objectToWorld.Point(p)).Length()
+		if d <= ERROR_MARGIN {
+			continue
+		}
+		n := s.objectToWorld.Normal(normal(p)).Normalize()
+		return NewSurfaceInteraction(o, d, n, r), true
+	}
+	return nil, false
+}
+
+// interaction returns the surface interaction at object space distance t
+// along local, which can lie behind the ray
+func (s shape) interaction(o Object, r, local Ray, t float64, normal func(p Vector) Vector) *SurfaceInteraction {
+	p := PointFromRay(local, float32(t))
+	d := VectorFromTo(r.Origin, s.objectToWorld.Point(p)).Dot(r.Direction)
+	n := s.objectToWorld.Normal(normal(p)).Normalize()
+	return NewSurfaceInteraction(o, d, n, r)
+}
+
+func (s shape) surfaceNormal(p Vector, normal func(p Vector) Vector) Vector {
+	return s.objectToWorld.Normal(normal(s.worldToObject.Point(p))).Normalize()
+}
+
+// phi returns the angle of p around the z axis in [0,2pi)
+func phi(p Vector) float64 {
+	phi := math.Atan2(float64(p.Y), float64(p.X))
+	if phi < 0 {
+		phi += 2 * math.Pi
+	}
+	return phi
+}
+
+func clampPhiMax(phiMax float64) float64 {
+	return math.Max(0, math.Min(phiMax, 2*math.Pi))
+}
+
+// quadratic returns the real roots of at^2 + bt + c in ascending order,
+// avoiding cancellation: pbrt 1079
+func quadratic(a, b, c float64) []float64 {
+	if a == 0 {
+		if b == 0 {
+			return nil
+		}
+		return []float64{-c / b}
+	}
+	discrim := b*b - 4*a*c
+	if discrim < 0 {
+		return nil
+	}
+	root := math.Sqrt(discrim)
+	q := -0.5 * (b + root)
+	if b < 0 {
+		q = -0.5 * (b - root)
+	}
+	if q == 0 {
+		return []float64{0, 0}
+	}
+	t0, t1 := q/a, c/q
+	if t0 > t1 {
+		t0, t1 = t1, t0
+	}
+	return []float64{t0, t1}
+}
+
+// parametric shapes have a uv parameterisation of their surface
+type parametric interface {
+	UV(p Vector) Vector
+}
+
+// ParametricUVFunc returns the uv coordinates of the point hit on analytic
+// shapes such as Cylinder, Disk, Cone, Paraboloid and Torus, and of
+// Heightfields
+func ParametricUVFunc(si *SurfaceInteraction) Vector {
+	return si.GetObject().(parametric).UV(si.UntransformedPoint)
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestShapeBound(t *testing.T) {
+	for i, tt := range []struct {
+		o    Object
+		t    Transform
+		want AABB
+	}{
+		{
+			o:    NewCylinder(ScaleUniform(1), 1, -1, 2, 2*math.Pi, nil),
+			t:    ScaleUniform(1),
+			want: NewAABB(Vector{-1, -1, -1}, Vector{1, 1, 2}),
+		},
+		{
+			o:    NewDisk(Translate(Vector{0, 0, 1}), 1, 2, 1, 2*math.Pi, nil),
+			t:    ScaleUniform(1),
+			want: NewAABB(Vector{-2, -2, 2}, Vector{2, 2, 2}),
+		},
+		{
+			// the cone's axis along y, placed by a shared object
+			o:    NewCone(RotateX(-math.Pi/2), 2, 1, 2*math.Pi, nil),
+			t:    Translate(Vector{5, 0, 0}),
+			want: NewAABB(Vector{4, 0, -1}, Vector{6, 2, 1}),
+		},
+		{
+			o:    NewTorus(ScaleUniform(2), 2, 0.5, 2*math.Pi, nil),
+			t:    ScaleUniform(1),
+			want: NewAABB(Vector{-5, -5, -1}, Vector{5, 5, 1}),
+		},
+	} {
+		got := tt.o.Bound(tt.t)
+		if !compareVectors(got.Pmin, tt.want.Pmin) || !compareVectors(got.Pmax, tt.want.Pmax) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestParametricUVFunc(t *testing.T) {
+	for i, tt := range []struct {
+		o    Object
+		r    Ray
+		want Vector
+	}{
+		{
+			o:    NewCylinder(ScaleUniform(1), 1, -1, 1, 2*math.Pi, nil),
+			r:    NewRay(Vector{0, 5, 0.5}, Vector{0, -1, 0}),
+			want: Vector{0.25, 0.75, 0},
+		},
+		{
+			o:    NewDisk(ScaleUniform(1), 0, 2, 1, math.Pi, nil),
+			r:    NewRay(Vector{-1.5, 0, 5}, Vector{0, 0, -1}),
+			want: Vector{1, 0.5, 0},
+		},
+		{
+			o:    NewCone(ScaleUniform(1), 2, 1, 2*math.Pi, nil),
+			r:    NewRay(Vector{5, 0, 1}, Vector{-1, 0, 0}),
+			want: Vector{0, 0.5, 0},
+		},
+		{
+			o:    NewParaboloid(ScaleUniform(1), 1, 0, 1, 2*math.Pi, nil),
+			r:    NewRay(Vector{0, -5, 0.25}, Vector{0, 1, 0}),
+			want: Vector{0.75, 0.25, 0},
+		},
+		{
+			o:    NewTorus(ScaleUniform(1), 2, 0.5, 2*math.Pi, nil),
+			r:    NewRay(Vector{2, 0, 5}, Vector{0, 0, -1}),
+			want: Vector{0, 0.25, 0},
+		},
+		{
+			// uv stays in object space for shared objects
+			o:    NewSharedObject(NewCylinder(ScaleUniform(1), 1, -1, 1, 2*math.Pi, nil), Translate(Vector{0, 0, 10})),
+			r:    NewRay(Vector{0, 5, 10.5}, Vector{0, -1, 0}),
+			want: Vector{0.25, 0.75, 0},
+		},
+	} {
+		si, ok := tt.o.Intersect(tt.r)
+		if !ok {
+			t.Errorf("%d) no intersection", i)
+			continue
+		}
+		if got := ParametricUVFunc(si); !compareVectors(got, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
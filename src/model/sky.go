@@ -0,0 +1,233 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Analytic daylight: Preetham, Shirley and Smits 1999
+// "A Practical Analytic Model for Daylight"
+// The sky assumes +y is up. Radiance is in kcd/m^2 times the intensity
+// passed to NewSkyLight.
+
+const (
+	// angular radius of the sun as seen from earth in radians
+	SUN_ANGULAR_RADIUS = 0.004652
+	// luminance of the sun disk before atmospheric attenuation in kcd/m^2
+	SUN_LUMINANCE = 1.6e6
+	// resolution of the tabulated sky used for importance sampling
+	SKY_SAMPLING_WIDTH  = 128
+	SKY_SAMPLING_HEIGHT = 64
+)
+
+// SkyLight is a clear sky with a sun disk, both depending on the
+// direction of the sun and the turbidity of the atmosphere: 2 is very
+// clear, 3 a clear day and 6 or more is hazy
+type SkyLight struct {
+	sun       Vector
+	turbidity float32
+	intensity float32
+	// zenith values and perez coefficients for Y, x and y
+	zenith [3]float32
+	perez  [3][5]float32
+	// perez function at the zenith for each of Y, x and y
+	perezZenith [3]float32
+	sunColor    Color
+	// 1 - cos of the sun's angular radius, in float64 for precision
+	sunCone      float64
+	sunPDF       float32
+	distribution *distribution2D
+}
+
+// NewSkyLight returns a sky lit by the sun in direction sun (pointing
+// towards the sun) for the given turbidity, scaled by intensity
+func NewSkyLight(sun Vector, turbidity, intensity float32) *SkyLight {
+	s := &SkyLight{
+		sun:       sun.Normalize(),
+		turbidity: turbidity,
+		intensity: intensity,
+		sunCone:   2 * math.Pow(math.Sin(SUN_ANGULAR_RADIUS/2), 2),
+	}
+	t := turbidity
+	// the model is only defined for the sun above the horizon
+	thetaS := math.Acos(math.Max(0, math.Min(1, float64(s.sun.Y))))
+	thetaS = math.Min(thetaS, math.Pi/2-1e-3)
+
+	chi := (4.0/9.0 - float64(t)/120) * (math.Pi - 2*thetaS)
+	zenithY := (4.0453*float64(t)-4.9710)*math.Tan(chi) - 0.2155*float64(t) + 2.4192
+	th := [4]float64{thetaS * thetaS * thetaS, thetaS * thetaS, thetaS, 1}
+	zenithChromaticity := func(m [3][4]float64) float32 {
+		tt := [3]float64{float64(t * t), float64(t), 1}
+		var sum float64
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 4; j++ {
+				sum += tt[i] * m[i][j] * th[j]
+			}
+		}
+		return float32(sum)
+	}
+	s.zenith = [3]float32{
+		float32(zenithY),
+		zenithChromaticity([3][4]float64{
+			{0.00166, -0.00375, 0.00209, 0},
+			{-0.02903, 0.06377, -0.03202, 0.00394},
+			{0.11693, -0.21196, 0.06052, 0.25886},
+		}),
+		zenithChromaticity([3][4]float64{
+			{0.00275, -0.00610, 0.00317, 0},
+			{-0.04214, 0.08970, -0.04153, 0.00516},
+			{0.15346, -0.26756, 0.06670, 0.26688},
+		}),
+	}
+	s.perez = [3][5]float32{
+		{0.1787*t - 1.4630, -0.3554*t + 0.4275, -0.0227*t + 5.3251, 0.1206*t - 2.5771, -0.0670*t + 0.3703},
+		{-0.0193*t - 0.2592, -0.0665*t + 0.0008, -0.0004*t + 0.2125, -0.0641*t - 0.8989, -0.0033*t + 0.0452},
+		{-0.0167*t - 0.2608, -0.0950*t + 0.0092, -0.0079*t + 0.2102, -0.0441*t - 1.6537, -0.0109*t + 0.0529},
+	}
+	for i := range s.perez {
+		s.perezZenith[i] = perez(s.perez[i], 0, float32(thetaS))
+	}
+	s.sunColor = sunRadiance(float32(thetaS), t).Times(intensity)
+
+	// tabulate sky luminance for importance sampling; with an even number
+	// of rows the horizon falls between two rows
+	w, h := SKY_SAMPLING_WIDTH, SKY_SAMPLING_HEIGHT
+	weights := make([]float32, w*h)
+	for y := 0; y < h/2; y++ {
+		for x := 0; x < w; x++ {
+			d, sin := equirectangularDirection((float32(x)+0.5)/float32(w), (float32(y)+0.5)/float32(h))
+			weights[y*w+x] = s.sky(d).Luminance() * sin
+		}
+	}
+	s.distribution = newDistribution2D(weights, w, h)
+	if s.sun.Y > 0 {
+		s.sunPDF = 0.5
+	}
+	return s
+}
+
+// perez sky luminance distribution function
+func perez(c [5]float32, theta, gamma float32) float32 {
+	cosTheta := float32(math.Max(1e-3, math.Cos(float64(theta))))
+	cosGamma := float32(math.Cos(float64(gamma)))
+	a := 1 + c[0]*float32(math.Exp(float64(c[1]/cosTheta)))
+	b := 1 + c[2]*float32(math.Exp(float64(c[3]*gamma))) + c[4]*cosGamma*cosGamma
+	return a * b
+}
+
+// sky radiance in direction d excluding the sun, black below the horizon
+func (s *SkyLight) sky(d Vector) Color {
+	if d.Y <= 0 {
+		return Color{}
+	}
+	theta := float32(math.Acos(math.Min(1, float64(d.Y))))
+	gamma := float32(math.Acos(math.Max(-1, math.Min(1, float64(d.Dot(s.sun))))))
+	var v [3]float32
+	for i := range v {
+		v[i] = s.zenith[i] * perez(s.perez[i], theta, gamma) / s.perezZenith[i]
+	}
+	lum, x, y := v[0], v[1], v[2]
+	if y <= 0 {
+		return Color{}
+	}
+	// xyY to XYZ
+	c := xyzToLinearSRGB(x/y*lum, lum, (1-x-y)/y*lum)
+	return c.Times(s.intensity)
+}
+
+// sunRadiance is the radiance of the sun disk after passing through the
+// atmosphere at zenith angle thetaS: rayleigh and aerosol scattering
+// from Preetham's appendix applied to a 5778K black body
+func sunRadiance(thetaS, turbidity float32) Color {
+	degrees := float64(thetaS) * 180 / math.Pi
+	// relative optical air mass
+	m := float32(1 / (math.Cos(float64(thetaS)) + 0.15*math.Pow(93.885-degrees, -1.253)))
+	beta := 0.04608*turbidity - 0.04586
+	blackbody := NewBlackbodySpectrum(5778)
+	_, y, _ := spectrumToXYZ(blackbody)
+	scale := SUN_LUMINANCE / y
+	attenuated := spectrumFunc(func(lambda float32) float32 {
+		l := float64(lambda) / 1000
+		rayleigh := math.Exp(-0.008735 * math.Pow(l, -4.08) * float64(m))
+		aerosol := math.Exp(-float64(beta) * math.Pow(l, -1.3) * float64(m))
+		return scale * blackbody.Eval(lambda) * float32(rayleigh*aerosol)
+	})
+	return xyzToLinearSRGB(spectrumToXYZ(attenuated))
+}
+
+type spectrumFunc func(lambda float32) float32
+
+func (f spectrumFunc) Eval(lambda float32) float32 {
+	return f(lambda)
+}
+
+func (s *SkyLight) inSun(d Vector) bool {
+	return s.sun.Y > 0 && float64(1-d.Dot(s.sun)) < s.sunCone
+}
+
+// Radiance of the sky and sun disk arriving along direction d
+func (s *SkyLight) Radiance(d Vector) Color {
+	c := s.sky(d)
+	if s.inSun(d) {
+		c = c.Add(s.sunColor)
+	}
+	return c
+}
+
+// sample samples the sun disk uniformly half of the time while the sun is
+// up, and the tabulated sky by luminance otherwise
+func (s *SkyLight) sample(random *rand.Rand) (Vector, Color, float32) {
+	var d Vector
+	if random.Float32() < s.sunPDF {
+		d = uniformSampleCone(random, s.sun, 1-s.sunCone)
+	} else {
+		u, v, pdf := s.distribution.sample(random.Float32(), random.Float32())
+		if pdf == 0 {
+			return Vector{}, Color{}, 0
+		}
+		d, _ = equirectangularDirection(u, v)
+	}
+	return d, s.Radiance(d), s.pdf(d)
+}
+
+func (s *SkyLight) pdf(d Vector) float32 {
+	var pdf float32
+	if s.inSun(d) {
+		pdf += s.sunPDF / float32(2*math.Pi*s.sunCone)
+	}
+	u, v := equirectangularUV(d)
+	if sin := float32(math.Sin(math.Pi * float64(v))); sin > 0 {
+		pdf += (1 - s.sunPDF) * s.distribution.pdf(u, v) / (2 * math.Pi * math.Pi * sin)
+	}
+	return pdf
+}
+
+// Sun returns a distant light matching the sun disk, for lighting scenes
+// with the whitted style ray tracer
+func (s *SkyLight) Sun() DistantLight {
+	max := s.sunColor.MaxComponent()
+	if max == 0 || s.sun.Y <= 0 {
+		return NewDistantLight(s.sun.Times(-1), Color{}, 0)
+	}
+	// irradiance from the sun disk is its radiance times its solid angle
+	irradiance := max * float32(2*math.Pi*s.sunCone)
+	return NewDistantLight(s.sun.Times(-1), s.sunColor.Times(1/max), irradiance)
+}
+
+// SunDirection returns the direction towards the sun given latitude and
+// longitude in degrees (east positive), the standard meridian of the time
+// zone in degrees, the day of the year (1-365) and the local standard time
+// in hours. +y points up, +x south and +z east: Preetham appendix A.6
+func SunDirection(latitude, longitude, meridian float64, day int, hour float64) Vector {
+	lat := latitude * math.Pi / 180
+	j := float64(day)
+	// solar time
+	t := hour + 0.170*math.Sin(4*math.Pi*(j-80)/373) - 0.129*math.Sin(2*math.Pi*(j-8)/355) + (longitude-meridian)/15
+	declination := 0.4093 * math.Sin(2*math.Pi*(j-81)/368)
+	hourAngle := math.Pi * t / 12
+	theta := math.Pi/2 - math.Asin(math.Sin(lat)*math.Sin(declination)-math.Cos(lat)*math.Cos(declination)*math.Cos(hourAngle))
+	// azimuth from south, positive towards the west
+	phi := math.Atan2(-math.Cos(declination)*math.Sin(hourAngle), math.Cos(lat)*math.Sin(declination)-math.Sin(lat)*math.Cos(declination)*math.Cos(hourAngle))
+	sin := math.Sin(theta)
+	return Vector{float32(sin * math.Cos(phi)), float32(math.Cos(theta)), float32(-sin * math.Sin(phi))}
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSkyLightSample(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	sky := NewSkyLight(Vector{1, 1, 0}, 3, 1)
+	n := 100000
+	var sum float64
+	sunSamples, mismatches := 0, 0
+	for i := 0; i < n; i++ {
+		d, le, pdf := sky.sample(random)
+		if pdf == 0 {
+			continue
+		}
+		if d.Y < 0 {
+			t.Fatalf("sampled direction %v below the horizon", d)
+		}
+		if sky.inSun(d) {
+			sunSamples++
+		}
+		if got := sky.pdf(d); math.Abs(float64(got-pdf)) > 1e-3*float64(pdf) || sky.Radiance(d) != le {
+			mismatches++
+		}
+		sum += 1 / float64(pdf)
+	}
+	if mismatches > n/1000 {
+		t.Errorf("pdf or radiance of %d sampled directions does not match", mismatches)
+	}
+	if sunSamples < n/3 {
+		t.Errorf("only %d of %d samples hit the sun", sunSamples, n)
+	}
+	// the expected inverse pdf is the area of the upper hemisphere
+	if got := sum / float64(n); math.Abs(got-2*math.Pi) > 0.1 {
+		t.Errorf("got mean inverse pdf %f want %f", got, 2*math.Pi)
+	}
+}
+
+func TestSkyLightRadiance(t *testing.T) {
+	sky := NewSkyLight(Vector{0, 1, 1}, 3, 1)
+	zenith := sky.Radiance(Vector{0, 1, 0})
+	if zenith.Luminance() <= 0 {
+		t.Fatalf("got zenith radiance %v", zenith)
+	}
+	// the clear sky away from the sun is blue
+	if away := sky.Radiance(Vector{0, 1, -1}.Normalize()); away.b <= away.r {
+		t.Errorf("got radiance %v opposite the sun, want blue", away)
+	}
+	if below := sky.Radiance(Vector{0, -1, 0}); below != (Color{}) {
+		t.Errorf("got radiance %v below the horizon", below)
+	}
+	sun := sky.Radiance(sky.sun)
+	if sun.Luminance() < 1000*zenith.Luminance() {
+		t.Errorf("sun %v not much brighter than the sky %v", sun, zenith)
+	}
+	// a low sun is redder than a high one
+	low := NewSkyLight(Vector{0, 0.1, 1}, 3, 1).sunColor
+	high := NewSkyLight(Vector{0, 1, 0}, 3, 1).sunColor
+	if low.r/low.b <= high.r/high.b {
+		t.Errorf("low sun %v not redder than high sun %v", low, high)
+	}
+}
+
+func TestSunDirection(t *testing.T) {
+	for i, tt := range []struct {
+		latitude, hour float64
+		day            int
+		wantElevation  float64
+	}{
+		// equinox around noon on the equator: nearly overhead, off by
+		// the equation of time
+		{latitude: 0, day: 81, hour: 12, wantElevation: 90},
+		// summer solstice at solar noon at 52 degrees north
+		{latitude: 52, day: 172, hour: 12, wantElevation: 61.5},
+		// winter solstice at solar noon at 52 degrees north
+		{latitude: 52, day: 355, hour: 12, wantElevation: 14.5},
+		// midnight
+		{latitude: 52, day: 172, hour: 0, wantElevation: -14.5},
+	} {
+		d := SunDirection(tt.latitude, 0, 0, tt.day, tt.hour)
+		elevation := math.Asin(float64(d.Y)) * 180 / math.Pi
+		if math.Abs(elevation-tt.wantElevation) > 2 {
+			t.Errorf("%d) got elevation %f want %f", i, elevation, tt.wantElevation)
+		}
+	}
+	// in the northern hemisphere the sun rises in the east and stands in
+	// the south at noon
+	if d := SunDirection(52, 0, 0, 172, 8); d.Z <= 0 {
+		t.Errorf("got morning sun %v, want east", d)
+	}
+	if d := SunDirection(52, 0, 0, 172, 12); d.X <= 0 {
+		t.Errorf("got noon sun %v, want south", d)
+	}
+}
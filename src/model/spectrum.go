@@ -0,0 +1,432 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Spectral rendering: pbrt ch5 and the hero wavelength method (Wilkie 2014)
+// In spectral mode each path carries radiance for a few wavelengths instead
+// of an RGB triple. RGB colors from textures are upsampled to spectra
+// (Smits 1999) and each sample is converted back through CIE XYZ to RGB
+// before it is added to the film. RGB rendering remains the default.
+
+const (
+	LAMBDA_MIN = 360
+	LAMBDA_MAX = 830
+	// number of wavelengths carried by each path
+	SPECTRAL_SAMPLES = 4
+)
+
+// A Spectrum is a function of wavelength in nanometers
+type Spectrum interface {
+	Eval(lambda float32) float32
+}
+
+type ConstantSpectrum float32
+
+func (s ConstantSpectrum) Eval(float32) float32 {
+	return float32(s)
+}
+
+// PiecewiseLinearSpectrum interpolates measured values, such as the
+// emission of a real light source, at increasing wavelengths
+type PiecewiseLinearSpectrum struct {
+	lambdas, values []float32
+}
+
+func NewPiecewiseLinearSpectrum(lambdas, values []float32) *PiecewiseLinearSpectrum {
+	if len(lambdas) != len(values) || len(lambdas) == 0 {
+		panic("invalid measured spectrum")
+	}
+	return &PiecewiseLinearSpectrum{lambdas: lambdas, values: values}
+}
+
+func (s *PiecewiseLinearSpectrum) Eval(lambda float32) float32 {
+	n := len(s.lambdas)
+	if lambda <= s.lambdas[0] {
+		return s.values[0]
+	}
+	if lambda >= s.lambdas[n-1] {
+		return s.values[n-1]
+	}
+	i := 1
+	for s.lambdas[i] < lambda {
+		i++
+	}
+	t := (lambda - s.lambdas[i-1]) / (s.lambdas[i] - s.lambdas[i-1])
+	return (1-t)*s.values[i-1] + t*s.values[i]
+}
+
+// BlackbodySpectrum is the emission of a black body at temperature T in
+// kelvin, normalized to 1 at its peak: pbrt 717
+type BlackbodySpectrum struct {
+	T          float32
+	normalizer float64
+}
+
+func NewBlackbodySpectrum(t float32) BlackbodySpectrum {
+	// wien's displacement law
+	peak := 2.8977721e-3 / float64(t)
+	return BlackbodySpectrum{
+		T:          t,
+		normalizer: 1 / planck(peak, float64(t)),
+	}
+}
+
+func (s BlackbodySpectrum) Eval(lambda float32) float32 {
+	return float32(planck(float64(lambda)*1e-9, float64(s.T)) * s.normalizer)
+}
+
+// planck's law for wavelength l in meters
+func planck(l, t float64) float64 {
+	const c = 299792458
+	const h = 6.62606957e-34
+	const kb = 1.3806488e-23
+	return (2 * h * c * c) / (math.Pow(l, 5) * (math.Exp((h*c)/(l*kb*t)) - 1))
+}
+
+// CauchyIOR models the index of refraction of glass as A + B / lambda^2
+// with lambda in micrometers
+type CauchyIOR struct {
+	A, B float32
+}
+
+func (s CauchyIOR) Eval(lambda float32) float32 {
+	l := lambda / 1000
+	return s.A + s.B/(l*l)
+}
+
+// SellmeierIOR models the index of refraction of glass using the
+// Sellmeier equation with lambda in micrometers
+type SellmeierIOR struct {
+	B, C [3]float32
+}
+
+// BK7 is a common borosilicate crown glass
+var BK7 = SellmeierIOR{
+	B: [3]float32{1.03961212, 0.231792344, 1.01046945},
+	C: [3]float32{6.00069867e-3, 2.00179144e-2, 1.03560653e2},
+}
+
+func (s SellmeierIOR) Eval(lambda float32) float32 {
+	l2 := lambda * lambda / 1e6
+	n2 := float32(1)
+	for i := 0; i < 3; i++ {
+		n2 += s.B[i] * l2 / (l2 - s.C[i])
+	}
+	return float32(math.Sqrt(float64(n2)))
+}
+
+// wavelengths carried by a path, each with the same pdf
+type wavelengths [SPECTRAL_SAMPLES]float32
+
+// sampleWavelengths picks a uniformly random hero wavelength; the others
+// are spread evenly over the visible range from there
+func sampleWavelengths(random *rand.Rand) wavelengths {
+	var wl wavelengths
+	hero := random.Float32()
+	for i := range wl {
+		u := hero + float32(i)/SPECTRAL_SAMPLES
+		if u >= 1 {
+			u -= 1
+		}
+		wl[i] = LAMBDA_MIN + u*(LAMBDA_MAX-LAMBDA_MIN)
+	}
+	return wl
+}
+
+// a spectrum evaluated at the wavelengths carried by a path
+type sampledSpectrum [SPECTRAL_SAMPLES]float32
+
+func sampleSpectrum(s Spectrum, wl wavelengths) sampledSpectrum {
+	var out sampledSpectrum
+	for i, l := range wl {
+		out[i] = s.Eval(l)
+	}
+	return out
+}
+
+func (s sampledSpectrum) product(t sampledSpectrum) sampledSpectrum {
+	for i := range s {
+		s[i] *= t[i]
+	}
+	return s
+}
+
+func (s sampledSpectrum) add(t sampledSpectrum) sampledSpectrum {
+	for i := range s {
+		s[i] += t[i]
+	}
+	return s
+}
+
+func (s sampledSpectrum) times(f float32) sampledSpectrum {
+	for i := range s {
+		s[i] *= f
+	}
+	return s
+}
+
+func (s sampledSpectrum) maxComponent() float32 {
+	max := s[0]
+	for _, v := range s[1:] {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// toRGB converts radiance at the sampled wavelengths to an RGB estimate
+func (s sampledSpectrum) toRGB(wl wavelengths) Color {
+	var x, y, z float32
+	for i, l := range wl {
+		cx, cy, cz := cieXYZ(l)
+		x += s[i] * cx
+		y += s[i] * cy
+		z += s[i] * cz
+	}
+	// divide by the uniform pdf and the number of samples
+	var scale float32 = (LAMBDA_MAX - LAMBDA_MIN) / (SPECTRAL_SAMPLES * CIE_Y_INTEGRAL)
+	return xyzToRGB(x*scale, y*scale, z*scale)
+}
+
+// integral of the y color matching function over the visible range
+const CIE_Y_INTEGRAL = 106.856895
+
+// CIE 1931 color matching functions using the multi-lobe gaussian fit
+// by Wyman, Sloan and Shirley 2013
+func cieXYZ(lambda float32) (float32, float32, float32) {
+	g := func(mu, sigma1, sigma2 float32) float32 {
+		sigma := sigma1
+		if lambda >= mu {
+			sigma = sigma2
+		}
+		t := (lambda - mu) / sigma
+		return float32(math.Exp(float64(-t * t / 2)))
+	}
+	x := 1.056*g(599.8, 37.9, 31.0) + 0.362*g(442.0, 16.0, 26.7) - 0.065*g(501.1, 20.4, 26.2)
+	y := 0.821*g(568.8, 46.9, 40.5) + 0.286*g(530.9, 16.3, 31.1)
+	z := 1.217*g(437.0, 11.8, 36.0) + 0.681*g(459.0, 26.0, 13.8)
+	return x, y, z
+}
+
+// rgb of a constant spectrum of 1, used to white balance to equal energy
+// so that upsampled white surfaces under upsampled white lights stay white
+var spectralWhite = func() Color {
+	var x, y, z float32
+	for l := float32(LAMBDA_MIN); l <= LAMBDA_MAX; l++ {
+		cx, cy, cz := cieXYZ(l)
+		x, y, z = x+cx, y+cy, z+cz
+	}
+	return xyzToLinearSRGB(x/CIE_Y_INTEGRAL, y/CIE_Y_INTEGRAL, z/CIE_Y_INTEGRAL)
+}()
+
+func xyzToLinearSRGB(x, y, z float32) Color {
+	return Color{
+		r: 3.2404542*x - 1.5371385*y - 0.4985314*z,
+		g: -0.9692660*x + 1.8760108*y + 0.0415560*z,
+		b: 0.0556434*x - 0.2040259*y + 1.0572252*z,
+	}
+}
+
+func xyzToRGB(x, y, z float32) Color {
+	c := xyzToLinearSRGB(x, y, z)
+	return Color{
+		r: c.r / spectralWhite.r,
+		g: c.g / spectralWhite.g,
+		b: c.b / spectralWhite.b,
+	}
+}
+
+// SpectrumToRGB integrates s against the color matching functions
+func SpectrumToRGB(s Spectrum) Color {
+	return xyzToRGB(spectrumToXYZ(s))
+}
+
+func spectrumToXYZ(s Spectrum) (float32, float32, float32) {
+	var x, y, z float32
+	for l := float32(LAMBDA_MIN); l <= LAMBDA_MAX; l++ {
+		v := s.Eval(l)
+		cx, cy, cz := cieXYZ(l)
+		x, y, z = x+v*cx, y+v*cy, z+v*cz
+	}
+	return x / CIE_Y_INTEGRAL, y / CIE_Y_INTEGRAL, z / CIE_Y_INTEGRAL
+}
+
+// basis spectra for RGB to spectrum conversion: Smits 1999
+// ten equal bins from 380 to 720 nm
+var (
+	smitsWhite   = [10]float32{1, 1, 0.9999, 0.9993, 0.9992, 0.9998, 1, 1, 1, 1}
+	smitsCyan    = [10]float32{0.9710, 0.9426, 1.0007, 1.0007, 1.0007, 1.0007, 0.1564, 0, 0, 0}
+	smitsMagenta = [10]float32{1, 1, 0.9685, 0.2229, 0, 0.0458, 0.8369, 1, 1, 0.9959}
+	smitsYellow  = [10]float32{0.0001, 0, 0.1088, 0.6651, 1, 1, 0.9996, 0.9586, 0.9685, 0.9840}
+	smitsRed     = [10]float32{0.1012, 0.0515, 0, 0, 0, 0, 0.8325, 1.0149, 1.0149, 1.0149}
+	smitsGreen   = [10]float32{0, 0, 0.0273, 0.7937, 1, 0.9418, 0.1719, 0, 0, 0.0025}
+	smitsBlue    = [10]float32{1, 1, 0.8916, 0.3323, 0, 0, 0.0003, 0.0369, 0.0483, 0.0496}
+)
+
+// RGBSpectrum is an RGB color upsampled to a smooth spectrum
+type RGBSpectrum struct {
+	white, first, second    float32
+	firstBasis, secondBasis *[10]float32
+}
+
+func NewRGBSpectrum(c Color) RGBSpectrum {
+	r, g, b := c.r, c.g, c.b
+	switch {
+	case r <= g && r <= b:
+		if g <= b {
+			return RGBSpectrum{r, g - r, b - g, &smitsCyan, &smitsBlue}
+		}
+		return RGBSpectrum{r, b - r, g - b, &smitsCyan, &smitsGreen}
+	case g <= r && g <= b:
+		if r <= b {
+			return RGBSpectrum{g, r - g, b - r, &smitsMagenta, &smitsBlue}
+		}
+		return RGBSpectrum{g, b - g, r - b, &smitsMagenta, &smitsRed}
+	}
+	if r <= g {
+		return RGBSpectrum{b, r - b, g - r, &smitsYellow, &smitsGreen}
+	}
+	return RGBSpectrum{b, g - b, r - g, &smitsYellow, &smitsRed}
+}
+
+func (s RGBSpectrum) Eval(lambda float32) float32 {
+	bin := int((lambda - 380) / 34)
+	if bin < 0 {
+		bin = 0
+	}
+	if bin > 9 {
+		bin = 9
+	}
+	return s.white*smitsWhite[bin] + s.first*s.firstBasis[bin] + s.second*s.secondBasis[bin]
+}
+
+type spectralPathTracer struct {
+	tracer
+}
+
+// NewSpectralPathTracer is a path tracer with next event estimation that
+// traces radiance at SPECTRAL_SAMPLES wavelengths per path
+func NewSpectralPathTracer(maxDepth int) Tracer {
+	return &spectralPathTracer{newTracer(maxDepth)}
+}
+
+// emission of a light in direction wo at the sampled wavelengths
+func emittedSpectrum(si *SurfaceInteraction, wo Vector, wl wavelengths) sampledSpectrum {
+	le := emittedRadiance(si, wo)
+	if le.MaxComponent() == 0 {
+		return sampledSpectrum{}
+	}
+	if mat, ok := si.object.GetMaterial().(*RadiantMaterial); ok && mat.Emission != nil {
+		return sampleSpectrum(mat.Emission, wl)
+	}
+	return sampleSpectrum(NewRGBSpectrum(le), wl)
+}
+
+// radiance li arriving from a sampled light at the sampled wavelengths;
+// area lights with a spectral material emit their spectrum unattenuated
+func lightSpectrum(light Light, li Color, wl wavelengths) sampledSpectrum {
+	if area, ok := light.(*AreaLight); ok {
+		if mat, ok := area.shape.GetMaterial().(*RadiantMaterial); ok && mat.Emission != nil {
+			return sampleSpectrum(mat.Emission, wl)
+		}
+	}
+	return sampleSpectrum(NewRGBSpectrum(li), wl)
+}
+
+func (pt *spectralPathTracer) GetRayColor(ray Ray, scene *Scene, depth int) Color {
+	wl := sampleWavelengths(pt.random)
+	var radiance sampledSpectrum
+	throughput := sampledSpectrum{1, 1, 1, 1}
+	// only the hero wavelength survives wavelength dependent refraction
+	terminated := false
+	// emitters hit directly or through specular bounces are not found by
+	// light sampling, so they count
+	countEmitted := true
+	for bounce := depth; bounce < pt.maxDepth; bounce++ {
+		si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+		if !ok {
+			if scene.Environment != nil && countEmitted {
+				le := sampleSpectrum(NewRGBSpectrum(scene.Environment.Radiance(ray.Direction)), wl)
+				radiance = radiance.add(throughput.product(le))
+			}
+			break
+		}
+
+		si.as = scene.AccelerationStructure
+		si.depth = bounce
+		si.tracer = pt
+		si.applyShadingNormal()
+
+		if si.object.IsLight() {
+			if countEmitted {
+				radiance = radiance.add(throughput.product(emittedSpectrum(si, ray.Direction.Times(-1), wl)))
+			}
+			break
+		}
+		switch mat := si.object.GetMaterial().(type) {
+		case *ReflectiveMaterial:
+			n := si.normal
+			if n.Dot(ray.Direction) > 0 {
+				n = n.Times(-1)
+			}
+			throughput = throughput.product(sampleSpectrum(NewRGBSpectrum(mat.GetColor(si)), wl))
+			ray = NewRay(si.Point, mirrorDirection(ray.Direction, n).Normalize())
+			countEmitted = true
+			continue
+		case *DielectricMaterial:
+			ior := mat.IOR
+			if mat.Dispersion != nil {
+				if !terminated {
+					for i := 1; i < SPECTRAL_SAMPLES; i++ {
+						throughput[i] = 0
+					}
+					throughput[0] *= SPECTRAL_SAMPLES
+					terminated = true
+				}
+				ior = mat.Dispersion.Eval(wl[0])
+			}
+			direction, refracted := scatterDielectric(pt.random, si.normal, ray.Direction, ior)
+			if refracted {
+				throughput = throughput.product(sampleSpectrum(NewRGBSpectrum(mat.GetColor(si)), wl))
+			}
+			ray = NewRay(si.Point, direction)
+			countEmitted = true
+			continue
+		}
+
+		albedo := sampleSpectrum(NewRGBSpectrum(si.object.GetColor(si)), wl)
+		brdf := albedo.times(INVPI)
+
+		// direct light sampling
+		if light, li, wi, lightPDF, ok := sampleDirectLight(pt.random, scene, si); ok {
+			cos := si.normal.Dot(wi)
+			direct := lightSpectrum(light, li, wl).product(brdf).times(cos / lightPDF)
+			radiance = radiance.add(throughput.product(direct))
+		}
+
+		direction := si.object.SampleDirection(pt.random, si.normal)
+		pdf := si.object.GetMaterial().PDF(si.normal, direction)
+		if pdf == 0 {
+			break
+		}
+		cos := si.normal.Dot(direction)
+		throughput = throughput.product(brdf.times(cos / pdf))
+		if bounce >= RUSSIAN_ROULETTE_DEPTH {
+			q := 1 - throughput.maxComponent()
+			if q < 0.05 {
+				q = 0.05
+			}
+			if pt.random.Float32() < q {
+				break
+			}
+			throughput = throughput.times(1 / (1 - q))
+		}
+		ray = NewRay(si.Point, direction)
+		countEmitted = false
+	}
+	return radiance.toRGB(wl)
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestRGBSpectrumRoundTrip(t *testing.T) {
+	for i, c := range []Color{
+		NewColor(255, 255, 255),
+		NewColor(255, 0, 0),
+		NewColor(0, 255, 0),
+		NewColor(0, 0, 255),
+		NewColor(30, 60, 200),
+		NewColor(200, 150, 100),
+	} {
+		got := SpectrumToRGB(NewRGBSpectrum(c))
+		for _, d := range []float32{got.r - c.r, got.g - c.g, got.b - c.b} {
+			if math.Abs(float64(d)) > 0.02 {
+				t.Errorf("%d) got %v want %v", i, got, c)
+				break
+			}
+		}
+	}
+}
+
+func TestSpectrumEval(t *testing.T) {
+	for i, tt := range []struct {
+		s      Spectrum
+		lambda float32
+		want   float32
+	}{
+		{s: ConstantSpectrum(0.5), lambda: 500, want: 0.5},
+		{s: NewPiecewiseLinearSpectrum([]float32{400, 500, 600}, []float32{0, 1, 3}), lambda: 450, want: 0.5},
+		{s: NewPiecewiseLinearSpectrum([]float32{400, 500, 600}, []float32{0, 1, 3}), lambda: 550, want: 2},
+		{s: NewPiecewiseLinearSpectrum([]float32{400, 500, 600}, []float32{0, 1, 3}), lambda: 700, want: 3},
+		// peak of a 5000K black body is at 579.5nm
+		{s: NewBlackbodySpectrum(5000), lambda: 579.55, want: 1},
+		{s: BK7, lambda: 587.6, want: 1.5168},
+		{s: CauchyIOR{A: 1.5, B: 0.01}, lambda: 500, want: 1.54},
+	} {
+		if got := tt.s.Eval(tt.lambda); math.Abs(float64(got-tt.want)) > 1e-4 {
+			t.Errorf("%d) got %f want %f", i, got, tt.want)
+		}
+	}
+}
+
+func TestSampleWavelengths(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	for i := 0; i < 100; i++ {
+		wl := sampleWavelengths(random)
+		for j, l := range wl {
+			if l < LAMBDA_MIN || l >= LAMBDA_MAX {
+				t.Fatalf("%d) wavelength %f out of range", i, l)
+			}
+			// wavelengths are evenly spaced, wrapping around the range
+			d := float64(l - wl[0])
+			if d < 0 {
+				d += LAMBDA_MAX - LAMBDA_MIN
+			}
+			want := float64(j) * (LAMBDA_MAX - LAMBDA_MIN) / SPECTRAL_SAMPLES
+			if math.Abs(d-want) > 1e-3 {
+				t.Fatalf("%d) wavelength %d at offset %f want %f", i, j, d, want)
+			}
+		}
+	}
+}
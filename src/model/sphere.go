@@ -1,6 +1,9 @@
 package model
 
-import "math"
+import (
+	"math"
+	"math/rand"
+)
 
 type Sphere struct {
 	object
@@ -43,8 +46,13 @@ func (s Sphere) Intersect(r Ray) (*SurfaceInteraction, bool) {
 		return nil, false
 	}
 
-	// only return closest intersection point
-	d := -loc - float32(math.Sqrt(float64(det)))
+	// only return closest intersection point in front of the ray
+	// which is the far one if the ray starts inside the sphere
+	sqrtDet := float32(math.Sqrt(float64(det)))
+	d := -loc - sqrtDet
+	if d <= ERROR_MARGIN {
+		d = -loc + sqrtDet
+	}
 	if d <= 0 {
 		return nil, false
 	}
@@ -52,6 +60,30 @@ func (s Sphere) Intersect(r Ray) (*SurfaceInteraction, bool) {
 	return NewSurfaceInteraction(s, d, n, r), true
 }
 
+func (s Sphere) Intervals(r Ray) []Interval {
+	oc := VectorFromTo(s.Center, r.Origin)
+	loc := r.Direction.Dot(oc)
+	det := loc*loc - oc.Dot(oc) + s.Radius*s.Radius
+	if det <= 0 {
+		return nil
+	}
+	sqrtDet := float32(math.Sqrt(float64(det)))
+	d0, d1 := -loc-sqrtDet, -loc+sqrtDet
+	return []Interval{{
+		In:  NewSurfaceInteraction(s, d0, s.SurfaceNormal(PointFromRay(r, d0)), r),
+		Out: NewSurfaceInteraction(s, d1, s.SurfaceNormal(PointFromRay(r, d1)), r),
+	}}
+}
+
 func (s Sphere) SurfaceNormal(p Vector) Vector {
 	return VectorFromTo(s.Center, p).Normalize()
 }
+
+// uniform sampling over the sphere's surface: pbrt 776
+func (s Sphere) Sample(random *rand.Rand) Vector {
+	return s.Center.Add(uniformSampleSphere(random).Times(s.Radius))
+}
+
+func (s Sphere) SurfaceArea() float32 {
+	return 4 * math.Pi * s.Radius * s.Radius
+}
@@ -45,6 +45,19 @@ func TestSphereIntersect(t *testing.T) {
 			want:      11.210655149486414,
 			wantTruth: true,
 		},
+		{
+			// ray starting inside the sphere hits its far side
+			s: Sphere{
+				Center: Vector{0, 0, 0},
+				Radius: 2.0,
+			},
+			r: Ray{
+				Origin:    Vector{0, 0, 0},
+				Direction: Vector{0, 1, 0},
+			},
+			want:      2.0,
+			wantTruth: true,
+		},
 	} {
 		got, found := tt.s.Intersect(tt.r)
 		if !found && tt.wantTruth == false {
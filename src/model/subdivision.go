@@ -0,0 +1,496 @@
+package model
+
+import (
+	"math"
+	"sort"
+)
+
+// QuadFace is a face of four vertices in counter-clockwise order, as read
+// from quad meshes for Catmull-Clark subdivision
+type QuadFace struct {
+	V0, V1, V2, V3 int64
+}
+
+// An Edge between two vertices of a mesh, for instance to mark creases
+type Edge struct {
+	V0, V1 int64
+}
+
+// LoopSubdivision refines a triangle mesh levels times using Loop's scheme
+// and returns it as a TriangleMesh with its vertices on the limit surface:
+// pbrt 3.8. Edges in creases stay sharp like the boundary of the mesh.
+// UVs, if given per vertex, are interpolated linearly. The limit surface
+// normals are stored in Normals; use InterpolatedNormalMappingMaterial to
+// shade with them
+func LoopSubdivision(vertices []Vector, faces []Face, uvs []Vector, creases []Edge, levels int, mat Material) Object {
+	polygons := make([][]int, len(faces))
+	for i, f := range faces {
+		polygons[i] = []int{int(f.V0), int(f.V1), int(f.V2)}
+	}
+	s := newSubdivisionMesh(vertices, polygons, uvs, creases)
+	for i := 0; i < levels; i++ {
+		s = s.loop()
+	}
+	return s.limit(loopLimit).triangleMesh(mat)
+}
+
+// CatmullClarkSubdivision refines a quad mesh levels times using the scheme
+// of Catmull and Clark and returns it as a TriangleMesh with its vertices on
+// the limit surface, splitting every quad in two triangles. Creases, UVs
+// and normals are handled as in LoopSubdivision
+func CatmullClarkSubdivision(vertices []Vector, faces []QuadFace, uvs []Vector, creases []Edge, levels int, mat Material) Object {
+	polygons := make([][]int, len(faces))
+	for i, f := range faces {
+		polygons[i] = []int{int(f.V0), int(f.V1), int(f.V2), int(f.V3)}
+	}
+	s := newSubdivisionMesh(vertices, polygons, uvs, creases)
+	for i := 0; i < levels; i++ {
+		s = s.catmullClark()
+	}
+	return s.limit(catmullClarkLimit).triangleMesh(mat)
+}
+
+type edgeKey struct {
+	a, b int
+}
+
+func newEdgeKey(a, b int) edgeKey {
+	if a > b {
+		a, b = b, a
+	}
+	return edgeKey{a, b}
+}
+
+// subdivisionMesh is a polygon mesh with the adjacency that subdivision
+// rules need
+type subdivisionMesh struct {
+	vertices []Vector
+	normals  []Vector
+	uvs      []Vector
+	faces    [][]int
+	creases  map[edgeKey]bool
+	// faces next to every edge
+	edgeFaces map[edgeKey][]int
+	// faces around every vertex
+	vertexFaces [][]int
+	// vertices connected to every vertex by an edge
+	neighbours [][]int
+}
+
+func newSubdivisionMesh(vertices []Vector, faces [][]int, uvs []Vector, creases []Edge) *subdivisionMesh {
+	if len(uvs) > 0 && len(uvs) != len(vertices) {
+		panic("uvs do not match vertices")
+	}
+	c := map[edgeKey]bool{}
+	for _, e := range creases {
+		c[newEdgeKey(int(e.V0), int(e.V1))] = true
+	}
+	return newSubdivisionLevel(vertices, faces, uvs, c)
+}
+
+func newSubdivisionLevel(vertices []Vector, faces [][]int, uvs []Vector, creases map[edgeKey]bool) *subdivisionMesh {
+	s := &subdivisionMesh{
+		vertices:    vertices,
+		uvs:         uvs,
+		faces:       faces,
+		creases:     creases,
+		edgeFaces:   map[edgeKey][]int{},
+		vertexFaces: make([][]int, len(vertices)),
+		neighbours:  make([][]int, len(vertices)),
+	}
+	for i, f := range faces {
+		for k, v := range f {
+			s.vertexFaces[v] = append(s.vertexFaces[v], i)
+			e := newEdgeKey(v, f[(k+1)%len(f)])
+			if len(s.edgeFaces[e]) == 0 {
+				s.neighbours[e.a] = append(s.neighbours[e.a], e.b)
+				s.neighbours[e.b] = append(s.neighbours[e.b], e.a)
+			}
+			s.edgeFaces[e] = append(s.edgeFaces[e], i)
+		}
+	}
+	return s
+}
+
+// sharp edges are creases and edges on the boundary of the mesh
+func (s *subdivisionMesh) sharp(e edgeKey) bool {
+	return s.creases[e] || len(s.edgeFaces[e]) != 2
+}
+
+// sharpNeighbours returns the vertices connected to v by sharp edges
+func (s *subdivisionMesh) sharpNeighbours(v int) []int {
+	var sharp []int
+	for _, n := range s.neighbours[v] {
+		if s.sharp(newEdgeKey(v, n)) {
+			sharp = append(sharp, n)
+		}
+	}
+	return sharp
+}
+
+// edges returns all edges in a fixed order
+func (s *subdivisionMesh) edges() []edgeKey {
+	edges := make([]edgeKey, 0, len(s.edgeFaces))
+	for e := range s.edgeFaces {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].a != edges[j].a {
+			return edges[i].a < edges[j].a
+		}
+		return edges[i].b < edges[j].b
+	})
+	return edges
+}
+
+// next and previous vertex of v in face f
+func (s *subdivisionMesh) around(f, v int) (int, int) {
+	face := s.faces[f]
+	for k, w := range face {
+		if w == v {
+			return face[(k+1)%len(face)], face[(k+len(face)-1)%len(face)]
+		}
+	}
+	panic("vertex not in face")
+}
+
+// ring returns the faces around an interior vertex v in order, each
+// sharing the edge to its next vertex with the face after it
+func (s *subdivisionMesh) ring(v int) []int {
+	faces := s.vertexFaces[v]
+	ring := []int{faces[0]}
+	for len(ring) < len(faces) {
+		next, _ := s.around(ring[len(ring)-1], v)
+		found := false
+		for _, f := range faces {
+			if _, prev := s.around(f, v); prev == next {
+				ring = append(ring, f)
+				found = true
+				break
+			}
+		}
+		if !found {
+			// inconsistently oriented faces
+			return nil
+		}
+	}
+	return ring
+}
+
+// childMesh collects the vertices of the next level
+type childMesh struct {
+	vertices []Vector
+	uvs      []Vector
+}
+
+func (c *childMesh) add(p, uv Vector) int {
+	c.vertices = append(c.vertices, p)
+	c.uvs = append(c.uvs, uv)
+	return len(c.vertices) - 1
+}
+
+func (s *subdivisionMesh) uv(v int) Vector {
+	if s.uvs == nil {
+		return Vector{}
+	}
+	return s.uvs[v]
+}
+
+// vertexRule moves an existing vertex given the smooth rule for it.
+// Vertices on two sharp edges follow the cubic B-spline along them,
+// corners of more sharp edges stay put, as do vertices of no face
+func (s *subdivisionMesh) vertexRule(v int, smooth func(v int) Vector) Vector {
+	if len(s.vertexFaces[v]) == 0 {
+		return s.vertices[v]
+	}
+	sharp := s.sharpNeighbours(v)
+	switch len(sharp) {
+	case 0, 1:
+		return smooth(v)
+	case 2:
+		p := s.vertices[v].Times(0.75)
+		return p.Add(s.vertices[sharp[0]].Add(s.vertices[sharp[1]]).Times(0.125))
+	}
+	return s.vertices[v]
+}
+
+// childCreases splits every crease in two
+func (s *subdivisionMesh) childCreases(edgePoints map[edgeKey]int) map[edgeKey]bool {
+	creases := map[edgeKey]bool{}
+	for e := range s.creases {
+		if m, ok := edgePoints[e]; ok {
+			creases[newEdgeKey(e.a, m)] = true
+			creases[newEdgeKey(m, e.b)] = true
+		}
+	}
+	return creases
+}
+
+func (s *subdivisionMesh) finish(c *childMesh, faces [][]int, edgePoints map[edgeKey]int) *subdivisionMesh {
+	uvs := c.uvs
+	if s.uvs == nil {
+		uvs = nil
+	}
+	return newSubdivisionLevel(c.vertices, faces, uvs, s.childCreases(edgePoints))
+}
+
+func loopBeta(n int) float32 {
+	if n == 3 {
+		return 3.0 / 16
+	}
+	return 3 / (8 * float32(n))
+}
+
+// loop splits every triangle in four
+func (s *subdivisionMesh) loop() *subdivisionMesh {
+	c := &childMesh{}
+	// existing vertices keep their index
+	for v := range s.vertices {
+		p := s.vertexRule(v, func(v int) Vector {
+			n := len(s.neighbours[v])
+			beta := loopBeta(n)
+			p := s.vertices[v].Times(1 - float32(n)*beta)
+			for _, w := range s.neighbours[v] {
+				p = p.Add(s.vertices[w].Times(beta))
+			}
+			return p
+		})
+		c.add(p, s.uv(v))
+	}
+	edgePoints := map[edgeKey]int{}
+	for _, e := range s.edges() {
+		a, b := s.vertices[e.a], s.vertices[e.b]
+		p := a.Add(b).Times(0.5)
+		if !s.sharp(e) {
+			p = a.Add(b).Times(0.375)
+			for _, f := range s.edgeFaces[e] {
+				p = p.Add(s.vertices[s.opposite(f, e)].Times(0.125))
+			}
+		}
+		edgePoints[e] = c.add(p, s.uv(e.a).Add(s.uv(e.b)).Times(0.5))
+	}
+	faces := make([][]int, 0, 4*len(s.faces))
+	for _, f := range s.faces {
+		a, b, d := f[0], f[1], f[2]
+		ab, bd, da := edgePoints[newEdgeKey(a, b)], edgePoints[newEdgeKey(b, d)], edgePoints[newEdgeKey(d, a)]
+		faces = append(faces, []int{a, ab, da}, []int{ab, b, bd}, []int{da, bd, d}, []int{ab, bd, da})
+	}
+	return s.finish(c, faces, edgePoints)
+}
+
+// opposite returns the vertex of triangle f not on edge e
+func (s *subdivisionMesh) opposite(f int, e edgeKey) int {
+	for _, v := range s.faces[f] {
+		if v != e.a && v != e.b {
+			return v
+		}
+	}
+	panic("degenerate triangle")
+}
+
+func (s *subdivisionMesh) centroid(f int) (Vector, Vector) {
+	var p, uv Vector
+	for _, v := range s.faces[f] {
+		p = p.Add(s.vertices[v])
+		uv = uv.Add(s.uv(v))
+	}
+	n := 1 / float32(len(s.faces[f]))
+	return p.Times(n), uv.Times(n)
+}
+
+// catmullClark splits every polygon in quads around its centroid
+func (s *subdivisionMesh) catmullClark() *subdivisionMesh {
+	c := &childMesh{}
+	facePoints := make([]Vector, len(s.faces))
+	for f := range s.faces {
+		facePoints[f], _ = s.centroid(f)
+	}
+	for v := range s.vertices {
+		p := s.vertexRule(v, func(v int) Vector {
+			// (Q + 2R + (n-3)S) / n with Q the average face point and R
+			// the average edge midpoint
+			var q, r Vector
+			for _, f := range s.vertexFaces[v] {
+				q = q.Add(facePoints[f])
+			}
+			q = q.Times(1 / float32(len(s.vertexFaces[v])))
+			for _, w := range s.neighbours[v] {
+				r = r.Add(s.vertices[v].Add(s.vertices[w]).Times(0.5))
+			}
+			n := float32(len(s.neighbours[v]))
+			r = r.Times(1 / n)
+			return q.Add(r.Times(2)).Add(s.vertices[v].Times(n - 3)).Times(1 / n)
+		})
+		c.add(p, s.uv(v))
+	}
+	faceIndices := make([]int, len(s.faces))
+	for f := range s.faces {
+		p, uv := s.centroid(f)
+		faceIndices[f] = c.add(p, uv)
+	}
+	edgePoints := map[edgeKey]int{}
+	for _, e := range s.edges() {
+		p := s.vertices[e.a].Add(s.vertices[e.b]).Times(0.5)
+		if !s.sharp(e) {
+			fs := s.edgeFaces[e]
+			p = s.vertices[e.a].Add(s.vertices[e.b]).Add(facePoints[fs[0]]).Add(facePoints[fs[1]]).Times(0.25)
+		}
+		edgePoints[e] = c.add(p, s.uv(e.a).Add(s.uv(e.b)).Times(0.5))
+	}
+	var faces [][]int
+	for f, face := range s.faces {
+		for k, v := range face {
+			next := edgePoints[newEdgeKey(v, face[(k+1)%len(face)])]
+			prev := edgePoints[newEdgeKey(v, face[(k+len(face)-1)%len(face)])]
+			faces = append(faces, []int{v, next, faceIndices[f], prev})
+		}
+	}
+	return s.finish(c, faces, edgePoints)
+}
+
+// a limitRule returns the limit position and, if it can, the limit normal
+// of a smooth vertex
+type limitRule func(s *subdivisionMesh, v int) (Vector, Vector, bool)
+
+// limit moves all vertices to the limit surface and sets their normals.
+// Sharp vertices get the average normal of their faces instead, and
+// vertices of no face, as often found in OBJ files, keep their position
+func (s *subdivisionMesh) limit(smooth limitRule) *subdivisionMesh {
+	vertices := make([]Vector, len(s.vertices))
+	normals := make([]Vector, len(s.vertices))
+	for v := range s.vertices {
+		if len(s.vertexFaces[v]) == 0 {
+			vertices[v] = s.vertices[v]
+			continue
+		}
+		sharp := s.sharpNeighbours(v)
+		var p, n Vector
+		ok := false
+		switch len(sharp) {
+		case 0, 1:
+			p, n, ok = smooth(s, v)
+		case 2:
+			// the limit of the cubic B-spline along the crease
+			p = s.vertices[v].Times(4).Add(s.vertices[sharp[0]]).Add(s.vertices[sharp[1]]).Times(1.0 / 6)
+		default:
+			p = s.vertices[v]
+		}
+		faceNormal := s.faceNormal(v)
+		if !ok {
+			n = faceNormal
+		}
+		// tangents follow the ring of neighbours, which can go either way
+		if n.Dot(faceNormal) < 0 {
+			n = n.Times(-1)
+		}
+		vertices[v] = p
+		normals[v] = n.Normalize()
+	}
+	return &subdivisionMesh{
+		vertices: vertices,
+		normals:  normals,
+		uvs:      s.uvs,
+		faces:    s.faces,
+	}
+}
+
+// faceNormal is the area weighted normal of the faces around v
+func (s *subdivisionMesh) faceNormal(v int) Vector {
+	var n Vector
+	for _, f := range s.vertexFaces[v] {
+		next, prev := s.around(f, v)
+		n = n.Add(VectorFromTo(s.vertices[v], s.vertices[next]).Cross(VectorFromTo(s.vertices[v], s.vertices[prev])))
+	}
+	return n.Normalize()
+}
+
+// Loop's limit position and tangents of smooth vertices: pbrt 3.8.2
+func loopLimit(s *subdivisionMesh, v int) (Vector, Vector, bool) {
+	n := len(s.neighbours[v])
+	gamma := 1 / (float32(n) + 3/(8*loopBeta(n)))
+	p := s.vertices[v].Times(1 - float32(n)*gamma)
+	for _, w := range s.neighbours[v] {
+		p = p.Add(s.vertices[w].Times(gamma))
+	}
+	ring := s.ring(v)
+	if ring == nil {
+		return p, Vector{}, false
+	}
+	var t1, t2 Vector
+	for i, f := range ring {
+		next, _ := s.around(f, v)
+		theta := 2 * math.Pi * float64(i) / float64(n)
+		t1 = t1.Add(s.vertices[next].Times(float32(math.Cos(theta))))
+		t2 = t2.Add(s.vertices[next].Times(float32(math.Sin(theta))))
+	}
+	return p, t1.Cross(t2), true
+}
+
+// the limit position and tangents of smooth vertices on a quad mesh:
+// Halstead, Kass and DeRose, Efficient, fair interpolation using
+// Catmull-Clark surfaces, 1993
+func catmullClarkLimit(s *subdivisionMesh, v int) (Vector, Vector, bool) {
+	ring := s.ring(v)
+	// only quads around the vertex, as after a first subdivision
+	for _, f := range ring {
+		if len(s.faces[f]) != 4 {
+			ring = nil
+			break
+		}
+	}
+	if ring == nil {
+		return s.vertices[v], Vector{}, false
+	}
+	n := len(ring)
+	nf := float64(n)
+	// edge neighbours e_i and diagonal neighbours f_i, where face i lies
+	// between e_(i-1) and e_i
+	var sumE, sumF, t1, t2 Vector
+	a := 1 + math.Cos(2*math.Pi/nf) + math.Cos(math.Pi/nf)*math.Sqrt(2*(9+math.Cos(2*math.Pi/nf)))
+	for i, f := range ring {
+		e, _ := s.around(f, v)
+		d := s.faces[f][(indexOf(s.faces[f], v)+2)%4]
+		sumE = sumE.Add(s.vertices[e])
+		sumF = sumF.Add(s.vertices[d])
+		theta := 2 * math.Pi * float64(i) / nf
+		prev := 2 * math.Pi * float64(i-1) / nf
+		t1 = t1.Add(s.vertices[e].Times(float32(a * math.Cos(theta))))
+		t1 = t1.Add(s.vertices[d].Times(float32(math.Cos(prev) + math.Cos(theta))))
+		t2 = t2.Add(s.vertices[e].Times(float32(a * math.Sin(theta))))
+		t2 = t2.Add(s.vertices[d].Times(float32(math.Sin(prev) + math.Sin(theta))))
+	}
+	p := s.vertices[v].Times(float32(nf * nf)).Add(sumE.Times(4)).Add(sumF).Times(float32(1 / (nf * (nf + 5))))
+	return p, t1.Cross(t2), true
+}
+
+func indexOf(face []int, v int) int {
+	for k, w := range face {
+		if w == v {
+			return k
+		}
+	}
+	return -1
+}
+
+// triangleMesh splits polygons in triangles fanning out from their first
+// vertex, and stores normals and uvs by vertex
+func (s *subdivisionMesh) triangleMesh(mat Material) Object {
+	var faces []Face
+	for _, f := range s.faces {
+		for k := 1; k+1 < len(f); k++ {
+			faces = append(faces, NewFace(int64(f[0]), int64(f[k]), int64(f[k+1])))
+		}
+	}
+	mesh := NewTriangleMesh(s.vertices, faces, mat).(*TriangleMesh)
+	mesh.Normals = map[int64]Vector{}
+	for i, n := range s.normals {
+		mesh.Normals[int64(i)] = n
+	}
+	if s.uvs != nil {
+		mesh.UV = map[int64]Vector{}
+		for i, uv := range s.uvs {
+			mesh.UV[int64(i)] = uv
+		}
+	}
+	return mesh
+}
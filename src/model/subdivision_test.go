@@ -0,0 +1,172 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+var octahedronVertices = []Vector{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}}
+
+var octahedronFaces = []Face{
+	{0, 2, 4}, {2, 1, 4}, {1, 3, 4}, {3, 0, 4},
+	{2, 0, 5}, {1, 2, 5}, {3, 1, 5}, {0, 3, 5},
+}
+
+var cubeVertices = []Vector{
+	{-1, -1, -1}, {1, -1, -1}, {1, 1, -1}, {-1, 1, -1},
+	{-1, -1, 1}, {1, -1, 1}, {1, 1, 1}, {-1, 1, 1},
+}
+
+var cubeFaces = []QuadFace{
+	{0, 3, 2, 1}, {4, 5, 6, 7}, {0, 1, 5, 4},
+	{2, 3, 7, 6}, {1, 2, 6, 5}, {0, 4, 7, 3},
+}
+
+var cubeEdges = []Edge{
+	{0, 1}, {1, 2}, {2, 3}, {3, 0}, {4, 5}, {5, 6},
+	{6, 7}, {7, 4}, {0, 4}, {1, 5}, {2, 6}, {3, 7},
+}
+
+func TestSubdivisionCounts(t *testing.T) {
+	for i, tt := range []struct {
+		mesh          Object
+		wantVertices  int
+		wantTriangles int
+	}{
+		{mesh: LoopSubdivision(octahedronVertices, octahedronFaces, nil, nil, 0, nil), wantVertices: 6, wantTriangles: 8},
+		// every edge adds a vertex and every triangle splits in four
+		{mesh: LoopSubdivision(octahedronVertices, octahedronFaces, nil, nil, 1, nil), wantVertices: 18, wantTriangles: 32},
+		{mesh: LoopSubdivision(octahedronVertices, octahedronFaces, nil, nil, 2, nil), wantVertices: 66, wantTriangles: 128},
+		// every edge and face adds a vertex and every quad splits in four
+		{mesh: CatmullClarkSubdivision(cubeVertices, cubeFaces, nil, nil, 1, nil), wantVertices: 26, wantTriangles: 48},
+		{mesh: CatmullClarkSubdivision(cubeVertices, cubeFaces, nil, nil, 2, nil), wantVertices: 98, wantTriangles: 192},
+	} {
+		m := tt.mesh.(*TriangleMesh)
+		if len(m.vertices) != tt.wantVertices || len(m.Normals) != tt.wantVertices {
+			t.Errorf("%d) got %d vertices and %d normals want %d", i, len(m.vertices), len(m.Normals), tt.wantVertices)
+		}
+		if got := len(m.as.GetObjects()); got != tt.wantTriangles {
+			t.Errorf("%d) got %d triangles want %d", i, got, tt.wantTriangles)
+		}
+	}
+}
+
+func TestSubdivisionSmooth(t *testing.T) {
+	for i, tt := range []struct {
+		mesh       Object
+		minRadius  float32
+		maxRadius  float32
+		wantNormal float32
+	}{
+		{
+			mesh:      LoopSubdivision(octahedronVertices, octahedronFaces, nil, nil, 3, nil),
+			minRadius: 0.4,
+			maxRadius: 0.5,
+		},
+		{
+			mesh:      CatmullClarkSubdivision(cubeVertices, cubeFaces, nil, nil, 3, nil),
+			minRadius: 0.8,
+			maxRadius: 0.9,
+		},
+	} {
+		m := tt.mesh.(*TriangleMesh)
+		for v, p := range m.vertices {
+			if r := p.Length(); r < tt.minRadius || r > tt.maxRadius {
+				t.Errorf("%d) vertex %v at radius %f", i, p, r)
+			}
+			// the shapes are symmetric around the origin and convex
+			if cos := m.Normals[v].Dot(p.Normalize()); cos < 0.9 {
+				t.Errorf("%d) normal %v at %v", i, m.Normals[v], p)
+			}
+		}
+	}
+}
+
+func TestSubdivisionLimitNormal(t *testing.T) {
+	// a regular vertex of valence 6 on a plane has the plane's normal
+	vertices := []Vector{{0, 0, 0}}
+	var faces []Face
+	for i := 0; i < 6; i++ {
+		theta := float64(i) * math.Pi / 3
+		vertices = append(vertices, Vector{float32(math.Cos(theta)), 0, float32(-math.Sin(theta))})
+		faces = append(faces, NewFace(0, int64(i+1), int64(i+1)%6+1))
+	}
+	m := LoopSubdivision(vertices, faces, nil, nil, 1, nil).(*TriangleMesh)
+	if !compareVectors(m.Normals[0], Vector{0, 1, 0}) || !compareVectors(m.vertices[0], Vector{}) {
+		t.Errorf("got %v with normal %v", m.vertices[0], m.Normals[0])
+	}
+	for v, p := range m.vertices {
+		if !compareFloat32(p.Y, 0) || !compareVectors(m.Normals[v], Vector{0, 1, 0}) {
+			t.Errorf("got %v with normal %v off the plane", p, m.Normals[v])
+		}
+	}
+}
+
+func TestSubdivisionCreases(t *testing.T) {
+	// a cube with all edges creased stays a cube
+	m := CatmullClarkSubdivision(cubeVertices, cubeFaces, nil, cubeEdges, 2, nil).(*TriangleMesh)
+	for _, p := range m.vertices {
+		max := maxf(absf(p.X), maxf(absf(p.Y), absf(p.Z)))
+		if !compareFloat32(max, 1) {
+			t.Errorf("vertex %v off the cube", p)
+		}
+	}
+	if !compareVectors(m.vertices[6], Vector{1, 1, 1}) {
+		t.Errorf("corner moved to %v", m.vertices[6])
+	}
+	// creasing the edges around the bottom keeps it flat, the top is rounded off
+	m = CatmullClarkSubdivision(cubeVertices, cubeFaces, nil, cubeEdges[:4], 2, nil).(*TriangleMesh)
+	var bottom, top int
+	for _, p := range m.vertices {
+		if compareFloat32(p.Z, -1) {
+			bottom++
+		}
+		if compareFloat32(p.Z, 1) {
+			top++
+		}
+	}
+	// the crease and the inside of the bottom face
+	if bottom != 25 || top != 0 {
+		t.Errorf("got %d vertices on the bottom and %d on the top", bottom, top)
+	}
+}
+
+func TestSubdivisionUV(t *testing.T) {
+	vertices := []Vector{{0, 0, 0}, {1, 0, 0}, {1, 0, -1}, {0, 0, -1}}
+	uvs := []Vector{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}
+	m := CatmullClarkSubdivision(vertices, []QuadFace{{0, 1, 2, 3}}, uvs, nil, 1, nil).(*TriangleMesh)
+	if len(m.UV) != 9 {
+		t.Fatalf("got %d uvs want 9", len(m.UV))
+	}
+	// the face point
+	if !compareVectors(m.UV[4], Vector{0.5, 0.5, 0}) || !compareVectors(m.vertices[4], Vector{0.5, 0, -0.5}) {
+		t.Errorf("got uv %v at %v", m.UV[4], m.vertices[4])
+	}
+	for v, n := range m.Normals {
+		if !compareVectors(n, Vector{0, 1, 0}) {
+			t.Errorf("got normal %v at %v", n, m.vertices[v])
+		}
+	}
+}
+
+func TestSubdivisionUnusedVertex(t *testing.T) {
+	unused := Vector{5, 5, 5}
+	for i, tt := range []struct {
+		mesh   Object
+		unused int64
+	}{
+		{mesh: LoopSubdivision([]Vector{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, unused}, []Face{{0, 1, 2}}, nil, nil, 2, nil), unused: 3},
+		{mesh: CatmullClarkSubdivision([]Vector{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, unused}, []QuadFace{{0, 1, 2, 3}}, nil, nil, 2, nil), unused: 4},
+	} {
+		m := tt.mesh.(*TriangleMesh)
+		for v, p := range m.vertices {
+			if math.IsNaN(float64(p.X)) || math.IsNaN(float64(p.Y)) || math.IsNaN(float64(p.Z)) {
+				t.Errorf("%d) got NaN position for vertex %d", i, v)
+			}
+		}
+		// existing vertices keep their index
+		if got := m.vertices[tt.unused]; got != unused {
+			t.Errorf("%d) got unused vertex at %v want %v", i, got, unused)
+		}
+	}
+}
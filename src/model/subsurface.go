@@ -0,0 +1,92 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+)
+
+// walks longer than this are considered absorbed
+const SUBSURFACE_MAX_STEPS = 256
+
+// SubsurfaceMaterial scatters light below the surface of closed objects:
+// wax, marble, skin. Light enters diffusely, performs a random walk
+// through the object's interior and leaves diffusely at the point where the
+// walk crosses the surface again (Chiang et al. 2016).
+// The texture gives the overall albedo of the object, mean free path the
+// average distance light travels between scattering events per channel:
+// the larger, the more translucent.
+type SubsurfaceMaterial struct {
+	material
+	MeanFreePath Color
+}
+
+func NewSubsurfaceMaterial(t Texture, meanFreePath Color) *SubsurfaceMaterial {
+	return &SubsurfaceMaterial{
+		material: material{
+			texture: t,
+		},
+		MeanFreePath: meanFreePath,
+	}
+}
+
+// medium inside the object such that the walk reflects the given albedo
+func (m *SubsurfaceMaterial) medium(albedo Color) *HomogeneousMedium {
+	sigmaT := Color{
+		r: 1 / m.MeanFreePath.r,
+		g: 1 / m.MeanFreePath.g,
+		b: 1 / m.MeanFreePath.b,
+	}
+	single := Color{
+		r: singleScatteringAlbedo(albedo.r),
+		g: singleScatteringAlbedo(albedo.g),
+		b: singleScatteringAlbedo(albedo.b),
+	}
+	sigmaS := sigmaT.Product(single)
+	return NewHomogeneousMedium(sigmaT.Add(sigmaS.Times(-1)), sigmaS, 0)
+}
+
+// inverts the multiple scattering albedo of a random walk in a
+// semi-infinite slab to the single scattering albedo of the medium:
+// fit from Chiang et al. 2016
+func singleScatteringAlbedo(a float32) float32 {
+	if a <= 0 {
+		return 0
+	}
+	if a > 1 {
+		a = 1
+	}
+	x := 4.09712 + 4.20863*a - float32(math.Sqrt(float64(9.59217+41.6808*a+17.7126*a*a)))
+	return 1 - x*x
+}
+
+// randomWalk enters the object at si and returns the surface interaction
+// where light leaves it again, facing outward, with the throughput of the
+// walk. returns false if light is absorbed or the walk hits other geometry
+func (m *SubsurfaceMaterial) randomWalk(random *rand.Rand, scene *Scene, si *SurfaceInteraction) (*SurfaceInteraction, Color, bool) {
+	medium := m.medium(m.GetColor(si))
+	weight := NewColor(255, 255, 255)
+	ray := NewRay(si.Point, cosineSampleHemisphere(random, si.normal.Times(-1)))
+	for i := 0; i < SUBSURFACE_MAX_STEPS; i++ {
+		exit, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+		if !ok {
+			return nil, Color{}, false
+		}
+		t, scattered, w := medium.Sample(random, ray, exit.distance)
+		weight = weight.Product(w)
+		if weight.MaxComponent() == 0 {
+			return nil, Color{}, false
+		}
+		if !scattered {
+			if exit.object.GetMaterial() != Material(m) {
+				return nil, Color{}, false
+			}
+			exit.as = scene.AccelerationStructure
+			exit.depth = si.depth
+			exit.tracer = si.tracer
+			return exit, weight, true
+		}
+		direction, _ := medium.PhaseFunction().Sample(random, ray.Direction)
+		ray = NewRay(PointFromRay(ray, t), direction)
+	}
+	return nil, Color{}, false
+}
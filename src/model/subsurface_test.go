@@ -0,0 +1,48 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSingleScatteringAlbedo(t *testing.T) {
+	for i, tt := range []struct {
+		albedo float32
+		want   float32
+	}{
+		{albedo: 0, want: 0},
+		{albedo: 1, want: 1},
+		{albedo: 0.5, want: 0.9117},
+	} {
+		if got := singleScatteringAlbedo(tt.albedo); math.Abs(float64(got-tt.want)) > 1e-3 {
+			t.Errorf("%d) got %f want %f", i, got, tt.want)
+		}
+	}
+}
+
+func TestSubsurfaceRandomWalk(t *testing.T) {
+	random := rand.New(rand.NewSource(42))
+	m := NewSubsurfaceMaterial(NewConstantTexture(NewColor(255, 255, 255)), NewColor(255, 255, 255).Times(0.5))
+	sphere := NewSphere(Vector{0, 0, 0}, 2, m)
+	scene := &Scene{AccelerationStructure: NewNaiveAcceleration([]Object{sphere})}
+	si, ok := sphere.Intersect(NewRay(Vector{0, 0, -5}, Vector{0, 0, 1}))
+	if !ok {
+		t.Fatal("expected hit")
+	}
+	for i := 0; i < 100; i++ {
+		exit, weight, ok := m.randomWalk(random, scene, si)
+		if !ok {
+			continue
+		}
+		if d := exit.Point.Length(); math.Abs(float64(d-2)) > 1e-3 {
+			t.Errorf("%d) exit point %v not on sphere", i, exit.Point)
+		}
+		if exit.normal.Dot(exit.Point) <= 0 {
+			t.Errorf("%d) exit normal %v not facing outward", i, exit.normal)
+		}
+		if weight.MaxComponent() <= 0 {
+			t.Errorf("%d) got zero weight for a white material", i)
+		}
+	}
+}
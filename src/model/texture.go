@@ -71,43 +71,112 @@ func TriangleMeshUVFunc(si *SurfaceInteraction) Vector {
 	return uv
 }
 
+// SphereUVFunc maps points on a Sphere to the equirectangular mapping
+// used by EnvironmentLight, with the top of an image at +y
+func SphereUVFunc(si *SurfaceInteraction) Vector {
+	s := si.GetObject().(Sphere)
+	u, v := equirectangularUV(VectorFromTo(s.Center, si.UntransformedPoint).Normalize())
+	return Vector{u, 1 - v, 0}
+}
+
+// ScaledTexture scales the colors of a texture, for instance to turn an
+// image into the radiance of an emitter such as a screen or sign
+type ScaledTexture struct {
+	Texture
+	Scale float32
+}
+
+func NewScaledTexture(t Texture, scale float32) ScaledTexture {
+	return ScaledTexture{
+		Texture: t,
+		Scale:   scale,
+	}
+}
+
+func (t ScaledTexture) GetColor(si *SurfaceInteraction) Color {
+	return t.Texture.GetColor(si).Times(t.Scale)
+}
+
+// ImageTexture looks up an image by the uvs of uvFunc, with 0,0 at the
+// bottom left of the image. Lookups are filtered over the footprint of
+// rays that carry differentials, such as camera rays, and bilinear
+// otherwise
 type ImageTexture struct {
-	texture
-	img image.Image
+	uvFunc func(*SurfaceInteraction) Vector
+	mipmap *mipmap
+	Wrap   WrapMode
+	Filter FilterMode
+	// largest ratio of the axes of the EWA filter; longer footprints are
+	// filtered more widely than they should be, to bound the cost
+	MaxAnisotropy float32
 }
 
+// NewImageTexture converts img to floats and builds its MIP pyramid once.
+// It repeats the image and filters trilinearly by default
 func NewImageTexture(img image.Image, uvFunc func(*SurfaceInteraction) Vector) ImageTexture {
-	b := img.Bounds()
-	minx := float32(b.Min.X)
-	miny := float32(b.Min.Y)
-	w := float32(b.Max.X) - minx
-	h := float32(b.Max.Y) - miny
+	return newImageTexture(img, uvFunc, func(r, g, b, a uint32) Color {
+		// colors are premultiplied by alpha, which is applied by
+		// the material's opacity instead
+		if a > 0 && a < 65535 {
+			return Color{float32(r) / float32(a), float32(g) / float32(a), float32(b) / float32(a)}
+		}
+		r256 := (float32(r) / 65535)
+		g256 := (float32(g) / 65535)
+		b256 := (float32(b) / 65535)
+		return Color{r256, g256, b256}
+	})
+}
+
+// NewImageAlphaTexture reads the alpha channel of an image as gray, to
+// use as the Opacity of a material
+func NewImageAlphaTexture(img image.Image, uvFunc func(*SurfaceInteraction) Vector) ImageTexture {
+	return newImageTexture(img, uvFunc, func(_, _, _, a uint32) Color {
+		alpha := float32(a) / 65535
+		return Color{alpha, alpha, alpha}
+	})
+}
+
+func newImageTexture(img image.Image, uvFunc func(*SurfaceInteraction) Vector, pixelFunc func(r, g, b, a uint32) Color) ImageTexture {
 	return ImageTexture{
-		texture: texture{
-			uvFunc: uvFunc,
-			// golang image bounds do not necessarily contain 0,0
-			// Min.X, Min.Y is top left
-			// Max.X-1, Max.Y-1 is bottom right
-			// whilst u,v normally has 0,0 as bottom left
-			// and 1,1 as top right ?
-			mappingFunc: func(u, v float32) Vector {
-				v = 1 - v // invert y axis
-				return Vector{
-					X: minx + w*u,
-					Y: miny + h*v,
-					Z: 0,
-				}
-			},
-			colorFunc: func(st Vector) Color {
-				r, g, b, _ := img.At(int(st.X), int(st.Y)).RGBA()
-				r256 := (float32(r) / 65535)
-				g256 := (float32(g) / 65535)
-				b256 := (float32(b) / 65535)
-				return Color{r256, g256, b256}
-			},
-		},
-		img: img,
+		uvFunc:        uvFunc,
+		mipmap:        newMipmap(img, pixelFunc),
+		Wrap:          WrapRepeat,
+		Filter:        FilterTrilinear,
+		MaxAnisotropy: 8,
+	}
+}
+
+func (it ImageTexture) GetColor(si *SurfaceInteraction) Color {
+	uv := it.uvFunc(si)
+	// images go down from their top left, whilst v goes up
+	s, t := uv.X, 1-uv.Y
+	if it.Filter == FilterNearest {
+		return it.mipmap.nearest(s, t, it.Wrap)
+	}
+	duvdx, duvdy, ok := uvDifferentials(si, it.uvFunc, uv)
+	if !ok || it.Filter == FilterBilinear {
+		return it.mipmap.bilinear(0, s, t, it.Wrap)
+	}
+	dst0, dst1 := Vector{duvdx.X, -duvdx.Y, 0}, Vector{duvdy.X, -duvdy.Y, 0}
+	if it.Filter == FilterTrilinear {
+		return it.mipmap.trilinear(s, t, dst0, dst1, it.Wrap)
+	}
+	return it.mipmap.ewa(s, t, dst0, dst1, it.MaxAnisotropy, it.Wrap)
+}
+
+// uvDifferentials returns how the uvs of uvFunc change when the ray hitting
+// si moves one pixel along x and y, if it has ray differentials
+func uvDifferentials(si *SurfaceInteraction, uvFunc func(*SurfaceInteraction) Vector, uv Vector) (duvdx, duvdy Vector, ok bool) {
+	if si == nil {
+		return Vector{}, Vector{}, false
+	}
+	dpdx, dpdy, ok := si.differentials()
+	if !ok {
+		return Vector{}, Vector{}, false
 	}
+	duvdx = uvFunc(si.movedTo(si.UntransformedPoint.Add(dpdx))).Sub(uv)
+	duvdy = uvFunc(si.movedTo(si.UntransformedPoint.Add(dpdy))).Sub(uv)
+	return duvdx, duvdy, true
 }
 
 type CheckerboardTexture struct {
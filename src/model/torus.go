@@ -0,0 +1,217 @@
+package model
+
+import (
+	"math"
+	"sort"
+)
+
+// A Torus around the z axis whose tube of MinorRadius circles the origin
+// at MajorRadius, swept up to PhiMax radians around the axis
+type Torus struct {
+	shape
+	MajorRadius float32
+	MinorRadius float32
+	PhiMax      float64
+}
+
+func NewTorus(toWorld Transform, majorRadius, minorRadius float32, phiMax float64, m Material) Torus {
+	return Torus{
+		shape:       newShape(toWorld, m),
+		MajorRadius: majorRadius,
+		MinorRadius: minorRadius,
+		PhiMax:      clampPhiMax(phiMax),
+	}
+}
+
+func (t Torus) Bound(tr Transform) AABB {
+	xy := t.MajorRadius + t.MinorRadius
+	return t.bound(tr, Vector{-xy, -xy, -t.MinorRadius}, Vector{xy, xy, t.MinorRadius})
+}
+
+// Substituting the ray in (x^2 + y^2 + z^2 + R^2 - r^2)^2 = 4R^2 (x^2 + y^2)
+// gives a quartic in the distance along the ray
+func (t Torus) Intersect(r Ray) (*SurfaceInteraction, bool) {
+	l := t.worldToObject.Ray(r)
+	return t.hit(t, r, l, t.roots(l, 0), t.inside, t.normal)
+}
+
+// roots returns the distances along ray in object space where it crosses
+// the full torus, from min onwards
+func (t Torus) roots(l Ray, min float64) []float64 {
+	// start the ray at its bounding sphere for better conditioned roots
+	bounding := float64(t.MajorRadius + t.MinorRadius)
+	o := vector64(l.Origin)
+	d := vector64(l.Direction)
+	sphere := quadratic(1, 2*dot64(o, d), dot64(o, o)-bounding*bounding)
+	if len(sphere) == 0 || sphere[1] <= min {
+		return nil
+	}
+	start := math.Max(min, sphere[0])
+	for i := range o {
+		o[i] += start * d[i]
+	}
+	R2 := float64(t.MajorRadius * t.MajorRadius)
+	r2 := float64(t.MinorRadius * t.MinorRadius)
+	e := dot64(o, o) - R2 - r2
+	f := dot64(o, d)
+	roots := solveQuartic(
+		4*f,
+		2*e+4*f*f+4*R2*d[2]*d[2],
+		4*f*e+8*R2*o[2]*d[2],
+		e*e-4*R2*(r2-o[2]*o[2]),
+	)
+	for i := range roots {
+		roots[i] += start
+	}
+	return roots
+}
+
+// Intervals ignores PhiMax, as only the full torus is a closed solid
+func (t Torus) Intervals(r Ray) []Interval {
+	l := t.worldToObject.Ray(r)
+	roots := t.roots(l, math.Inf(-1))
+	// a ray grazing the tube can give an odd number of roots
+	if len(roots)%2 != 0 {
+		return nil
+	}
+	intervals := make([]Interval, 0, len(roots)/2)
+	for i := 0; i < len(roots); i += 2 {
+		intervals = append(intervals, Interval{
+			In:  t.interaction(t, r, l, roots[i], t.normal),
+			Out: t.interaction(t, r, l, roots[i+1], t.normal),
+		})
+	}
+	return intervals
+}
+
+func (t Torus) inside(p Vector) bool {
+	return phi(p) <= t.PhiMax
+}
+
+// pointing away from the circle at the center of the tube
+func (t Torus) normal(p Vector) Vector {
+	xy := float32(math.Sqrt(float64(p.X*p.X + p.Y*p.Y)))
+	if xy == 0 {
+		return Vector{0, 0, p.Z}
+	}
+	s := t.MajorRadius / xy
+	return Vector{p.X - s*p.X, p.Y - s*p.Y, p.Z}
+}
+
+func (t Torus) SurfaceNormal(p Vector) Vector {
+	return t.surfaceNormal(p, t.normal)
+}
+
+// u goes around the z axis, v around the tube starting at its outside
+func (t Torus) UV(p Vector) Vector {
+	o := t.worldToObject.Point(p)
+	xy := math.Sqrt(float64(o.X*o.X + o.Y*o.Y))
+	theta := math.Atan2(float64(o.Z), xy-float64(t.MajorRadius))
+	if theta < 0 {
+		theta += 2 * math.Pi
+	}
+	return Vector{float32(phi(o) / t.PhiMax), float32(theta / (2 * math.Pi)), 0}
+}
+
+func vector64(v Vector) [3]float64 {
+	return [3]float64{float64(v.X), float64(v.Y), float64(v.Z)}
+}
+
+func dot64(u, v [3]float64) float64 {
+	return u[0]*v[0] + u[1]*v[1] + u[2]*v[2]
+}
+
+const QUARTIC_EPSILON = 1e-9
+
+func isZero(x float64) bool {
+	return x > -QUARTIC_EPSILON && x < QUARTIC_EPSILON
+}
+
+// solveCubic returns the real roots of x^3 + a x^2 + b x + c using
+// Cardano's formula, from Schwarze in Graphics Gems I
+func solveCubic(a, b, c float64) []float64 {
+	// substitute x = y - a/3 to eliminate the quadratic term
+	sqA := a * a
+	p := (-sqA/3 + b) / 3
+	q := (2*a*sqA/27 - a*b/3 + c) / 2
+	cbP := p * p * p
+	D := q*q + cbP
+	var roots []float64
+	switch {
+	case isZero(D):
+		if isZero(q) {
+			roots = []float64{0}
+		} else {
+			u := math.Cbrt(-q)
+			roots = []float64{2 * u, -u}
+		}
+	case D < 0:
+		// three real roots
+		angle := math.Acos(-q/math.Sqrt(-cbP)) / 3
+		t := 2 * math.Sqrt(-p)
+		roots = []float64{t * math.Cos(angle), -t * math.Cos(angle+math.Pi/3), -t * math.Cos(angle-math.Pi/3)}
+	default:
+		sqrtD := math.Sqrt(D)
+		roots = []float64{math.Cbrt(sqrtD-q) - math.Cbrt(sqrtD+q)}
+	}
+	for i := range roots {
+		roots[i] -= a / 3
+	}
+	return roots
+}
+
+// solveQuartic returns the real roots of x^4 + a x^3 + b x^2 + c x + d in
+// ascending order using Ferrari's method, from Schwarze in Graphics Gems I.
+// The roots are polished with Newton's method as the closed form loses
+// precision
+func solveQuartic(a, b, c, d float64) []float64 {
+	// substitute x = y - a/4 to eliminate the cubic term
+	sqA := a * a
+	p := -3*sqA/8 + b
+	q := sqA*a/8 - a*b/2 + c
+	r := -3*sqA*sqA/256 + sqA*b/16 - a*c/4 + d
+	var roots []float64
+	if isZero(r) {
+		// y (y^3 + p y + q) = 0
+		roots = append(solveCubic(0, p, q), 0)
+	} else {
+		// one root of the resolvent cubic splits the quartic in two quadratics
+		z := solveCubic(-p/2, -r, r*p/2-q*q/8)[0]
+		u := z*z - r
+		v := 2*z - p
+		switch {
+		case isZero(u):
+			u = 0
+		case u > 0:
+			u = math.Sqrt(u)
+		default:
+			return nil
+		}
+		switch {
+		case isZero(v):
+			v = 0
+		case v > 0:
+			v = math.Sqrt(v)
+		default:
+			return nil
+		}
+		if q < 0 {
+			v = -v
+		}
+		roots = append(quadratic(1, v, z-u), quadratic(1, -v, z+u)...)
+	}
+	for i, y := range roots {
+		x := y - a/4
+		for j := 0; j < 4; j++ {
+			f := (((x+a)*x+b)*x+c)*x + d
+			df := ((4*x+3*a)*x+2*b)*x + c
+			if df == 0 {
+				break
+			}
+			x -= f / df
+		}
+		roots[i] = x
+	}
+	sort.Float64s(roots)
+	return roots
+}
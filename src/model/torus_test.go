@@ -0,0 +1,128 @@
+package model
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTorusIntersect(t *testing.T) {
+	for i, tt := range []struct {
+		t         Torus
+		r         Ray
+		want      float32
+		wantTruth bool
+	}{
+		{
+			t:         NewTorus(ScaleUniform(1), 2, 0.5, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 0}, Vector{-1, 0, 0}),
+			want:      2.5,
+			wantTruth: true,
+		},
+		{
+			// through the hole
+			t:         NewTorus(ScaleUniform(1), 2, 0.5, 2*math.Pi, nil),
+			r:         NewRay(Vector{0, 0, 5}, Vector{0, 0, -1}),
+			wantTruth: false,
+		},
+		{
+			t:         NewTorus(ScaleUniform(1), 2, 0.5, 2*math.Pi, nil),
+			r:         NewRay(Vector{2, 0, 5}, Vector{0, 0, -1}),
+			want:      4.5,
+			wantTruth: true,
+		},
+		{
+			// ray starting inside the tube
+			t:         NewTorus(ScaleUniform(1), 2, 0.5, 2*math.Pi, nil),
+			r:         NewRay(Vector{2, 0, 0}, Vector{1, 0, 0}),
+			want:      0.5,
+			wantTruth: true,
+		},
+		{
+			t:         NewTorus(ScaleUniform(1), 2, 0.5, 2*math.Pi, nil),
+			r:         NewRay(Vector{5, 0, 1}, Vector{-1, 0, 0}),
+			wantTruth: false,
+		},
+		{
+			// the near half is cut away by phiMax
+			t:         NewTorus(ScaleUniform(1), 2, 0.5, math.Pi, nil),
+			r:         NewRay(Vector{0, -5, 0}, Vector{0, 1, 0}),
+			want:      6.5,
+			wantTruth: true,
+		},
+		{
+			t:         NewTorus(ScaleUniform(2), 2, 0.5, 2*math.Pi, nil),
+			r:         NewRay(Vector{10, 0, 0}, Vector{-1, 0, 0}),
+			want:      5.0,
+			wantTruth: true,
+		},
+	} {
+		got, found := tt.t.Intersect(tt.r)
+		if !found && tt.wantTruth == false {
+			continue
+		}
+		if (!found && tt.wantTruth == true) || (found && tt.wantTruth == false) {
+			t.Errorf("%d) incorrect bool value; want %v", i, tt.wantTruth)
+			continue
+		}
+		if !compareFloat32(got.distance, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got.distance, tt.want)
+		}
+	}
+}
+
+func TestTorusSurfaceNormal(t *testing.T) {
+	for i, tt := range []struct {
+		t    Torus
+		v    Vector
+		want Vector
+	}{
+		{
+			t:    NewTorus(ScaleUniform(1), 2, 0.5, 2*math.Pi, nil),
+			v:    Vector{2.5, 0, 0},
+			want: Vector{1, 0, 0},
+		},
+		{
+			t:    NewTorus(ScaleUniform(1), 2, 0.5, 2*math.Pi, nil),
+			v:    Vector{0, -2, 0.5},
+			want: Vector{0, 0, 1},
+		},
+		{
+			t:    NewTorus(ScaleUniform(1), 2, 0.5, 2*math.Pi, nil),
+			v:    Vector{1.5, 0, 0},
+			want: Vector{-1, 0, 0},
+		},
+	} {
+		got := tt.t.SurfaceNormal(tt.v)
+		if !compareVectors(got, tt.want) {
+			t.Errorf("%d) got %v want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestSolveQuartic(t *testing.T) {
+	for i, tt := range []struct {
+		roots []float64
+	}{
+		{roots: []float64{-2, -1, 1, 2}},
+		{roots: []float64{0.5, 1.5, 3, 10}},
+		{roots: []float64{-3, 0, 0.25, 7}},
+	} {
+		r := tt.roots
+		// expand (x-r0)(x-r1)(x-r2)(x-r3)
+		a := -(r[0] + r[1] + r[2] + r[3])
+		b := r[0]*r[1] + r[0]*r[2] + r[0]*r[3] + r[1]*r[2] + r[1]*r[3] + r[2]*r[3]
+		c := -(r[0]*r[1]*r[2] + r[0]*r[1]*r[3] + r[0]*r[2]*r[3] + r[1]*r[2]*r[3])
+		d := r[0] * r[1] * r[2] * r[3]
+		got := solveQuartic(a, b, c, d)
+		if len(got) != 4 {
+			t.Errorf("%d) got roots %v want %v", i, got, r)
+			continue
+		}
+		for j := range got {
+			if math.Abs(got[j]-r[j]) > 1e-6 {
+				t.Errorf("%d) got roots %v want %v", i, got, r)
+				break
+			}
+		}
+	}
+}
@@ -7,10 +7,12 @@ import (
 )
 
 const (
-	standardAlbedo   = 0.18
-	MAX_RAY_DISTANCE = 1000000.0
-	MAX_RAY_DEPTH    = 5
-	INVPI            = 1 / math.Pi
+	standardAlbedo        = 0.18
+	MAX_RAY_DISTANCE      = 1000000.0
+	DEFAULT_MAX_RAY_DEPTH = 5
+	// paths are only terminated by russian roulette after this many bounces
+	RUSSIAN_ROULETTE_DEPTH = 3
+	INVPI                  = 1 / math.Pi
 )
 
 var BACKGROUND_COLOR Color
@@ -22,7 +24,18 @@ type Tracer interface {
 }
 
 type tracer struct {
-	random *rand.Rand
+	random   *rand.Rand
+	maxDepth int
+}
+
+func newTracer(maxDepth int) tracer {
+	if maxDepth <= 0 {
+		maxDepth = DEFAULT_MAX_RAY_DEPTH
+	}
+	return tracer{
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		maxDepth: maxDepth,
+	}
 }
 
 func (t tracer) Random() *rand.Rand {
@@ -35,36 +48,60 @@ const (
 	WhittedStyle TracerType = iota
 	Path
 	PathNextEventEstimate
+	PathMultipleImportanceSampling
+	BidirectionalPath
+	PhotonMapping
+	ProgressivePhotonMapping
+	AmbientOcclusion
+	DebugShadingNormals
+	DebugGeometricNormals
+	DebugDepth
+	DebugUV
+	DebugObjectID
+	DebugBVHNodeVisits
+	DebugBVHPrimitiveTests
+	VolumetricPath
+	SpectralPath
 )
 
 type whittedRayTracer struct {
 	tracer
 }
 
-func NewWhittedRayTracer() Tracer {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return &whittedRayTracer{tracer{random: r}}
+func NewWhittedRayTracer(maxDepth int) Tracer {
+	return &whittedRayTracer{newTracer(maxDepth)}
 }
 
 func (wrt whittedRayTracer) GetRayColor(ray Ray, scene *Scene, depth int) Color {
-	if depth == MAX_RAY_DEPTH {
+	if depth == wrt.maxDepth {
 		return BLACK
 	}
 
 	si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
 	if !ok {
+		if scene.Environment != nil {
+			return scene.Environment.Radiance(ray.Direction)
+		}
 		return BACKGROUND_COLOR
 	}
 
 	si.as = scene.AccelerationStructure
 	si.depth = depth
 	si.tracer = wrt
+	si.applyShadingNormal()
 
-	color := NewColor(0, 0, 0)
 	material := si.object.GetMaterial()
-	for _, light := range scene.Lights {
-		lightSegment := light.GetLightSegment(si.Point)
-		maxDistance := lightSegment.Length()
+	// emitters look the same however they are lit
+	if material.IsLight() {
+		return emittedRadiance(si, ray.Direction.Times(-1))
+	}
+	color := NewColor(0, 0, 0)
+	for _, light := range scene.lights {
+		li, lightSegment, pdf := light.SampleLi(wrt.random, si.Point)
+		if pdf == 0 {
+			continue
+		}
+		maxDistance := lightSegment.Length() - ERROR_MARGIN
 		if pointInShadow(si.Point, lightSegment, maxDistance, si.as) {
 			continue
 		}
@@ -78,14 +115,13 @@ func (wrt whittedRayTracer) GetRayColor(ray Ray, scene *Scene, depth int) Color
 
 		var objectColor Color
 		switch mat := material.(type) {
-		case *RadiantMaterial:
-			objectColor = mat.GetColor(si)
 		// NormalMappingMaterial only works properly when wrapping DiffuseMaterial now
-		case *DiffuseMaterial, *NormalMappingMaterial:
+		// SubsurfaceMaterial is approximated as diffuse
+		case *DiffuseMaterial, *NormalMappingMaterial, *SubsurfaceMaterial:
 			objectColor = mat.GetColor(si)
 			lightRatio := si.normal.Dot(lightSegment.Normalize())
-			factors := standardAlbedo * INVPI * light.Intensity(lightSegment.Length()) * lightRatio
-			lightColor := light.Color().Times(factors)
+			factors := standardAlbedo * INVPI * lightRatio / pdf
+			lightColor := li.Times(factors)
 			objectColor = objectColor.Product(lightColor)
 		case *ReflectiveMaterial:
 			i := ray.Direction
@@ -110,107 +146,306 @@ func pointInShadow(point, segment Vector, maxDistance float32, as AccelerationSt
 	return false
 }
 
+// russianRoulette randomly terminates a path based on its throughput
+// surviving paths are weighted up so the estimate stays unbiased
+func russianRoulette(random *rand.Rand, throughput Color, depth int) (Color, bool) {
+	if depth < RUSSIAN_ROULETTE_DEPTH {
+		return throughput, true
+	}
+	q := 1 - throughput.MaxComponent()
+	if q < 0.05 {
+		q = 0.05
+	}
+	if random.Float32() < q {
+		return throughput, false
+	}
+	return throughput.Times(1 / (1 - q)), true
+}
+
+// sampleDirectLight chooses a light or the environment and samples it, returning the light (nil for the environment), the radiance arriving
+// at si, the direction towards the light and the pdf of having sampled it
+// with respect to solid angle at si.
+// returns false if the sample is occluded or does not contribute
+func sampleDirectLight(random *rand.Rand, scene *Scene, si *SurfaceInteraction) (Light, Color, Vector, float32, bool) {
+	if scene.chooseEnvironment(random) {
+		le, wi, pdf, ok := sampleEnvironment(random, scene, si)
+		return nil, le, wi, pdf, ok
+	}
+	light, pmf := scene.sampleLight(random, si.Point, si.normal)
+	if light == nil {
+		return nil, Color{}, Vector{}, 0, false
+	}
+	li, l, pdf := light.SampleLi(random, si.Point)
+	if pdf == 0 {
+		return nil, Color{}, Vector{}, 0, false
+	}
+	dist := l.Length()
+	wi := l.Normalize()
+	if si.normal.Dot(wi) <= 0 {
+		return nil, Color{}, Vector{}, 0, false
+	}
+	if pointInShadow(si.Point, l, dist-ERROR_MARGIN, si.as) {
+		return nil, Color{}, Vector{}, 0, false
+	}
+	return light, li, wi, pdf * pmf, true
+}
+
+// sampleEnvironment is sampleDirectLight for the environment light
+func sampleEnvironment(random *rand.Rand, scene *Scene, si *SurfaceInteraction) (Color, Vector, float32, bool) {
+	wi, le, pdf := scene.Environment.sample(random)
+	if pdf == 0 || si.normal.Dot(wi) <= 0 {
+		return Color{}, Vector{}, 0, false
+	}
+	if pointInShadow(si.Point, wi, MAX_RAY_DISTANCE, si.as) {
+		return Color{}, Vector{}, 0, false
+	}
+	return le, wi, pdf * scene.environmentPMF(), true
+}
+
+// solid angle pdf of sampling direction d towards the environment
+// through sampleDirectLight
+func environmentPDF(scene *Scene, d Vector) float32 {
+	return scene.Environment.pdf(d) * scene.environmentPMF()
+}
+
+// solid angle pdf of sampling a point on area light l through
+// sampleDirectLight from p with normal n; dist and cos are the distance
+// to and the cosine at the sampled point
+func areaLightPDF(scene *Scene, l *AreaLight, p, n Vector, dist, cos float32) float32 {
+	return l.pdf(p, dist, cos) * scene.lightPMF(p, n, l)
+}
+
+// power heuristic with beta 2 for combining two sampling strategies: pbrt 801
+func powerHeuristic(fPDF, gPDF float32) float32 {
+	f, g := fPDF*fPDF, gPDF*gPDF
+	if f+g == 0 {
+		return 0
+	}
+	return f / (f + g)
+}
+
 type pathTracer struct {
 	tracer
 }
 
-func NewPathTracer() Tracer {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return &pathTracer{tracer{random: r}}
+func NewPathTracer(maxDepth int) Tracer {
+	return &pathTracer{newTracer(maxDepth)}
 }
 
-const pdf = 2.0 * math.Pi
-
 func (pt *pathTracer) GetRayColor(ray Ray, scene *Scene, depth int) Color {
-	if depth == MAX_RAY_DEPTH {
-		return BLACK
-	}
+	color := NewColor(0, 0, 0)
+	throughput := NewColor(255, 255, 255)
+	for ; depth < pt.maxDepth; depth++ {
+		si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+		if !ok {
+			if scene.Environment != nil {
+				color = color.Add(throughput.Product(scene.Environment.Radiance(ray.Direction)))
+			}
+			break
+		}
 
-	si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
-	if !ok {
-		return BLACK
-	}
+		si.as = scene.AccelerationStructure
+		si.depth = depth
+		si.tracer = pt
+		si.applyShadingNormal()
 
-	si.as = scene.AccelerationStructure
-	si.depth = depth
-	si.tracer = pt
+		if si.object.IsLight() {
+			color = color.Add(throughput.Product(emittedRadiance(si, ray.Direction.Times(-1))))
+			break
+		}
+		surfaceDiffuseColor := si.object.GetColor(si)
+		if mat, ok := si.object.GetMaterial().(*SubsurfaceMaterial); ok {
+			exit, weight, ok := mat.randomWalk(pt.random, scene, si)
+			if !ok {
+				break
+			}
+			// the walk accounts for the albedo
+			throughput = throughput.Product(weight)
+			si, surfaceDiffuseColor = exit, NewColor(255, 255, 255)
+		}
+		brdf := surfaceDiffuseColor.Times(INVPI)
 
-	if si.object.IsLight() {
-		return si.object.GetColor(si)
+		// importance sampled new ray
+		direction := si.object.SampleDirection(pt.random, si.normal)
+		pdf := si.object.GetMaterial().PDF(si.normal, direction)
+		if pdf == 0 {
+			break
+		}
+		cos := si.normal.Dot(direction)
+		throughput = throughput.Product(brdf.Times(cos / pdf))
+		throughput, ok = russianRoulette(pt.random, throughput, depth)
+		if !ok {
+			break
+		}
+		ray = NewRay(si.Point, direction)
 	}
-	surfaceDiffuseColor := si.object.GetColor(si)
-	brdf := surfaceDiffuseColor.Times(INVPI)
-
-	// random new ray
-	randomDirection := randomInHemisphere(pt.random, si.normal)
-	newRay := NewRay(si.Point, randomDirection)
-	cos := si.normal.Dot(randomDirection)
-	recursiveColor := pt.GetRayColor(newRay, scene, depth+1)
-	//pdf := 1.0 / (2.0 * math.Pi)
-	//TODO: albedo? just multiplying with standardalbedo leads to horrible results
-	// probably because light intensity does not make sense yet
-	sampleColor := recursiveColor.Times(cos * pdf).Product(brdf)
-	return sampleColor
+	return color
 }
 
 type pathTracerNEE struct {
 	tracer
 }
 
-func NewPathTracerNEE() Tracer {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return &pathTracerNEE{tracer{random: r}}
+func NewPathTracerNEE(maxDepth int) Tracer {
+	return &pathTracerNEE{newTracer(maxDepth)}
 }
 
 func (pt *pathTracerNEE) GetRayColor(ray Ray, scene *Scene, depth int) Color {
-	if depth == MAX_RAY_DEPTH {
-		return BLACK
-	}
+	color := NewColor(0, 0, 0)
+	throughput := NewColor(255, 255, 255)
+	for bounce := depth; bounce < pt.maxDepth; bounce++ {
+		si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+		if !ok {
+			if scene.Environment != nil && bounce == depth {
+				color = color.Add(throughput.Product(scene.Environment.Radiance(ray.Direction)))
+			}
+			break
+		}
 
-	si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
-	if !ok {
-		return BLACK
-	}
+		si.as = scene.AccelerationStructure
+		si.depth = bounce
+		si.tracer = pt
+		si.applyShadingNormal()
+
+		// only count light if we immediately hit it
+		// direct light sampling counts the rest
+		if si.object.IsLight() {
+			if bounce == depth {
+				color = color.Add(throughput.Product(emittedRadiance(si, ray.Direction.Times(-1))))
+			}
+			break
+		}
+		surfaceDiffuseColor := si.object.GetColor(si)
+		if mat, ok := si.object.GetMaterial().(*SubsurfaceMaterial); ok {
+			exit, weight, ok := mat.randomWalk(pt.random, scene, si)
+			if !ok {
+				break
+			}
+			// the walk accounts for the albedo
+			throughput = throughput.Product(weight)
+			si, surfaceDiffuseColor = exit, NewColor(255, 255, 255)
+		}
+		brdf := surfaceDiffuseColor.Times(INVPI)
 
-	si.as = scene.AccelerationStructure
-	si.depth = depth
-	si.tracer = pt
+		// direct light sampling
+		if _, lightColor, wi, lightPDF, ok := sampleDirectLight(pt.random, scene, si); ok {
+			cos := si.normal.Dot(wi)
+			direct := lightColor.Product(brdf).Times(cos / lightPDF)
+			color = color.Add(throughput.Product(direct))
+		}
 
-	// only count light if we immediately hit it
-	// direct light sampling counts the rest
-	if si.object.IsLight() {
-		if depth == 0 {
-			return si.object.GetColor(si)
+		// indirect light sampling: importance sampled new ray
+		direction := si.object.SampleDirection(pt.random, si.normal)
+		pdf := si.object.GetMaterial().PDF(si.normal, direction)
+		if pdf == 0 {
+			break
 		}
-		return BLACK
+		cos := si.normal.Dot(direction)
+		throughput = throughput.Product(brdf.Times(cos / pdf))
+		throughput, ok = russianRoulette(pt.random, throughput, bounce)
+		if !ok {
+			break
+		}
+		ray = NewRay(si.Point, direction)
 	}
-	surfaceDiffuseColor := si.object.GetColor(si)
-	brdf := surfaceDiffuseColor.Times(INVPI)
+	return color
+}
 
-	// direct light sampling
-	direct := NewColor(0, 0, 0)
-	light := scene.randomEmitter(pt.random)
-	lpoint := light.Sample(pt.random)
-	nl := light.SurfaceNormal(lpoint)
-	l := VectorFromTo(si.Point, lpoint)
-	lightFacing := si.normal.Dot(l.Normalize())
-	dist := l.Length()
-	lightCos := nl.Dot(l.Normalize().Times(-1))
-	if lightFacing > 0 && lightCos > 0 && !pointInShadow(si.Point, l, dist, si.as) {
-		lightPDF := 1.0 / float32(len(scene.Emitters))
-		solidAngle := (lightCos * light.SurfaceArea()) / (dist * dist * lightPDF)
-		lightColor := light.GetColor(si)
-		direct = lightColor.Times(solidAngle).Product(brdf).Times(lightFacing)
-	}
-
-	// indirect light sampling: random new ray
-	randomDirection := si.object.SampleDirection(pt.random, si.normal)
-	newRay := NewRay(si.Point, randomDirection)
-	cos := si.normal.Dot(randomDirection)
-	recursiveColor := pt.GetRayColor(newRay, scene, depth+1)
-	//pdf := 1.0 / (2.0 * math.Pi)
-	//TODO: albedo? just multiplying with standardalbedo leads to horrible results
-	// probably because light intensity does not make sense yet
-	indirect := recursiveColor.Times(cos * pdf).Product(brdf)
-	return direct.Add(indirect)
+// pathTracerMIS combines light sampling and brdf sampling using
+// multiple importance sampling: both strategies can find an emitter and
+// each contribution is weighted using the power heuristic
+type pathTracerMIS struct {
+	tracer
+}
+
+func NewPathTracerMIS(maxDepth int) Tracer {
+	return &pathTracerMIS{newTracer(maxDepth)}
+}
+
+func (pt *pathTracerMIS) GetRayColor(ray Ray, scene *Scene, depth int) Color {
+	color := NewColor(0, 0, 0)
+	throughput := NewColor(255, 255, 255)
+	var brdfPDF float32
+	// the surface the ray left from, for weighting light sampling
+	var prev *SurfaceInteraction
+	for bounce := depth; bounce < pt.maxDepth; bounce++ {
+		si, ok := scene.AccelerationStructure.ClosestIntersection(ray, MAX_RAY_DISTANCE)
+		if !ok {
+			if scene.Environment != nil {
+				weight := float32(1)
+				if bounce != depth {
+					weight = powerHeuristic(brdfPDF, environmentPDF(scene, ray.Direction))
+				}
+				le := scene.Environment.Radiance(ray.Direction)
+				color = color.Add(throughput.Product(le).Times(weight))
+			}
+			break
+		}
+
+		si.as = scene.AccelerationStructure
+		si.depth = bounce
+		si.tracer = pt
+		si.applyShadingNormal()
+
+		if si.object.IsLight() {
+			lightColor := emittedRadiance(si, ray.Direction.Times(-1))
+			if bounce == depth {
+				color = color.Add(throughput.Product(lightColor))
+				break
+			}
+			// emitter found through brdf sampling: weight against
+			// the chance that light sampling would have found it
+			weight := float32(1)
+			if light, ok := scene.areaLight(si); ok {
+				// no light arrives from the back of one-sided lights
+				weight = 0
+				if lightCos := light.cos(si.normal, ray.Direction.Times(-1)); lightCos > 0 {
+					lightPDF := areaLightPDF(scene, light, prev.Point, prev.normal, si.distance, lightCos)
+					weight = powerHeuristic(brdfPDF, lightPDF)
+				}
+			}
+			color = color.Add(throughput.Product(lightColor).Times(weight))
+			break
+		}
+		surfaceDiffuseColor := si.object.GetColor(si)
+		if mat, ok := si.object.GetMaterial().(*SubsurfaceMaterial); ok {
+			exit, weight, ok := mat.randomWalk(pt.random, scene, si)
+			if !ok {
+				break
+			}
+			// the walk accounts for the albedo
+			throughput = throughput.Product(weight)
+			si, surfaceDiffuseColor = exit, NewColor(255, 255, 255)
+		}
+		brdf := surfaceDiffuseColor.Times(INVPI)
+		material := si.object.GetMaterial()
+
+		// direct light sampling
+		if light, lightColor, wi, lightPDF, ok := sampleDirectLight(pt.random, scene, si); ok {
+			cos := si.normal.Dot(wi)
+			// brdf sampling cannot find delta lights
+			weight := float32(1)
+			if light == nil || !light.IsDelta() {
+				weight = powerHeuristic(lightPDF, material.PDF(si.normal, wi))
+			}
+			direct := lightColor.Product(brdf).Times(cos * weight / lightPDF)
+			color = color.Add(throughput.Product(direct))
+		}
+
+		// brdf sampling: continues the path and may hit an emitter
+		direction := si.object.SampleDirection(pt.random, si.normal)
+		brdfPDF = material.PDF(si.normal, direction)
+		if brdfPDF == 0 {
+			break
+		}
+		cos := si.normal.Dot(direction)
+		throughput = throughput.Product(brdf.Times(cos / brdfPDF))
+		throughput, ok = russianRoulette(pt.random, throughput, bounce)
+		if !ok {
+			break
+		}
+		prev = si
+		ray = NewRay(si.Point, direction)
+	}
+	return color
 }
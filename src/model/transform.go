@@ -54,7 +54,17 @@ func (t Transform) Normal(v Vector) Vector {
 
 func (t Transform) Ray(r Ray) Ray {
 	//TODO: floating-point rounding errors
-	return NewRay(t.Point(r.Origin), t.Vector(r.Direction))
+	tr := NewRay(t.Point(r.Origin), t.Vector(r.Direction))
+	tr.stats = r.stats
+	if d := r.Differential; d != nil {
+		tr.Differential = &RayDifferential{
+			RxOrigin:    t.Point(d.RxOrigin),
+			RyOrigin:    t.Point(d.RyOrigin),
+			RxDirection: t.Vector(d.RxDirection).Normalize(),
+			RyDirection: t.Vector(d.RyDirection).Normalize(),
+		}
+	}
+	return tr
 }
 
 // For any invertible n-by-n matrices A and B, (AB)−1 = B−1A−1
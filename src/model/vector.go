@@ -73,6 +73,18 @@ func (u Vector) Cross(v Vector) Vector {
 	}
 }
 
+// returns two vectors that together with v form an orthonormal basis
+// v is assumed to be normalized: pbrt 67
+func coordinateSystem(v Vector) (Vector, Vector) {
+	var s Vector
+	if math.Abs(float64(v.X)) > math.Abs(float64(v.Y)) {
+		s = Vector{-v.Z, 0, v.X}.Times(1 / float32(math.Sqrt(float64(v.X*v.X+v.Z*v.Z))))
+	} else {
+		s = Vector{0, v.Z, -v.Y}.Times(1 / float32(math.Sqrt(float64(v.Y*v.Y+v.Z*v.Z))))
+	}
+	return s, v.Cross(s)
+}
+
 func VectorMin(u, v Vector) Vector {
 	uf := [4]float32{u.X, u.Y, u.Z, 0}
 	vf := [4]float32{v.X, v.Y, v.Z, 0}
@@ -101,6 +113,51 @@ func (u Vector) Get(i Dimension) float32 {
 type Ray struct {
 	Origin    Vector
 	Direction Vector
+	// if set, acceleration structures count their work tracing this ray
+	stats *TraversalStats
+	// if set, the rays through the neighbouring pixels, used to filter textures
+	Differential *RayDifferential
+}
+
+// RayDifferential holds the rays offset by one pixel along x and y on the
+// film from a camera ray: pbrt 2.5.1
+type RayDifferential struct {
+	RxOrigin, RyOrigin       Vector
+	RxDirection, RyDirection Vector
+}
+
+// ScaleDifferentials narrows the footprint of the ray to a fraction s of
+// a pixel, for rays that sample part of a pixel each
+func (r *Ray) ScaleDifferentials(s float32) {
+	if r.Differential == nil {
+		return
+	}
+	d := *r.Differential
+	r.Differential = &RayDifferential{
+		RxOrigin:    r.Origin.Add(VectorFromTo(r.Origin, d.RxOrigin).Times(s)),
+		RyOrigin:    r.Origin.Add(VectorFromTo(r.Origin, d.RyOrigin).Times(s)),
+		RxDirection: r.Direction.Add(d.RxDirection.Sub(r.Direction).Times(s)),
+		RyDirection: r.Direction.Add(d.RyDirection.Sub(r.Direction).Times(s)),
+	}
+}
+
+// TraversalStats counts the work done finding the closest intersection
+// of a ray, including work in nested acceleration structures
+type TraversalStats struct {
+	NodesVisited     int
+	PrimitivesTested int
+}
+
+func (r Ray) countNode() {
+	if r.stats != nil {
+		r.stats.NodesVisited++
+	}
+}
+
+func (r Ray) countPrimitives(n int) {
+	if r.stats != nil {
+		r.stats.PrimitivesTested += n
+	}
 }
 
 func NewRay(o, d Vector) Ray {
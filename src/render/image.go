@@ -50,6 +50,10 @@ func (f Film) Set(x, y int, c model.Color) {
 	f.pixels[f.getArrayIndex(x, y)] = c
 }
 
+func (f Film) Get(x, y int) model.Color {
+	return f.pixels[f.getArrayIndex(x, y)]
+}
+
 func (f Film) SaveAsPNG(filename string) {
 	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
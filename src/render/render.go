@@ -1,6 +1,9 @@
 package render
 
 import (
+	"errors"
+	"math"
+
 	"github.com/deosjr/GRayT/src/model"
 )
 
@@ -19,21 +22,28 @@ type question struct {
 }
 
 type answer struct {
-	x, y  int
-	color model.Color
+	x, y   int
+	color  model.Color
+	splats []model.Splat
 }
 
-func (w worker) work(params Params) {
-	tracer := getTracer(params.TracerType)
+func (w worker) work(params Params, tracer model.Tracer) {
 	if params.TracerType == model.WhittedStyle {
 		params.NumSamples = 1
 	}
 
 	random := tracer.Random()
+	splatter, splatting := tracer.(model.SplattingTracer)
+	// each sample covers part of the pixel, so textures are filtered less
+	differentialScale := float32(1)
+	if params.AntiAliasing && params.NumSamples > 1 {
+		differentialScale = float32(math.Max(0.125, 1/math.Sqrt(float64(params.NumSamples))))
+	}
 	for q := range w.in {
 		x, y := float32(q.x), float32(q.y)
 		var xvar, yvar float32 = 0.5, 0.5
 		ray := params.Scene.Camera.PixelRay(x+xvar, y+yvar)
+		ray.ScaleDifferentials(differentialScale)
 		color := model.NewColor(0, 0, 0)
 		for i := 0; i < params.NumSamples; i++ {
 			// anti-aliasing: first sample is exact middle of pixel
@@ -41,12 +51,17 @@ func (w worker) work(params Params) {
 			if params.AntiAliasing && i != 0 {
 				xvar, yvar = random.Float32(), random.Float32()
 				ray = params.Scene.Camera.PixelRay(x+xvar, y+yvar)
+				ray.ScaleDifferentials(differentialScale)
 			}
 			sampleColor := tracer.GetRayColor(ray, params.Scene, 0)
 			color = color.Add(sampleColor)
 		}
 		color = color.Times(1.0 / float32(params.NumSamples))
-		w.out <- answer{q.x, q.y, color}
+		var splats []model.Splat
+		if splatting {
+			splats = splatter.Splats()
+		}
+		w.out <- answer{q.x, q.y, color, splats}
 	}
 }
 
@@ -56,24 +71,90 @@ type Params struct {
 	NumSamples   int
 	TracerType   model.TracerType
 	AntiAliasing bool
+	// maximum number of bounces per path; 0 means model.DEFAULT_MAX_RAY_DEPTH
+	MaxDepth int
+	// number of photons emitted per pass and the initial lookup radius
+	// for the photon mapping tracers
+	Photons      int
+	PhotonRadius float32
+	// progressive photon mapping averages this many passes,
+	// each with a new photon map and a smaller radius
+	Passes int
+	// ambient occlusion ray length and number of rays per hit
+	AORadius  float32
+	AOSamples int
+	// depth mapped to black by DebugDepth and the traversal cost mapped to
+	// red by the bvh heatmaps; 0 means a default
+	DebugMaxDistance float32
+	DebugMaxCost     int
 }
 
-func getTracer(tt model.TracerType) model.Tracer {
-	switch tt {
+func getTracer(params Params, photons *model.PhotonMap, radius float32) model.Tracer {
+	maxDepth := params.MaxDepth
+	switch tt := params.TracerType; tt {
 	case model.WhittedStyle:
-		return model.NewWhittedRayTracer()
+		return model.NewWhittedRayTracer(maxDepth)
 	case model.Path:
-		return model.NewPathTracer()
+		return model.NewPathTracer(maxDepth)
 	case model.PathNextEventEstimate:
-		return model.NewPathTracerNEE()
+		return model.NewPathTracerNEE(maxDepth)
+	case model.PathMultipleImportanceSampling:
+		return model.NewPathTracerMIS(maxDepth)
+	case model.BidirectionalPath:
+		return model.NewBidirectionalPathTracer(maxDepth)
+	case model.PhotonMapping, model.ProgressivePhotonMapping:
+		return model.NewPhotonMappingTracer(maxDepth, photons, radius)
+	case model.VolumetricPath:
+		return model.NewVolumetricPathTracer(maxDepth)
+	case model.SpectralPath:
+		return model.NewSpectralPathTracer(maxDepth)
+	case model.AmbientOcclusion:
+		return model.NewAmbientOcclusionTracer(params.AORadius, params.AOSamples)
+	case model.DebugShadingNormals, model.DebugGeometricNormals, model.DebugDepth,
+		model.DebugUV, model.DebugObjectID, model.DebugBVHNodeVisits, model.DebugBVHPrimitiveTests:
+		return model.NewDebugTracer(tt, params.DebugMaxDistance, params.DebugMaxCost)
 	}
 	return nil
 }
 
-func Render(params Params) Film {
+// Render returns an error, before tracing any rays, for a tracer that
+// cannot work with the scene's camera
+func Render(params Params) (Film, error) {
+	if params.TracerType == model.BidirectionalPath {
+		// light subpaths are connected to the camera through the lens
+		// of a perspective camera only
+		if _, ok := params.Scene.Camera.(*model.PerspectiveCamera); !ok {
+			return Film{}, errors.New("render: bidirectional path tracing needs a perspective camera")
+		}
+	}
 	w, h := params.Scene.Camera.Width(), params.Scene.Camera.Height()
 	img := newFilm(w, h)
 
+	switch params.TracerType {
+	case model.PhotonMapping:
+		photons := model.NewPhotonMap(params.Scene, params.Photons, params.MaxDepth)
+		renderPass(params, img, photons, params.PhotonRadius)
+	case model.ProgressivePhotonMapping:
+		passes := params.Passes
+		if passes < 1 {
+			passes = 1
+		}
+		radius := params.PhotonRadius
+		for i := 1; i <= passes; i++ {
+			photons := model.NewPhotonMap(params.Scene, params.Photons, params.MaxDepth)
+			renderPass(params, img, photons, radius)
+			radius = model.ProgressiveRadius(radius, i)
+		}
+		img.DivideBySamples(passes)
+	default:
+		renderPass(params, img, nil, 0)
+	}
+	return img, nil
+}
+
+func renderPass(params Params, img Film, photons *model.PhotonMap, radius float32) {
+	w, h := params.Scene.Camera.Width(), params.Scene.Camera.Height()
+
 	inputChannel := make(chan question, params.NumWorkers)
 	outputChannel := make(chan answer, params.NumWorkers)
 
@@ -82,7 +163,7 @@ func Render(params Params) Film {
 			in:  inputChannel,
 			out: outputChannel,
 		}
-		go worker.work(params)
+		go worker.work(params, getTracer(params, photons, radius))
 	}
 
 	go func() {
@@ -100,9 +181,11 @@ func Render(params Params) Film {
 			break
 		}
 		a := <-outputChannel
-		img.Set(a.x, a.y, a.color)
+		img.Add(a.x, a.y, a.color)
+		// splats are estimated once per sample for the whole image
+		for _, s := range a.splats {
+			img.Add(s.X, s.Y, s.Color.Times(1.0/float32(params.NumSamples)))
+		}
 		numPixelSamples--
 	}
-
-	return img
 }
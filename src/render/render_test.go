@@ -13,7 +13,7 @@ func sampleScene(b *testing.B) *model.Scene {
 	l1 := model.NewPointLight(model.Vector{-2, 2, 0}, model.NewColor(255, 255, 255), 300)
 	l2 := model.NewPointLight(model.Vector{-0.1, 1, 0.1}, model.NewColor(255, 255, 255), 400)
 	scene.AddLights(l1, l2)
-	scene.Add(model.NewSphere(model.Vector{3, 1, 5}, 0.5, &model.DiffuseMaterial{Color: model.NewColor(255, 100, 0)}))
+	scene.Add(model.NewSphere(model.Vector{3, 1, 5}, 0.5, model.NewDiffuseMaterial(model.NewConstantTexture(model.NewColor(255, 100, 0)))))
 
 	scene.Precompute()
 
@@ -35,6 +35,22 @@ func benchmarkScene(scene *model.Scene, numWorkers int, b *testing.B) {
 	}
 }
 
+func TestRenderUnsupportedCamera(t *testing.T) {
+	scene := model.NewScene(model.NewOrthographicCamera(4, 4))
+	scene.AddLights(model.NewPointLight(model.Vector{0, 2, 0}, model.NewColor(255, 255, 255), 100))
+	scene.Add(model.NewSphere(model.Vector{0, 0, 0}, 1, model.NewDiffuseMaterial(model.NewConstantTexture(model.NewColor(255, 255, 255)))))
+	scene.Precompute()
+	params := Params{
+		Scene:      scene,
+		NumWorkers: 1,
+		NumSamples: 1,
+		TracerType: model.BidirectionalPath,
+	}
+	if _, err := Render(params); err == nil {
+		t.Error("expected an error rendering bdpt with an orthographic camera")
+	}
+}
+
 // Numbers slightly exaggerated by order of tests
 
 func BenchmarkNumWorkers1(b *testing.B) {